@@ -1,11 +1,11 @@
 package api
 
 import (
-	"context"
 	"strings"
 
 	"github.com/openrfsense/backend/database"
 	"github.com/openrfsense/backend/database/models"
+	"github.com/openrfsense/backend/orgs"
 
 	"github.com/gofiber/fiber/v2"
 )
@@ -13,7 +13,7 @@ import (
 // List campaigns
 //
 // @summary     List campaigns
-// @description Returns a list of campaigns that were successfully started. Will return all campaigns unless either of the query parameters is set.
+// @description Returns a list of campaigns that were successfully started by the organization of the user. Will return all campaigns unless either of the query parameters is set.
 // @tags        data
 // @security    BasicAuth
 // @param       sensors    path string false "Matches campigns which contain ALL these sensors as a comma-separated list."
@@ -26,7 +26,11 @@ func CampaignsGet(ctx *fiber.Ctx) error {
 	campaignId := ctx.Query("campaignId")
 	sensors := ctx.Query("sensors")
 
-	builder := database.Instance().Select("*").From("campaigns")
+	builder := database.Instance().
+		Select("*").
+		From("campaigns").
+		Where("organization = ?", orgs.Current(ctx)).
+		Where("status = ?", models.CampaignActive)
 	if len(campaignId) > 0 {
 		builder = builder.Where("campaign_id = ?", campaignId)
 	}
@@ -37,7 +41,7 @@ func CampaignsGet(ctx *fiber.Ctx) error {
 
 	sql, args, _ := builder.ToSql()
 	campaigns, err := database.Multiple[models.Campaign](
-		context.Background(),
+		ctx.UserContext(),
 		sql,
 		args...,
 	)
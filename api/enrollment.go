@@ -0,0 +1,188 @@
+package api
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/openrfsense/backend/database/models"
+	"github.com/openrfsense/backend/nodes"
+	"github.com/openrfsense/backend/orgs"
+)
+
+// Type enrollmentCode is returned when a new enrollment code is generated.
+type enrollmentCode struct {
+	// The one-time enrollment code
+	Code string `json:"code"`
+
+	// The code cannot be used after this time
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// Request enrollment for a sensor
+//
+// @summary     Request enrollment for a sensor
+// @description Creates a pending enrollment request for a new sensor, which has to present a valid one-time enrollment code. Does not require authentication.
+// @tags        enrollment
+// @accept      json
+// @param       request body models.EnrollmentRequest true "Enrollment request object"
+// @success     202 "The enrollment request is now pending approval"
+// @failure     400 "Malformed request"
+// @failure     403 "The enrollment code is invalid, expired or already used"
+// @failure     409 "The sensor is already enrolled or has a pending request"
+// @router      /enroll [post]
+func EnrollPost(ctx *fiber.Ctx) error {
+	req := models.EnrollmentRequest{}
+	err := ctx.BodyParser(&req)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	err = nodes.Enroll(ctx.UserContext(), req)
+	if err != nil {
+		return enrollmentError(err)
+	}
+
+	ctx.Set("Location", "/enroll/"+req.SensorId)
+	return ctx.SendStatus(fiber.StatusAccepted)
+}
+
+// Retrieve node credentials
+//
+// @summary     Retrieve node credentials
+// @description Returns the NATS credentials issued to a sensor once its enrollment request has been approved. The enrollment code used for the request must be sent in the `X-Enrollment-Code` header. Credentials can only be retrieved once. Does not require authentication.
+// @tags        enrollment
+// @param       sensor_id         path   string true "Node hardware ID"
+// @param       X-Enrollment-Code header string true "Enrollment code used for the request"
+// @produce     json
+// @success     200 {object} models.NodeCredentials "NATS credentials for the node"
+// @failure     403 "The enrollment code does not match"
+// @failure     404 "No such enrollment request"
+// @failure     409 "The request has not been approved yet, or the credentials were already retrieved"
+// @router      /enroll/{sensor_id} [get]
+func EnrollGet(ctx *fiber.Ctx) error {
+	creds, err := nodes.Credentials(ctx.UserContext(), ctx.Params("sensor_id"), ctx.Get("X-Enrollment-Code"))
+	if err != nil {
+		return enrollmentError(err)
+	}
+
+	return ctx.JSON(creds)
+}
+
+// Generate an enrollment code
+//
+// @summary     Generate an enrollment code
+// @description Generates a new one-time enrollment code for the organization of the user, valid for 24 hours. The code is only shown once.
+// @tags        enrollment
+// @security    BasicAuth
+// @produce     json
+// @success     201 {object} enrollmentCode "The new enrollment code"
+// @failure     500 "Generally a database error"
+// @router      /enrollments/codes [post]
+func EnrollmentCodePost(ctx *fiber.Ctx) error {
+	code, expires, err := nodes.CreateCode(ctx.UserContext(), orgs.Current(ctx))
+	if err != nil {
+		return err
+	}
+
+	return ctx.Status(fiber.StatusCreated).JSON(enrollmentCode{
+		Code:      code,
+		ExpiresAt: expires,
+	})
+}
+
+// List enrollment requests
+//
+// @summary     List enrollment requests
+// @description Returns all enrolled nodes and enrollment requests in the organization of the user, optionally filtered by status.
+// @tags        enrollment
+// @security    BasicAuth
+// @param       status query string false "One of pending, approved, rejected, revoked"
+// @produce     json
+// @success     200 {array} models.Node "All nodes matching the given status"
+// @failure     500 "Generally a database error"
+// @router      /enrollments [get]
+func EnrollmentsGet(ctx *fiber.Ctx) error {
+	all, err := nodes.List(ctx.UserContext(), orgs.Current(ctx), ctx.Query("status"))
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(all)
+}
+
+// Approve an enrollment request
+//
+// @summary     Approve an enrollment request
+// @description Approves a pending enrollment request and issues node-specific NATS credentials.
+// @tags        enrollment
+// @security    BasicAuth
+// @param       sensor_id path string true "Node hardware ID"
+// @success     204 "The node has been approved"
+// @failure     409 "The node has no pending enrollment request"
+// @router      /enrollments/{sensor_id}/approve [post]
+func EnrollmentApprovePost(ctx *fiber.Ctx) error {
+	err := nodes.Approve(ctx.UserContext(), orgs.Current(ctx), ctx.Params("sensor_id"))
+	if err != nil {
+		return enrollmentError(err)
+	}
+
+	return ctx.SendStatus(fiber.StatusNoContent)
+}
+
+// Reject an enrollment request
+//
+// @summary     Reject an enrollment request
+// @description Rejects a pending enrollment request.
+// @tags        enrollment
+// @security    BasicAuth
+// @param       sensor_id path string true "Node hardware ID"
+// @success     204 "The node has been rejected"
+// @failure     409 "The node has no pending enrollment request"
+// @router      /enrollments/{sensor_id}/reject [post]
+func EnrollmentRejectPost(ctx *fiber.Ctx) error {
+	err := nodes.Reject(ctx.UserContext(), orgs.Current(ctx), ctx.Params("sensor_id"))
+	if err != nil {
+		return enrollmentError(err)
+	}
+
+	return ctx.SendStatus(fiber.StatusNoContent)
+}
+
+// Revoke a node
+//
+// @summary     Revoke a node
+// @description Revokes the credentials of an enrolled node and immediately disconnects it from the NATS server.
+// @tags        enrollment
+// @security    BasicAuth
+// @param       sensor_id path string true "Node hardware ID"
+// @success     204 "The node has been revoked"
+// @failure     404 "No approved node with the given ID"
+// @router      /nodes/{sensor_id} [delete]
+func NodeDelete(ctx *fiber.Ctx) error {
+	err := nodes.Revoke(ctx.UserContext(), orgs.Current(ctx), ctx.Params("sensor_id"))
+	if err != nil {
+		return enrollmentError(err)
+	}
+
+	return ctx.SendStatus(fiber.StatusNoContent)
+}
+
+// Maps errors from the nodes package to HTTP errors.
+func enrollmentError(err error) error {
+	switch {
+	case errors.Is(err, nodes.ErrInvalidId):
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	case errors.Is(err, nodes.ErrInvalidCode):
+		return fiber.NewError(fiber.StatusForbidden, err.Error())
+	case errors.Is(err, nodes.ErrNotFound):
+		return fiber.NewError(fiber.StatusNotFound, err.Error())
+	case errors.Is(err, nodes.ErrAlreadyExists),
+		errors.Is(err, nodes.ErrNotPending),
+		errors.Is(err, nodes.ErrNotApproved):
+		return fiber.NewError(fiber.StatusConflict, err.Error())
+	}
+
+	return err
+}
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/openrfsense/backend/events"
+	"github.com/openrfsense/backend/orgs"
+)
+
+// Interval between keep-alive comments, also used to detect closed connections
+const keepAliveInterval = 15 * time.Second
+
+// Stream backend events
+//
+// @summary     Stream backend events
+// @description Streams events for the organization of the user (such as measurement job updates) as server-sent events. The event name is the type of the event (e.g. `job`) and its data is a JSON object.
+// @tags        events
+// @security    BasicAuth
+// @produce     text/event-stream
+// @success     200 "A never-ending stream of events"
+// @router      /events [get]
+func EventsGet(ctx *fiber.Ctx) error {
+	ctx.Set("Content-Type", "text/event-stream")
+	ctx.Set("Cache-Control", "no-cache")
+	ctx.Set("Connection", "keep-alive")
+
+	// The fiber context cannot be used from within the stream writer
+	org := orgs.Current(ctx)
+	ctx.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		sub, unsubscribe := events.Subscribe(org)
+		defer unsubscribe()
+
+		ticker := time.NewTicker(keepAliveInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case event := <-sub:
+				data, err := json.Marshal(event.Data)
+				if err != nil {
+					continue
+				}
+				fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+			case <-ticker.C:
+				fmt.Fprint(w, ": keep-alive\n\n")
+			}
+
+			// Flushing fails once the client has gone away
+			if w.Flush() != nil {
+				return
+			}
+		}
+	})
+
+	return nil
+}
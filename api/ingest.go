@@ -0,0 +1,57 @@
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/openrfsense/backend/samples"
+)
+
+// Maximum size of a decompressed batch
+const maxBatchSize = 64 << 20
+
+// Upload a batch of samples
+//
+// @summary     Upload a batch of samples
+// @description Accepts a batch of samples from an enrolled sensor, authenticated with its NATS credentials. The batch can be an Avro object container file (`application/avro`), a sequence of Avro records each prefixed with its length as a big endian uint32 (`application/octet-stream`) or one JSON sample per line (`application/x-ndjson`), optionally compressed with `Content-Encoding: gzip`. Samples go through the same validation as samples sent to the collector: samples belonging to other sensors are rejected, and samples which do not match their campaign are quarantined.
+// @tags        data
+// @security    BasicAuth
+// @accept      application/avro,application/octet-stream,application/x-ndjson
+// @produce     json
+// @success     200 {object} models.IngestResult "Outcome for each sample in the batch"
+// @failure     400 "The batch could not be read"
+// @failure     401 "Not an enrolled sensor"
+// @failure     415 "Unsupported content type"
+// @router      /ingest [post]
+func IngestPost(ctx *fiber.Ctx) error {
+	var body io.Reader = bytes.NewReader(ctx.Body())
+	if strings.EqualFold(ctx.Get(fiber.HeaderContentEncoding), "gzip") {
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+		defer gz.Close()
+		body = gz
+	}
+	body = io.LimitReader(body, maxBatchSize)
+
+	sensorId, _ := ctx.Locals("username").(string)
+	result, err := samples.Ingest(ctx.UserContext(), sensorId, ctx.Get(fiber.HeaderContentType), body)
+	switch {
+	case errors.Is(err, samples.ErrUnsupportedContentType):
+		return fiber.NewError(fiber.StatusUnsupportedMediaType, err.Error())
+	case errors.Is(err, samples.ErrCollectorStopped):
+		return fiber.NewError(fiber.StatusServiceUnavailable, err.Error())
+	case errors.Is(err, samples.ErrMalformedBatch):
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	case err != nil:
+		return err
+	}
+
+	return ctx.JSON(result)
+}
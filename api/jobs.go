@@ -0,0 +1,34 @@
+package api
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/openrfsense/backend/jobs"
+	"github.com/openrfsense/backend/orgs"
+)
+
+// Get a measurement job
+//
+// @summary     Get a measurement job
+// @description Returns the dispatch progress of a measurement job: the status of each sensor, acknowledgements, retries and the resulting campaign, if any.
+// @tags        measurement
+// @security    BasicAuth
+// @param       job_id path string true "Job ID"
+// @produce     json
+// @success     200 {object} models.Job "The job object"
+// @failure     404 "No such job"
+// @failure     500 "Generally a database error"
+// @router      /jobs/{job_id} [get]
+func JobGet(ctx *fiber.Ctx) error {
+	job, err := jobs.Get(ctx.UserContext(), orgs.Current(ctx), ctx.Params("job_id"))
+	if errors.Is(err, jobs.ErrNotFound) {
+		return fiber.NewError(fiber.StatusNotFound, err.Error())
+	}
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(job)
+}
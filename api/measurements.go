@@ -2,25 +2,26 @@ package api
 
 import (
 	"github.com/gofiber/fiber/v2"
-	"github.com/openrfsense/backend/database"
-	"github.com/openrfsense/backend/nats"
+	"github.com/openrfsense/backend/database/models"
+	"github.com/openrfsense/backend/jobs"
+	"github.com/openrfsense/backend/orgs"
 	"github.com/openrfsense/common/id"
-	"github.com/openrfsense/common/stats"
 	"github.com/openrfsense/common/types"
 )
 
-// Starts a measurement on a list of nodes and returns an aggregated spectrum measurement
+// Starts a measurement on a list of nodes and returns the job dispatching the request
 //
-// @summary     Get an aggregated spectrum measurement from a list of nodes
-// @description Sends an aggregated measurement request to the nodes specified in `sensors` and returns a list of `stats.Stats` objects for all sensors taking part in the campaign. Will time out in `300ms` if any sensor does not respond.
+// @summary     Start an aggregated spectrum measurement on a list of nodes
+// @description Creates a job which sends an aggregated measurement request to the nodes specified in `sensors` in the background, retrying for sensors which do not acknowledge it. The campaign is created right away with the `pending` status, and becomes `active` once the first sensor acknowledges the request (or `failed` if none does). Job progress can be followed on `/jobs/{job_id}` or on the `/events` stream.
 // @tags        measurement
 // @security    BasicAuth
 // @accept      json
 // @param       id body types.AggregatedMeasurementRequest true "Measurement request object"
 // @produce     json
-// @success     201 {array}  stats.Stats "Bare statistics for all nodes in the measurement campaign. Will always include sensor status information."
-// @header      201 {string} Location    "Location of the new campaign object."
-// @failure     500 "When the internal timeout for information retrieval expires"
+// @success     202 {object} models.Job "The new job, with per-sensor dispatch status"
+// @header      202 {string} Location   "Location of the new job object."
+// @failure     400 "Malformed request"
+// @failure     500 "Generally a database error"
 // @router      /aggregated [post]
 func AggregatedPost(ctx *fiber.Ctx) error {
 	amr := types.AggregatedMeasurementRequest{}
@@ -38,42 +39,35 @@ func AggregatedPost(ctx *fiber.Ctx) error {
 	// Overwrite campaign ID
 	amr.CampaignId = id.Generate(9)
 
-	statsAll, err := nats.Ping[stats.Stats]("node.all.aggregated", "node.get.all.aggregated", nats.PingConfig{
-		Message: amr,
-		HowMany: len(amr.Sensors),
-	})
+	job, err := jobs.Submit(ctx.UserContext(), models.Campaign{
+		CampaignId:   amr.CampaignId,
+		Sensors:      amr.Sensors,
+		Type:         "PSD",
+		Begin:        amr.Begin,
+		End:          amr.End,
+		Organization: orgs.Current(ctx),
+	}, amr)
 	if err != nil {
 		return err
 	}
 
-	err = database.Do(
-		ctx.Context(),
-		`insert into campaigns ("campaign_id", "sensors", "type", "begin", "end") values ($1, $2, 'PSD', $3, $4)`,
-		amr.CampaignId,
-		amr.Sensors,
-		amr.Begin,
-		amr.End,
-	)
-	if err != nil {
-		return err
-	}
-
-	ctx.Set("Location", "/campaigns?campaignId="+amr.CampaignId)
-	return ctx.Status(fiber.StatusCreated).JSON(statsAll)
+	ctx.Set("Location", "/jobs/"+job.JobId)
+	return ctx.Status(fiber.StatusAccepted).JSON(job)
 }
 
-// Starts a measurement on a node and returns the raw spectrum measurement
+// Starts a measurement on a list of nodes and returns the job dispatching the request
 //
-// @summary     Get a raw spectrum measurement from a list of nodes
-// @description Sends a raw measurement request to the nodes specified in `sensors` and returns a list of `stats.Stats` objects for all sensors taking part in the campaign. Will time out in `300ms` if any sensor does not respond.
+// @summary     Start a raw spectrum measurement on a list of nodes
+// @description Creates a job which sends a raw measurement request to the nodes specified in `sensors` in the background, retrying for sensors which do not acknowledge it. The campaign is created right away with the `pending` status, and becomes `active` once the first sensor acknowledges the request (or `failed` if none does). Job progress can be followed on `/jobs/{job_id}` or on the `/events` stream.
 // @tags        measurement
 // @security    BasicAuth
 // @accept      json
 // @param       id body types.RawMeasurementRequest true "Measurement request object"
 // @produce     json
-// @success     201 {array}  stats.Stats "Bare statistics for all nodes in the measurement campaign. Will always include sensor status information."
-// @header      201 {string} Location    "Location of the new campaign object."
-// @failure     500 "When the internal timeout for information retrieval expires"
+// @success     202 {object} models.Job "The new job, with per-sensor dispatch status"
+// @header      202 {string} Location   "Location of the new job object."
+// @failure     400 "Malformed request"
+// @failure     500 "Generally a database error"
 // @router      /raw [post]
 func RawPost(ctx *fiber.Ctx) error {
 	rmr := types.RawMeasurementRequest{}
@@ -91,26 +85,18 @@ func RawPost(ctx *fiber.Ctx) error {
 	// Overwrite campaign ID
 	rmr.CampaignId = id.Generate(9)
 
-	statsAll, err := nats.Ping[stats.Stats]("node.all.raw", "node.get.all.raw", nats.PingConfig{
-		Message: rmr,
-		HowMany: len(rmr.Sensors),
-	})
-	if err != nil {
-		return err
-	}
-
-	err = database.Do(
-		ctx.Context(),
-		`insert into campaigns ("campaign_id", "sensors", "type", "begin", "end") values ($1, $2, 'IQ', $3, $4)`,
-		rmr.CampaignId,
-		rmr.Sensors,
-		rmr.Begin,
-		rmr.End,
-	)
+	job, err := jobs.Submit(ctx.UserContext(), models.Campaign{
+		CampaignId:   rmr.CampaignId,
+		Sensors:      rmr.Sensors,
+		Type:         "IQ",
+		Begin:        rmr.Begin,
+		End:          rmr.End,
+		Organization: orgs.Current(ctx),
+	}, rmr)
 	if err != nil {
 		return err
 	}
 
-	ctx.Set("Location", "/campaigns?campaignId="+rmr.CampaignId)
-	return ctx.Status(fiber.StatusCreated).JSON(statsAll)
+	ctx.Set("Location", "/jobs/"+job.JobId)
+	return ctx.Status(fiber.StatusAccepted).JSON(job)
 }
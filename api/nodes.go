@@ -8,13 +8,14 @@ import (
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/openrfsense/backend/nats"
+	"github.com/openrfsense/backend/orgs"
 	"github.com/openrfsense/common/stats"
 )
 
 // List nodes
 //
 // @summary     List nodes
-// @description Returns a list of all connected nodes by their hardware ID. Will time out in `300ms` if any one of the nodes does not respond.
+// @description Returns a list of all connected nodes belonging to the organization of the user by their hardware ID. Will time out in `300ms` if any one of the nodes does not respond.
 // @tags        administration
 // @security    BasicAuth
 // @produce     json
@@ -22,8 +23,9 @@ import (
 // @failure     500 "When the internal timeout for information retrieval expires"
 // @router      /nodes [get]
 func NodesGet(ctx *fiber.Ctx) error {
-	statsAll, err := nats.Ping[stats.Stats]("node.all", "node.get.all", nats.PingConfig{
-		Timeout: 100 * time.Millisecond,
+	statsAll, err := nats.PingContext[stats.Stats](ctx.UserContext(), "node.all", "node.get.all", nats.PingConfig{
+		Timeout:      100 * time.Millisecond,
+		Organization: orgs.Current(ctx),
 	})
 	if err != nil {
 		return err
@@ -51,7 +53,7 @@ func NodeGet(ctx *fiber.Ctx) error {
 
 	stat := stats.Stats{}
 	channel := fmt.Sprintf("node.%s.stats", strings.Trim(id, "."))
-	err := nats.Conn().Request(channel, "", &stat, 300*time.Millisecond)
+	err := nats.ConnFor(orgs.Current(ctx)).Request(channel, "", &stat, 300*time.Millisecond)
 	if err != nil {
 		return err
 	}
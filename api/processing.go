@@ -0,0 +1,56 @@
+package api
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/openrfsense/backend/orgs"
+	"github.com/openrfsense/backend/samples"
+	"github.com/openrfsense/backend/samples/stream"
+)
+
+// Computes the PSD of a raw campaign and returns the job processing it
+//
+// @summary     Compute the PSD of a raw campaign
+// @description Creates a PSD campaign derived from a raw (IQ) campaign, with the same sensors, begin and end, and a job which computes its samples from the IQ samples in the background with Welch's method: the IQ samples of each record are split into segments of `fftSize` samples (a power of two, 1024 by default) overlapping by `overlap` (0.5 by default), multiplied by the `window` function (`rectangular`, `hann` by default, `hamming` or `blackman`) and transformed, and the power of each bin is averaged. The frequency correction factor of each record is applied to the IQ samples and its antenna gain is subtracted from the result, in dB/Hz. The derived campaign lists the original campaign in `derivedFrom`, and becomes active once the job completes. Job progress can be followed on `/jobs/{job_id}` or on the `/events` stream.
+// @tags        measurement
+// @security    BasicAuth
+// @accept      json
+// @param       campaignId path string             true "Raw campaign to compute the PSD of"
+// @param       config     body stream.WelchConfig false "Parameters of Welch's method"
+// @produce     json
+// @success     202 {object} models.Job "The new job, with the progress of each sensor"
+// @header      202 {string} Location   "Location of the new job object."
+// @failure     400 "Malformed request, or the campaign is not a raw campaign"
+// @failure     404 "No such campaign"
+// @failure     500 "Generally a database error"
+// @router      /campaigns/{campaignId}/psd [post]
+func CampaignPSDPost(ctx *fiber.Ctx) error {
+	config := stream.WelchConfig{}
+	if len(ctx.Body()) > 0 {
+		err := ctx.BodyParser(&config)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+	}
+
+	err := config.Validate()
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	job, err := samples.DerivePSD(ctx.UserContext(), orgs.Current(ctx), ctx.Params("campaign_id"), config)
+	if errors.Is(err, samples.ErrUnknownCampaign) {
+		return fiber.NewError(fiber.StatusNotFound, err.Error())
+	}
+	if errors.Is(err, samples.ErrNotIQCampaign) {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	if err != nil {
+		return err
+	}
+
+	ctx.Set("Location", "/jobs/"+job.JobId)
+	return ctx.Status(fiber.StatusAccepted).JSON(job)
+}
@@ -0,0 +1,32 @@
+package api
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestCampaignPSDPostBadRequest(t *testing.T) {
+	app := fiber.New()
+	app.Post("/campaigns/:campaign_id/psd", CampaignPSDPost)
+
+	tests := map[string]string{
+		"malformed body": `{"fftSize": `,
+		"invalid window": `{"window": "triangular"}`,
+		"invalid size":   `{"fftSize": 1000}`,
+	}
+	for name, body := range tests {
+		req := httptest.NewRequest(fiber.MethodPost, "/campaigns/campaign/psd", strings.NewReader(body))
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != fiber.StatusBadRequest {
+			t.Errorf("%s: expected status %d, got %d", name, fiber.StatusBadRequest, resp.StatusCode)
+		}
+	}
+}
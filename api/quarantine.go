@@ -0,0 +1,90 @@
+package api
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/openrfsense/backend/orgs"
+	"github.com/openrfsense/backend/samples"
+)
+
+// List quarantined samples
+//
+// @summary     List quarantined samples
+// @description Returns the samples rejected by the collector in the organization of the user, along with the reason they were rejected. Samples are quarantined if their campaign does not exist, if the sensor is not part of the campaign, if the sample type does not match the campaign type or if the sample was recorded outside of the campaign.
+// @tags        data
+// @security    BasicAuth
+// @param       campaignId query string false "Matches samples which claim to belong to this campaign"
+// @param       sensorId   query string false "Matches samples which claim to come from this sensor"
+// @produce     json
+// @success     200 {array} models.QuarantinedSample "All quarantined samples which match the given parameters"
+// @failure     500 "Generally a database error"
+// @router      /quarantine [get]
+func QuarantineGet(ctx *fiber.Ctx) error {
+	quarantined, err := samples.Quarantined(
+		ctx.UserContext(),
+		orgs.Current(ctx),
+		ctx.Query("campaignId"),
+		ctx.Query("sensorId"),
+	)
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(quarantined)
+}
+
+// Release a quarantined sample
+//
+// @summary     Release a quarantined sample
+// @description Removes a sample from the quarantine and stores it along with the samples of the campaign it claims to belong to.
+// @tags        data
+// @security    BasicAuth
+// @param       id path int true "Quarantined sample ID"
+// @success     204 "The sample has been released"
+// @failure     404 "No such quarantined sample"
+// @router      /quarantine/{id}/release [post]
+func QuarantineReleasePost(ctx *fiber.Ctx) error {
+	id, err := ctx.ParamsInt("id")
+	if err != nil || id < 0 {
+		return fiber.ErrNotFound
+	}
+
+	err = samples.Release(ctx.UserContext(), orgs.Current(ctx), uint64(id))
+	if errors.Is(err, samples.ErrNotQuarantined) {
+		return fiber.NewError(fiber.StatusNotFound, err.Error())
+	}
+	if err != nil {
+		return err
+	}
+
+	return ctx.SendStatus(fiber.StatusNoContent)
+}
+
+// Discard a quarantined sample
+//
+// @summary     Discard a quarantined sample
+// @description Permanently deletes a sample from the quarantine.
+// @tags        data
+// @security    BasicAuth
+// @param       id path int true "Quarantined sample ID"
+// @success     204 "The sample has been deleted"
+// @failure     404 "No such quarantined sample"
+// @router      /quarantine/{id} [delete]
+func QuarantineDelete(ctx *fiber.Ctx) error {
+	id, err := ctx.ParamsInt("id")
+	if err != nil || id < 0 {
+		return fiber.ErrNotFound
+	}
+
+	err = samples.Discard(ctx.UserContext(), orgs.Current(ctx), uint64(id))
+	if errors.Is(err, samples.ErrNotQuarantined) {
+		return fiber.NewError(fiber.StatusNotFound, err.Error())
+	}
+	if err != nil {
+		return err
+	}
+
+	return ctx.SendStatus(fiber.StatusNoContent)
+}
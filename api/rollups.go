@@ -0,0 +1,68 @@
+package api
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/openrfsense/backend/orgs"
+	"github.com/openrfsense/backend/samples"
+)
+
+// Get PSD rollups
+//
+// @summary     Get PSD rollups
+// @description Returns the PSD frames recorded during a campaign aggregated into fixed time buckets of 1 minute, 1 hour or 1 day, with the minimum, mean and maximum of each bin and the number of frames it aggregates. Frames are aggregated separately for each sensor and center frequency. Unless a resolution is requested, the finest resolution which covers the requested time range (or the whole campaign) with at most `limit` buckets is used. Rollups are kept after the samples of the campaign expire.
+// @tags        data
+// @security    BasicAuth
+// @param       campaignId path  string true  "Campaign which the rollups belong to"
+// @param       sensorId   query string false "Sensor which the rollups belong to (all sensors of the campaign if missing)"
+// @param       from       query string false "Rollups returned will start at or later than this date (must be in ISO 8601/RFC 3339)"
+// @param       to         query string false "Rollups returned will start strictly before this date (must be in ISO 8601/RFC 3339)"
+// @param       resolution query string false "Length of the buckets (1m, 1h or 1d)"
+// @param       limit      query int    false "Maximum number of rollups returned (1000 by default)"
+// @produce     json
+// @success     200 {object} models.RollupSeries "All rollups which respect the given conditions"
+// @failure     400 "Invalid parameters"
+// @failure     404 "No such campaign"
+// @failure     500 "Generally a database error"
+// @router      /campaigns/{campaignId}/rollups [get]
+func RollupsGet(ctx *fiber.Ctx) error {
+	query := samples.SampleQuery{
+		CampaignId: ctx.Params("campaign_id"),
+		SensorId:   ctx.Query("sensorId"),
+	}
+
+	var err error
+	if fromStr := ctx.Query("from"); len(fromStr) > 0 {
+		query.From, err = time.Parse(time.RFC3339, fromStr)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+	}
+	if toStr := ctx.Query("to"); len(toStr) > 0 {
+		query.To, err = time.Parse(time.RFC3339, toStr)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+	}
+
+	limit := ctx.QueryInt("limit", defaultSamplesLimit)
+	if limit <= 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "limit must be positive")
+	}
+
+	series, err := samples.RetrieveRollups(ctx.UserContext(), orgs.Current(ctx), query, ctx.Query("resolution"), limit)
+	if errors.Is(err, samples.ErrUnknownCampaign) {
+		return fiber.NewError(fiber.StatusNotFound, err.Error())
+	}
+	if errors.Is(err, samples.ErrUnknownResolution) {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(series)
+}
@@ -4,7 +4,6 @@ import (
 	"html/template"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/gofiber/fiber/v2/middleware/basicauth"
 	"github.com/gofiber/fiber/v2/middleware/logger"
 	"github.com/gofiber/fiber/v2/middleware/monitor"
 	"github.com/gofiber/fiber/v2/middleware/recover"
@@ -13,6 +12,11 @@ import (
 	"github.com/gofiber/swagger"
 	"github.com/knadh/koanf"
 
+	"github.com/openrfsense/backend/metrics"
+	"github.com/openrfsense/backend/nodes"
+	"github.com/openrfsense/backend/orgs"
+	"github.com/openrfsense/backend/tracing"
+
 	_ "github.com/openrfsense/backend/docs"
 )
 
@@ -51,29 +55,50 @@ var swaggerConfig = swagger.Config{
 // Creates a router for the public API. Initializes all REST endpoints under the given prefix
 // and servers swagger documentation on /swagger.
 func Init(config *koanf.Koanf, router *fiber.App, prefix string) {
-	creds := config.MustStringMap("backend.users")
-
 	// TODO: rate limiting?
 	router.Use(
 		helmet.New(),
 		recover.New(),
 		requestid.New(),
+		tracing.Middleware(),
 	)
+	if config.Bool("backend.metrics") {
+		router.Use(metrics.Middleware())
+	}
+
+	// Enrollment endpoints used by sensors, which have no credentials yet
+	router.Post(prefix+"/enroll", logger.New(), EnrollPost)
+	router.Get(prefix+"/enroll/:sensor_id", logger.New(), EnrollGet)
+
+	// Sample uploads from enrolled sensors
+	router.Post(prefix+"/ingest", logger.New(), nodes.Authentication(), IngestPost)
 
 	// Backend router for /api/v1
 	router.Route(prefix, func(router fiber.Router) {
 		router.Use(
 			logger.New(),
-			basicauth.New(basicauth.Config{
-				Users: creds,
-			}),
+			orgs.Authentication(config),
 		)
 		router.Get("/campaigns", CampaignsGet)
+		router.Get("/campaigns/:campaign_id/rollups", RollupsGet)
+		router.Post("/campaigns/:campaign_id/psd", CampaignPSDPost)
 		router.Get("/samples", SamplesGet)
+		router.Get("/schemas", SchemasGet)
+		router.Get("/storage", StorageGet)
+		router.Get("/quarantine", QuarantineGet)
+		router.Post("/quarantine/:id/release", QuarantineReleasePost)
+		router.Delete("/quarantine/:id", QuarantineDelete)
 		router.Get("/nodes", NodesGet)
 		router.Get("/nodes/:sensor_id", NodeGet)
+		router.Delete("/nodes/:sensor_id", NodeDelete)
+		router.Get("/enrollments", EnrollmentsGet)
+		router.Post("/enrollments/codes", EnrollmentCodePost)
+		router.Post("/enrollments/:sensor_id/approve", EnrollmentApprovePost)
+		router.Post("/enrollments/:sensor_id/reject", EnrollmentRejectPost)
 		router.Post("/aggregated", AggregatedPost)
 		router.Post("/raw", RawPost)
+		router.Get("/jobs/:job_id", JobGet)
+		router.Get("/events", EventsGet)
 	})
 
 	// Setup documentation routes
@@ -82,5 +107,6 @@ func Init(config *koanf.Koanf, router *fiber.App, prefix string) {
 	// Metrics page and API, but only if enabled in configuration
 	if config.Bool("backend.metrics") {
 		router.Get("/metrics", monitor.New())
+		router.Get("/metrics/prometheus", metrics.Handler())
 	}
 }
@@ -1,58 +1,72 @@
 package api
 
 import (
-	"github.com/openrfsense/backend/database/models"
+	"errors"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
+
+	"github.com/openrfsense/backend/orgs"
+	"github.com/openrfsense/backend/samples"
 )
 
+// Default number of samples returned by SamplesGet
+const defaultSamplesLimit = 1000
+
 // Get samples
 //
 // @summary     Get samples
 // @description Returns a list of all the samples recorded during a campaign by a specific sensors partaking in said campaign.
 // @tags        data
 // @security    BasicAuth
-// @param       sensorId   path string true  "Sensor which the samples belong to"
-// @param       campaignId path string true  "Campaign which the samples belong to"
-// @param       from       path string false "Samples returned will have been received strictly later than this date (must be in ISO 8601/RFC 3339)"
-// @param       to         path string false "Samples returned will have been received strictly before this date (must be in ISO 8601/RFC 3339)"
+// @param       sensorId   query string false "Sensor which the samples belong to (all sensors of the campaign if missing)"
+// @param       campaignId query string true  "Campaign which the samples belong to"
+// @param       from       query string false "Samples returned will have been received strictly later than this date (must be in ISO 8601/RFC 3339)"
+// @param       to         query string false "Samples returned will have been received strictly before this date (must be in ISO 8601/RFC 3339)"
+// @param       limit      query int    false "Maximum number of samples returned (1000 by default)"
 // @produce     json
 // @success     200 {array} models.Sample "All samples which respect the given conditions"
+// @failure     400 "Invalid parameters"
+// @failure     404 "No such campaign"
 // @failure     500 "Generally a database error"
 // @router      /samples [get]
 func SamplesGet(ctx *fiber.Ctx) error {
-	// sensorId := ctx.Query("sensorId")
-	// campaignId := ctx.Query("campaignId")
-
-	// if len(sensorId) == 0 || len(campaignId) == 0 {
-	// 	return fiber.NewError(fiber.StatusBadRequest, "sensorId and campaignId must be defined")
-	// }
-
-	// var err error
-	// var from time.Time
-	// if fromStr := ctx.Query("from"); len(fromStr) > 0 {
-	// 	from, err = time.Parse(time.RFC3339, fromStr)
-	// 	if err != nil {
-	// 		return err
-	// 	}
-	// }
-
-	// var to time.Time
-	// if toStr := ctx.Query("to"); len(toStr) > 0 {
-	// 	to, err = time.Parse(time.RFC3339, toStr)
-	// 	if err != nil {
-	// 		return err
-	// 	}
-	// }
-
-	samples := []models.Sample{}
-	// samples, err := samples.RetrieveSamples(campaignId, sensorId, from, to)
-	// if err != nil {
-	// 	return err
-	// }
-	// if len(samples) == 0 {
-	// 	return ctx.JSON(samples)
-	// }
-
-	return ctx.JSON(samples)
+	query := samples.SampleQuery{
+		CampaignId: ctx.Query("campaignId"),
+		SensorId:   ctx.Query("sensorId"),
+	}
+	if len(query.CampaignId) == 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "campaignId must be defined")
+	}
+
+	var err error
+	if fromStr := ctx.Query("from"); len(fromStr) > 0 {
+		query.From, err = time.Parse(time.RFC3339, fromStr)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+		// The store includes samples recorded exactly at From
+		query.From = query.From.Add(time.Microsecond)
+	}
+	if toStr := ctx.Query("to"); len(toStr) > 0 {
+		query.To, err = time.Parse(time.RFC3339, toStr)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+	}
+
+	limit := ctx.QueryInt("limit", defaultSamplesLimit)
+	if limit <= 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "limit must be positive")
+	}
+
+	found, err := samples.RetrieveSamples(ctx.UserContext(), orgs.Current(ctx), query, limit)
+	if errors.Is(err, samples.ErrUnknownCampaign) {
+		return fiber.NewError(fiber.StatusNotFound, err.Error())
+	}
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(found)
 }
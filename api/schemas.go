@@ -0,0 +1,20 @@
+package api
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/openrfsense/backend/samples"
+)
+
+// List sample schemas
+//
+// @summary     List sample schemas
+// @description Returns all Avro schemas which sensors can use to write samples, identified by their CRC-64-AVRO fingerprint. Samples in Avro single-object encoding are decoded with the schema matching their fingerprint and resolved to the current schema, while samples without a fingerprint are assumed to use the current schema.
+// @tags        data
+// @security    BasicAuth
+// @produce     json
+// @success     200 {array} models.SampleSchema "All known schemas"
+// @router      /schemas [get]
+func SchemasGet(ctx *fiber.Ctx) error {
+	return ctx.JSON(samples.Schemas())
+}
@@ -0,0 +1,38 @@
+package api
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/openrfsense/backend/nats"
+	"github.com/openrfsense/backend/orgs"
+	"github.com/openrfsense/backend/samples"
+)
+
+// Get sample storage statistics
+//
+// @summary     Get sample storage statistics
+// @description Returns the backend used to store samples (selected by backend.storage), the number of stored samples and the space they take, as well as the space reclaimed by garbage collection since the backend started. Statistics cover the samples of all organizations, so only users of the default organization can read them.
+// @tags        administration
+// @security    BasicAuth
+// @produce     json
+// @success     200 {object} models.StoreStats "Statistics of the sample store"
+// @failure     403 "The user does not belong to the default organization"
+// @failure     500 "The sample store could not be read"
+// @router      /storage [get]
+func StorageGet(ctx *fiber.Ctx) error {
+	if orgs.Current(ctx) != nats.DefaultOrganization {
+		return fiber.NewError(fiber.StatusForbidden, "storage statistics are only available to the default organization")
+	}
+
+	store := samples.Store()
+	if store == nil {
+		return samples.ErrNoStore
+	}
+
+	stats, err := store.Stats(ctx.UserContext())
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(stats)
+}
@@ -14,8 +14,12 @@ import (
 	"github.com/openrfsense/backend/config"
 	"github.com/openrfsense/backend/database"
 	"github.com/openrfsense/backend/docs"
+	"github.com/openrfsense/backend/jobs"
 	"github.com/openrfsense/backend/nats"
+	"github.com/openrfsense/backend/nodes"
+	"github.com/openrfsense/backend/orgs"
 	"github.com/openrfsense/backend/samples"
+	"github.com/openrfsense/backend/tracing"
 	"github.com/openrfsense/backend/ui"
 	"github.com/openrfsense/common/logging"
 
@@ -52,18 +56,45 @@ func main() {
 		log.Fatal(err)
 	}
 
+	log.Info("Setting up tracing")
+	shutdownTracing, err := tracing.Init(ctx, konfig, version)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	log.Info("Connecting to database")
 	err = database.Init(konfig)
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	log.Info("Opening sample store")
+	err = samples.OpenStore(konfig)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	log.Info("Starting NATS server")
 	err = nats.Start(konfig)
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	log.Info("Loading organizations")
+	err = orgs.Init(ctx, konfig)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Info("Authorizing enrolled nodes")
+	err = nodes.Init(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Info("Starting measurement job dispatcher")
+	jobs.Start(ctx)
+
 	router := fiber.New(fiber.Config{
 		AppName:               "openrfsense-backend",
 		DisableStartupMessage: true,
@@ -78,7 +109,7 @@ func main() {
 
 	// Initialize UI (templated web pages)
 	log.Info("Starting UI")
-	ui.Init(router)
+	ui.Init(konfig, router)
 
 	log.Info("Starting measurement collector")
 	err = samples.StartCollector(ctx, konfig)
@@ -86,6 +117,24 @@ func main() {
 		log.Fatal(err)
 	}
 
+	log.Info("Enforcing sample retention")
+	err = samples.StartRetention(ctx, konfig)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Info("Starting PSD rollups")
+	err = samples.StartRollups(ctx, konfig)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Info("Starting PSD processing of raw campaigns")
+	err = samples.StartDerivations(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	log.Info("Starting WebSocket streaming handler")
 	samples.StartWebsocket(ctx, konfig, router)
 
@@ -101,5 +150,11 @@ func main() {
 	log.Info("Shutting down")
 	_ = router.Shutdown()
 	nats.Disconnect()
+	if err := samples.CloseStore(); err != nil {
+		log.Error(err)
+	}
 	database.Close()
+	if err := shutdownTracing(context.Background()); err != nil {
+		log.Error(err)
+	}
 }
@@ -9,8 +9,8 @@ import (
 	"net"
 	"sync"
 
-	"github.com/openrfsense/backend/database"
 	"github.com/openrfsense/backend/database/models"
+	"github.com/openrfsense/backend/samples"
 	"github.com/openrfsense/common/logging"
 
 	"github.com/hamba/avro/v2"
@@ -103,7 +103,7 @@ func accept(errChan chan<- error) {
 }
 
 // Simple TCP request handler which deserializes raw Avro packates into
-// database.Sample objects and saves them to the database.
+// database.Sample objects and saves them to the sample store.
 func handleRequest(conn net.Conn, wg *sync.WaitGroup, errChan chan<- error) {
 	defer wg.Done()
 
@@ -119,57 +119,19 @@ func handleRequest(conn net.Conn, wg *sync.WaitGroup, errChan chan<- error) {
 		errChan <- err
 	}
 
-	sql, args, _ := database.Instance().
-		Insert("samples").
-		Columns(
-			"sensor_id",
-			"campaign_id",
-			"sample_type",
-			"time_seconds",
-			"time_microseconds",
-			"config_antenna_gain",
-			"config_antenna_id",
-			"config_center_freq",
-			"config_est_noise_floor",
-			"config_frequency_correction_factor",
-			"config_frontend_gain",
-			"config_hopping_strategy",
-			"config_iq_balance_calibration",
-			"config_rf_sync",
-			"config_sampling_rate",
-			"config_sig_strength_calibration",
-			"config_system_sync",
-			"config_extra_conf",
-			"data",
-		).Values(
-		s.SensorId,
-		s.CampaignId,
-		s.SampleType,
-		s.SampleTime.Seconds,
-		s.SampleTime.Microseconds,
-		s.SampleConfig.AntennaGain,
-		s.SampleConfig.AntennaId,
-		s.SampleConfig.CenterFreq,
-		s.SampleConfig.EstNoiseFloor,
-		s.SampleConfig.FrequencyCorrectionFactor,
-		s.SampleConfig.FrontendGain,
-		s.SampleConfig.HoppingStrategy,
-		s.SampleConfig.IqBalanceCalibration,
-		s.SampleConfig.RfSync,
-		s.SampleConfig.SamplingRate,
-		s.SampleConfig.SigStrengthCalibration,
-		s.SampleConfig.SystemSync,
-		s.SampleConfig.ExtraConf,
-		s.Data,
-	).ToSql()
-	log.Debug(sql)
-	log.Debug(args)
-
-	err = database.Do(
-		context.Background(),
-		sql,
-		args...,
-	)
+	b, err := samples.Encode(s)
+	if err != nil {
+		errChan <- err
+		return
+	}
+
+	store := samples.Store()
+	if store == nil {
+		errChan <- samples.ErrNoStore
+		return
+	}
+
+	err = store.Append(context.Background(), b, s)
 	if err != nil {
 		errChan <- err
 	}
@@ -3,6 +3,7 @@ package config
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/knadh/koanf"
 	"github.com/knadh/koanf/parsers/yaml"
@@ -19,7 +20,30 @@ type Backend struct {
 }
 
 type Collector struct {
-	Port int `yaml:"port"`
+	Port         int           `yaml:"port"`
+	MaxFrameSize int           `yaml:"maxframesize"`
+	AckWindow    int           `yaml:"ackwindow"`
+	Tolerance    time.Duration `yaml:"tolerance"`
+	TLS          CollectorTLS  `yaml:"tls"`
+	UDP          CollectorUDP  `yaml:"udp"`
+	NATS         CollectorNATS `yaml:"nats"`
+	Schemas      string        `yaml:"schemas"`
+}
+
+type CollectorUDP struct {
+	Port            int  `yaml:"port"`
+	Unauthenticated bool `yaml:"unauthenticated"`
+}
+
+type CollectorNATS struct {
+	Enabled         bool `yaml:"enabled"`
+	Unauthenticated bool `yaml:"unauthenticated"`
+}
+
+type CollectorTLS struct {
+	Cert     string `yaml:"cert"`
+	Key      string `yaml:"key"`
+	ClientCA string `yaml:"clientca"`
 }
 
 type Postgres struct {
@@ -32,10 +56,46 @@ type Postgres struct {
 }
 
 type NATS struct {
-	Protocol string `yaml:"protocol"`
-	Host     string `yaml:"host"`
-	Port     int    `yaml:"port"`
-	Token    string `yaml:"token"`
+	Protocol  string        `yaml:"protocol"`
+	Host      string        `yaml:"host"`
+	Port      int           `yaml:"port"`
+	Token     string        `yaml:"token"`
+	Name      string        `yaml:"name"`
+	Cluster   NATSCluster   `yaml:"cluster"`
+	Leafnodes NATSLeafnodes `yaml:"leafnodes"`
+}
+
+type NATSCluster struct {
+	Name     string   `yaml:"name"`
+	Port     int      `yaml:"port"`
+	Routes   []string `yaml:"routes"`
+	Username string   `yaml:"username"`
+	Password string   `yaml:"password"`
+}
+
+type NATSLeafnodes struct {
+	Port     int      `yaml:"port"`
+	Username string   `yaml:"username"`
+	Password string   `yaml:"password"`
+	Remotes  []string `yaml:"remotes"`
+}
+
+type Tracing struct {
+	Exporter string `yaml:"exporter"`
+	Endpoint string `yaml:"endpoint"`
+	Insecure bool   `yaml:"insecure"`
+}
+
+type Retention struct {
+	Default  time.Duration            `yaml:"default"`
+	Types    map[string]time.Duration `yaml:"types"`
+	Interval time.Duration            `yaml:"interval"`
+	GCRatio  float64                  `yaml:"gcratio"`
+}
+
+type Rollups struct {
+	Interval time.Duration `yaml:"interval"`
+	Lag      time.Duration `yaml:"lag"`
 }
 
 type BackendConfig struct {
@@ -43,6 +103,9 @@ type BackendConfig struct {
 	Collector `yaml:"collector"`
 	Postgres  `yaml:"postgres"`
 	NATS      `yaml:"nats"`
+	Tracing   `yaml:"tracing"`
+	Retention `yaml:"retention"`
+	Rollups   `yaml:"rollups"`
 }
 
 var defaultConfig = BackendConfig{
@@ -52,7 +115,10 @@ var defaultConfig = BackendConfig{
 		Storage: "/samples",
 	},
 	Collector: Collector{
-		Port: 2022,
+		Port:         2022,
+		MaxFrameSize: 16 << 20,
+		AckWindow:    16,
+		Tolerance:    time.Minute,
 	},
 	Postgres: Postgres{
 		Host:         "localhost",
@@ -65,6 +131,14 @@ var defaultConfig = BackendConfig{
 		Protocol: "tcp",
 		Port:     4222,
 	},
+	Retention: Retention{
+		Interval: 10 * time.Minute,
+		GCRatio:  0.5,
+	},
+	Rollups: Rollups{
+		Interval: time.Minute,
+		Lag:      time.Minute,
+	},
 }
 
 var konf *koanf.Koanf
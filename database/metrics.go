@@ -0,0 +1,78 @@
+package database
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/openrfsense/backend/metrics"
+)
+
+var _ prometheus.Collector = poolCollector{}
+
+// Type poolCollector exports the statistics of the connection pool as metrics.
+type poolCollector struct{}
+
+var (
+	poolAcquiredConns = prometheus.NewDesc(
+		metrics.Name("postgres", "acquired_connections"),
+		"Connections currently in use.", nil, nil,
+	)
+	poolIdleConns = prometheus.NewDesc(
+		metrics.Name("postgres", "idle_connections"),
+		"Idle connections in the pool.", nil, nil,
+	)
+	poolTotalConns = prometheus.NewDesc(
+		metrics.Name("postgres", "connections"),
+		"Connections in the pool, including those still being established.", nil, nil,
+	)
+	poolMaxConns = prometheus.NewDesc(
+		metrics.Name("postgres", "max_connections"),
+		"Maximum size of the pool.", nil, nil,
+	)
+	poolAcquires = prometheus.NewDesc(
+		metrics.Name("postgres", "acquires_total"),
+		"Connections acquired from the pool.", nil, nil,
+	)
+	poolEmptyAcquires = prometheus.NewDesc(
+		metrics.Name("postgres", "empty_acquires_total"),
+		"Acquires which had to wait for a connection because the pool was empty.", nil, nil,
+	)
+	poolCanceledAcquires = prometheus.NewDesc(
+		metrics.Name("postgres", "canceled_acquires_total"),
+		"Acquires canceled before a connection was available.", nil, nil,
+	)
+	poolAcquireDuration = prometheus.NewDesc(
+		metrics.Name("postgres", "acquire_duration_seconds_total"),
+		"Total time spent acquiring connections.", nil, nil,
+	)
+)
+
+func init() {
+	metrics.Registry.MustRegister(poolCollector{})
+}
+
+func (poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- poolAcquiredConns
+	ch <- poolIdleConns
+	ch <- poolTotalConns
+	ch <- poolMaxConns
+	ch <- poolAcquires
+	ch <- poolEmptyAcquires
+	ch <- poolCanceledAcquires
+	ch <- poolAcquireDuration
+}
+
+func (poolCollector) Collect(ch chan<- prometheus.Metric) {
+	if pg == nil || pg.Pool == nil {
+		return
+	}
+
+	stat := pg.Pool.Stat()
+	ch <- prometheus.MustNewConstMetric(poolAcquiredConns, prometheus.GaugeValue, float64(stat.AcquiredConns()))
+	ch <- prometheus.MustNewConstMetric(poolIdleConns, prometheus.GaugeValue, float64(stat.IdleConns()))
+	ch <- prometheus.MustNewConstMetric(poolTotalConns, prometheus.GaugeValue, float64(stat.TotalConns()))
+	ch <- prometheus.MustNewConstMetric(poolMaxConns, prometheus.GaugeValue, float64(stat.MaxConns()))
+	ch <- prometheus.MustNewConstMetric(poolAcquires, prometheus.CounterValue, float64(stat.AcquireCount()))
+	ch <- prometheus.MustNewConstMetric(poolEmptyAcquires, prometheus.CounterValue, float64(stat.EmptyAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(poolCanceledAcquires, prometheus.CounterValue, float64(stat.CanceledAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(poolAcquireDuration, prometheus.CounterValue, stat.AcquireDuration().Seconds())
+}
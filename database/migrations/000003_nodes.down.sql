@@ -0,0 +1,2 @@
+drop table if exists nodes;
+drop table if exists enrollment_codes;
\ No newline at end of file
@@ -0,0 +1,18 @@
+create table if not exists enrollment_codes (
+    "id" bigserial primary key,
+    "code_hash" text not null unique,
+    "expires_at" timestamp not null,
+    "used_at" timestamp,
+    "created_at" timestamp default now()
+);
+
+create table if not exists nodes (
+    "id" bigserial primary key,
+    "sensor_id" text not null unique,
+    "status" text not null default 'pending',
+    "code_hash" text not null,
+    "secret_hash" text,
+    "pending_secret" text,
+    "created_at" timestamp default now(),
+    "updated_at" timestamp default now()
+);
\ No newline at end of file
@@ -0,0 +1,4 @@
+alter table enrollment_codes drop column if exists "organization";
+alter table nodes drop column if exists "organization";
+alter table campaigns drop column if exists "organization";
+drop table if exists organizations;
\ No newline at end of file
@@ -0,0 +1,11 @@
+create table if not exists organizations (
+    "id" bigserial primary key,
+    "name" text not null unique,
+    "created_at" timestamp default now()
+);
+
+insert into organizations ("name") values ('default') on conflict do nothing;
+
+alter table campaigns add column if not exists "organization" text not null default 'default';
+alter table nodes add column if not exists "organization" text not null default 'default';
+alter table enrollment_codes add column if not exists "organization" text not null default 'default';
\ No newline at end of file
@@ -0,0 +1,14 @@
+create table if not exists jobs (
+    "id" bigserial primary key,
+    "job_id" text not null unique,
+    "organization" text not null,
+    "type" text not null,
+    "status" text not null,
+    "request" jsonb not null,
+    "sensors" jsonb not null,
+    "attempts" integer not null default 0,
+    "campaign_id" text,
+    "error" text,
+    "created_at" timestamp default now(),
+    "updated_at" timestamp default now()
+);
\ No newline at end of file
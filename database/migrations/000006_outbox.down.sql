@@ -0,0 +1,2 @@
+drop table if exists outbox;
+alter table campaigns drop column if exists "status";
\ No newline at end of file
@@ -0,0 +1,10 @@
+alter table campaigns add column if not exists "status" text not null default 'active';
+
+create table if not exists outbox (
+    "id" bigserial primary key,
+    "job_id" text not null references jobs ("job_id") on delete cascade,
+    "subject" text not null,
+    "reply" text not null,
+    "payload" jsonb not null,
+    "created_at" timestamp default now()
+);
\ No newline at end of file
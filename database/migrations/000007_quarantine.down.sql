@@ -0,0 +1 @@
+drop table if exists quarantine;
\ No newline at end of file
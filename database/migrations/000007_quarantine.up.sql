@@ -0,0 +1,12 @@
+create table if not exists quarantine (
+    "id" bigserial primary key,
+    "sensor_id" text not null,
+    "campaign_id" text not null,
+    "sample_type" text not null,
+    "reason" text not null,
+    "organization" text not null,
+    "data" bytea not null,
+    "created_at" timestamp default now()
+);
+
+create index if not exists quarantine_organization_idx on quarantine ("organization");
\ No newline at end of file
@@ -0,0 +1,2 @@
+alter table outbox drop column if exists "trace_context";
+alter table campaigns drop column if exists "trace_context";
\ No newline at end of file
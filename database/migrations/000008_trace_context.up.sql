@@ -0,0 +1,2 @@
+alter table campaigns add column if not exists "trace_context" jsonb not null default '{}';
+alter table outbox add column if not exists "trace_context" jsonb not null default '{}';
\ No newline at end of file
@@ -0,0 +1 @@
+drop index if exists samples_campaign_sensor_time_idx;
\ No newline at end of file
@@ -0,0 +1 @@
+create index if not exists samples_campaign_sensor_time_idx on samples ("campaign_id", "sensor_id", "time_seconds", "time_microseconds");
\ No newline at end of file
@@ -0,0 +1,2 @@
+drop table if exists rollup_progress;
+drop table if exists rollups;
\ No newline at end of file
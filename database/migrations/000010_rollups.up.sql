@@ -0,0 +1,19 @@
+create table if not exists rollups (
+    "sensor_id" text not null,
+    "campaign_id" text not null,
+    "resolution" text not null,
+    "start" timestamptz not null,
+    "center_freq" bigint not null,
+    "count" bigint[] not null,
+    "min" real[] not null,
+    "mean" real[] not null,
+    "max" real[] not null,
+    primary key ("campaign_id", "resolution", "sensor_id", "start", "center_freq")
+);
+
+create table if not exists rollup_progress (
+    "campaign_id" text not null,
+    "resolution" text not null,
+    "until" timestamptz not null,
+    primary key ("campaign_id", "resolution")
+);
\ No newline at end of file
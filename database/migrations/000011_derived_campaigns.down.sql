@@ -0,0 +1 @@
+alter table campaigns drop column if exists "derived_from";
\ No newline at end of file
@@ -0,0 +1 @@
+alter table campaigns add column if not exists "derived_from" text;
\ No newline at end of file
@@ -0,0 +1 @@
+alter table outbox drop column if exists "next_attempt_at";
\ No newline at end of file
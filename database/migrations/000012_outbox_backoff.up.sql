@@ -0,0 +1 @@
+alter table outbox add column if not exists "next_attempt_at" timestamp not null default now();
\ No newline at end of file
@@ -0,0 +1 @@
+drop table if exists rollup_stale;
\ No newline at end of file
@@ -0,0 +1,7 @@
+create table if not exists rollup_stale (
+    "campaign_id" text not null,
+    "sensor_id" text not null,
+    "start" timestamptz not null,
+    "marked_at" timestamptz not null default now(),
+    primary key ("campaign_id", "sensor_id", "start")
+);
\ No newline at end of file
@@ -6,6 +6,14 @@ import (
 	"github.com/lib/pq"
 )
 
+// Possible values for Campaign.Status
+const (
+	CampaignPending = "pending"
+	CampaignActive  = "active"
+	CampaignFailed  = "failed"
+	CampaignExpired = "expired"
+)
+
 // Type Campaign represents a measurement campaign which has been successfully launched
 // and stored in the database.
 type Campaign struct {
@@ -18,12 +26,28 @@ type Campaign struct {
 	// The type of measurements requested
 	Type string `json:"type"`
 
+	// Campaigns are pending until at least one sensor acknowledges the request, and failed
+	// if none ever does. Active campaigns expire once their samples are deleted according
+	// to the retention rules
+	Status string `json:"status"`
+
 	// The time at which the campaign is supposed to start
 	Begin time.Time `json:"begin"`
 
 	// The time at which the campaign will end
 	End time.Time `json:"end"`
 
+	// The organization which owns the campaign
+	Organization string `json:"organization"`
+
+	// The campaign whose samples this campaign was computed from, if it was not recorded
+	// by sensors
+	DerivedFrom *string `json:"derivedFrom,omitempty" db:"derived_from"`
+
+	// Trace context of the request which created the campaign, so that samples can be
+	// correlated with it
+	TraceContext map[string]string `json:"-" db:"trace_context"`
+
 	// Database-specific data
 	ID        uint      `json:"-"`
 	CreatedAt time.Time `json:"createdAt" db:"created_at"`
@@ -0,0 +1,74 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/openrfsense/common/stats"
+)
+
+// Possible values for Job.Status
+const (
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobPartial   = "partial"
+	JobFailed    = "failed"
+)
+
+// Possible values for SensorDispatch.Status
+const (
+	DispatchPending      = "pending"
+	DispatchAcknowledged = "acknowledged"
+	DispatchFailed       = "failed"
+)
+
+// Type Job tracks the asynchronous dispatch of a measurement request to the sensors
+// taking part in a campaign.
+type Job struct {
+	// The textual, random ID for the job
+	JobId string `json:"jobId" db:"job_id"`
+
+	// The type of measurements requested (PSD or IQ)
+	Type string `json:"type"`
+
+	// Overall status of the job (running, succeeded, partial, failed)
+	Status string `json:"status"`
+
+	// The original measurement request
+	Request json.RawMessage `json:"request" swaggertype:"object"`
+
+	// Dispatch progress for each sensor, by hardware ID
+	Sensors map[string]SensorDispatch `json:"sensors"`
+
+	// Number of dispatch attempts made so far
+	Attempts int `json:"attempts"`
+
+	// The campaign the request belongs to, which only lists acknowledged sensors
+	CampaignId *string `json:"campaignId,omitempty" db:"campaign_id"`
+
+	// Reason for the failure of the job, if any
+	Error *string `json:"error,omitempty"`
+
+	// The organization which owns the job
+	Organization string `json:"organization"`
+
+	// Database-specific data
+	ID        uint      `json:"-"`
+	CreatedAt time.Time `json:"createdAt" db:"created_at"`
+	UpdatedAt time.Time `json:"updatedAt" db:"updated_at"`
+}
+
+// Type SensorDispatch describes the dispatch progress of a job for a single sensor.
+type SensorDispatch struct {
+	// Dispatch status (pending, acknowledged, failed)
+	Status string `json:"status"`
+
+	// Number of times the request was sent to the sensor
+	Attempts int `json:"attempts"`
+
+	// The time at which the sensor acknowledged the request
+	AcknowledgedAt *time.Time `json:"acknowledgedAt,omitempty"`
+
+	// Statistics returned by the sensor along with its acknowledgement
+	Stats *stats.Stats `json:"stats,omitempty"`
+}
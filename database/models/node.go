@@ -0,0 +1,53 @@
+package models
+
+import (
+	"time"
+)
+
+// Possible values for Node.Status
+const (
+	NodePending  = "pending"
+	NodeApproved = "approved"
+	NodeRejected = "rejected"
+	NodeRevoked  = "revoked"
+)
+
+// Type Node represents a sensor which has gone through (or is going through) the
+// enrollment process.
+type Node struct {
+	// The unique hardware id of the sensor
+	SensorId string `json:"sensorId" db:"sensor_id"`
+
+	// Enrollment status (pending, approved, rejected, revoked)
+	Status string `json:"status"`
+
+	// The organization which owns the node
+	Organization string `json:"organization"`
+
+	// Database-specific data
+	ID            uint      `json:"-"`
+	CodeHash      string    `json:"-" db:"code_hash"`
+	SecretHash    *string   `json:"-" db:"secret_hash"`
+	PendingSecret *string   `json:"-" db:"pending_secret"`
+	CreatedAt     time.Time `json:"createdAt" db:"created_at"`
+	UpdatedAt     time.Time `json:"updatedAt" db:"updated_at"`
+}
+
+// Type NodeCredentials contains the NATS credentials issued to a node after its
+// enrollment request has been approved.
+type NodeCredentials struct {
+	// NATS username, always equal to the sensor hardware ID
+	Username string `json:"username"`
+
+	// NATS password, only ever returned once
+	Password string `json:"password"`
+}
+
+// Type EnrollmentRequest is sent by a sensor which wants to join the network.
+type EnrollmentRequest struct {
+	// The unique hardware id of the sensor
+	SensorId string `json:"sensorId"`
+
+	// One-time enrollment code handed out by an administrator
+	Code string `json:"code"`
+}
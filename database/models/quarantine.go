@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+)
+
+// Type QuarantinedSample is a sample which was rejected by the collector because it
+// did not match any campaign, along with the reason it was rejected.
+type QuarantinedSample struct {
+	// Unique identifier of the quarantined sample
+	ID uint `json:"id"`
+
+	// The sensor which the sample claims to come from
+	SensorId string `json:"sensorId" db:"sensor_id"`
+
+	// The campaign which the sample claims to belong to
+	CampaignId string `json:"campaignId" db:"campaign_id"`
+
+	// Sample type string (IQ, PSD, DEC)
+	SampleType string `json:"sampleType" db:"sample_type"`
+
+	// Why the sample was rejected
+	Reason string `json:"reason"`
+
+	// The organization of the campaign or, if it does not exist, of the sensor
+	Organization string `json:"organization"`
+
+	// Database-specific data
+	Data      []byte    `json:"-"`
+	CreatedAt time.Time `json:"createdAt" db:"created_at"`
+}
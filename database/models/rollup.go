@@ -0,0 +1,46 @@
+package models
+
+import (
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Type Rollup aggregates all PSD frames recorded by a sensor at the same center frequency
+// during a fixed time bucket.
+type Rollup struct {
+	// The unique hardware id of the sensor
+	SensorId string `json:"sensorId" db:"sensor_id"`
+
+	// Campaign the aggregated frames belong to
+	CampaignId string `json:"campaignId" db:"campaign_id"`
+
+	// Length of the bucket (1m, 1h or 1d)
+	Resolution string `json:"resolution"`
+
+	// Beginning of the bucket, aligned to its length in UTC
+	Start time.Time `json:"start"`
+
+	// Center frequency in Hz of the aggregated frames
+	CenterFreq int64 `json:"centerFreq" db:"center_freq"`
+
+	// Number of frames which had a value for each bin
+	Count pq.Int64Array `json:"count"`
+
+	// Minimum value of each bin
+	Min pq.Float32Array `json:"min"`
+
+	// Mean value of each bin
+	Mean pq.Float32Array `json:"mean"`
+
+	// Maximum value of each bin
+	Max pq.Float32Array `json:"max"`
+}
+
+// Type RollupSeries is the list of rollups returned for a query, all with the same resolution.
+type RollupSeries struct {
+	// Resolution of the rollups, either requested or chosen for the queried time range
+	Resolution string `json:"resolution"`
+
+	Rollups []Rollup `json:"rollups"`
+}
@@ -23,11 +23,11 @@ type Sample struct {
 	// Sensor configuration for the recorded data set
 	SampleConfig SampleConfig `json:"config" avro:"config" db:"embedded"`
 
-	// Sample loss rate in percent
-	// LossRate *float64 `json:"lossRate,omitempty" avro:"lossRate"`
+	// Sample loss rate in percent, only sent by sensors using a newer schema
+	LossRate *float64 `json:"lossRate,omitempty" avro:"lossRate" db:"-"`
 
-	// Method used to obfuscate IQ spectrum data
-	// Obfuscation *string `json:"obfuscation,omitempty" avro:"obfuscation"`
+	// Method used to obfuscate IQ spectrum data, only sent by sensors using a newer schema
+	Obfuscation *string `json:"obfuscation,omitempty" avro:"obfuscation" db:"-"`
 
 	// Actual measurement data. Unit depends on measurement type
 	Data pq.Float32Array `json:"data" avro:"data"`
@@ -87,3 +87,51 @@ type SampleConfig struct {
 	// Extra configuration for arbitrary data
 	ExtraConf map[string]interface{} `json:"extraConf,omitempty" avro:"extraConf" db:"config_extra_conf"`
 }
+
+// Possible values for IngestedSample.Status
+const (
+	IngestAccepted    = "accepted"
+	IngestQuarantined = "quarantined"
+	IngestRejected    = "rejected"
+)
+
+// Type IngestResult reports what happened to each sample of a batch sent to the
+// ingestion endpoint.
+type IngestResult struct {
+	// Number of samples which were stored
+	Accepted int `json:"accepted"`
+
+	// Number of samples which were quarantined or could not be read
+	Rejected int `json:"rejected"`
+
+	// Outcome for each sample, in the same order as the batch
+	Items []IngestedSample `json:"items"`
+}
+
+// Type IngestedSample is the outcome of the ingestion of a single sample.
+type IngestedSample struct {
+	// One of accepted, quarantined, rejected
+	Status string `json:"status"`
+
+	// Why the sample was not accepted
+	Reason string `json:"reason,omitempty"`
+}
+
+// Type StoreStats describes the contents of the sample store.
+type StoreStats struct {
+	// Type of the store (badger, files, postgres)
+	Backend string `json:"backend"`
+
+	// Number of stored samples
+	Samples int64 `json:"samples"`
+
+	// Space taken by the stored samples in bytes, including any overhead of the store
+	Bytes int64 `json:"bytes"`
+
+	// Space reclaimed by garbage collection since the backend started, in bytes (only
+	// for stores which need garbage collection)
+	Reclaimed int64 `json:"reclaimed"`
+
+	// Time of the last garbage collection, if any
+	LastCollected *time.Time `json:"lastCollected,omitempty"`
+}
@@ -0,0 +1,17 @@
+package models
+
+import (
+	"encoding/json"
+)
+
+// Type SampleSchema is an Avro schema which sensors can use to write samples.
+type SampleSchema struct {
+	// CRC-64-AVRO fingerprint of the schema, as a hexadecimal string
+	Fingerprint string `json:"fingerprint"`
+
+	// Whether this is the schema all samples are resolved to
+	Current bool `json:"current"`
+
+	// The schema itself, in canonical form
+	Schema json.RawMessage `json:"schema" swaggertype:"object"`
+}
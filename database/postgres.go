@@ -51,6 +51,7 @@ func Init(config *koanf.Koanf) error {
 		return err
 	}
 	poolConfig.MaxConns = int32(pg.maxPoolSize)
+	poolConfig.ConnConfig.Tracer = queryTracer{}
 
 	ticker := time.NewTicker(pg.connTimeout)
 	defer ticker.Stop()
@@ -1,5 +1,4 @@
-// Package docs GENERATED BY SWAG; DO NOT EDIT
-// This file was generated by swaggo/swag
+// Code generated by swaggo/swag. DO NOT EDIT
 package docs
 
 import "github.com/swaggo/swag"
@@ -30,7 +29,7 @@ const docTemplate = `{
                         "BasicAuth": []
                     }
                 ],
-                "description": "Sends an aggregated measurement request to the nodes specified in ` + "`" + `sensors` + "`" + ` and returns a list of ` + "`" + `stats.Stats` + "`" + ` objects for all sensors taking part in the campaign. Will time out in ` + "`" + `300ms` + "`" + ` if any sensor does not respond.",
+                "description": "Creates a job which sends an aggregated measurement request to the nodes specified in ` + "`" + `sensors` + "`" + ` in the background, retrying for sensors which do not acknowledge it. The campaign is created right away with the ` + "`" + `pending` + "`" + ` status, and becomes ` + "`" + `active` + "`" + ` once the first sensor acknowledges the request (or ` + "`" + `failed` + "`" + ` if none does). Job progress can be followed on ` + "`" + `/jobs/{job_id}` + "`" + ` or on the ` + "`" + `/events` + "`" + ` stream.",
                 "consumes": [
                     "application/json"
                 ],
@@ -40,7 +39,7 @@ const docTemplate = `{
                 "tags": [
                     "measurement"
                 ],
-                "summary": "Get an aggregated spectrum measurement from a list of nodes",
+                "summary": "Start an aggregated spectrum measurement on a list of nodes",
                 "parameters": [
                     {
                         "description": "Measurement request object",
@@ -53,23 +52,23 @@ const docTemplate = `{
                     }
                 ],
                 "responses": {
-                    "201": {
-                        "description": "Bare statistics for all nodes in the measurement campaign. Will always include sensor status information.",
+                    "202": {
+                        "description": "The new job, with per-sensor dispatch status",
                         "schema": {
-                            "type": "array",
-                            "items": {
-                                "$ref": "#/definitions/stats.Stats"
-                            }
+                            "$ref": "#/definitions/models.Job"
                         },
                         "headers": {
                             "Location": {
                                 "type": "string",
-                                "description": "Location of the new campaign object."
+                                "description": "Location of the new job object."
                             }
                         }
                     },
+                    "400": {
+                        "description": "Malformed request"
+                    },
                     "500": {
-                        "description": "When the internal timeout for information retrieval expires"
+                        "description": "Generally a database error"
                     }
                 }
             }
@@ -81,7 +80,7 @@ const docTemplate = `{
                         "BasicAuth": []
                     }
                 ],
-                "description": "Returns a list of campaigns that were successfully started. Will return all campaigns unless either of the query parameters is set.",
+                "description": "Returns a list of campaigns that were successfully started by the organization of the user. Will return all campaigns unless either of the query parameters is set.",
                 "produces": [
                     "application/json"
                 ],
@@ -119,6 +118,451 @@ const docTemplate = `{
                 }
             }
         },
+        "/campaigns/{campaignId}/psd": {
+            "post": {
+                "security": [
+                    {
+                        "BasicAuth": []
+                    }
+                ],
+                "description": "Creates a PSD campaign derived from a raw (IQ) campaign, with the same sensors, begin and end, and a job which computes its samples from the IQ samples in the background with Welch's method: the IQ samples of each record are split into segments of ` + "`" + `fftSize` + "`" + ` samples (a power of two, 1024 by default) overlapping by ` + "`" + `overlap` + "`" + ` (0.5 by default), multiplied by the ` + "`" + `window` + "`" + ` function (` + "`" + `rectangular` + "`" + `, ` + "`" + `hann` + "`" + ` by default, ` + "`" + `hamming` + "`" + ` or ` + "`" + `blackman` + "`" + `) and transformed, and the power of each bin is averaged. The frequency correction factor of each record is applied to the IQ samples and its antenna gain is subtracted from the result, in dB/Hz. The derived campaign lists the original campaign in ` + "`" + `derivedFrom` + "`" + `, and becomes active once the job completes. Job progress can be followed on ` + "`" + `/jobs/{job_id}` + "`" + ` or on the ` + "`" + `/events` + "`" + ` stream.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "measurement"
+                ],
+                "summary": "Compute the PSD of a raw campaign",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Raw campaign to compute the PSD of",
+                        "name": "campaignId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Parameters of Welch's method",
+                        "name": "config",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/stream.WelchConfig"
+                        }
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "The new job, with the progress of each sensor",
+                        "schema": {
+                            "$ref": "#/definitions/models.Job"
+                        },
+                        "headers": {
+                            "Location": {
+                                "type": "string",
+                                "description": "Location of the new job object."
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Malformed request, or the campaign is not a raw campaign"
+                    },
+                    "404": {
+                        "description": "No such campaign"
+                    },
+                    "500": {
+                        "description": "Generally a database error"
+                    }
+                }
+            }
+        },
+        "/campaigns/{campaignId}/rollups": {
+            "get": {
+                "security": [
+                    {
+                        "BasicAuth": []
+                    }
+                ],
+                "description": "Returns the PSD frames recorded during a campaign aggregated into fixed time buckets of 1 minute, 1 hour or 1 day, with the minimum, mean and maximum of each bin and the number of frames it aggregates. Frames are aggregated separately for each sensor and center frequency. Unless a resolution is requested, the finest resolution which covers the requested time range (or the whole campaign) with at most ` + "`" + `limit` + "`" + ` buckets is used. Rollups are kept after the samples of the campaign expire.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "data"
+                ],
+                "summary": "Get PSD rollups",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Campaign which the rollups belong to",
+                        "name": "campaignId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Sensor which the rollups belong to (all sensors of the campaign if missing)",
+                        "name": "sensorId",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Rollups returned will start at or later than this date (must be in ISO 8601/RFC 3339)",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Rollups returned will start strictly before this date (must be in ISO 8601/RFC 3339)",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Length of the buckets (1m, 1h or 1d)",
+                        "name": "resolution",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Maximum number of rollups returned (1000 by default)",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "All rollups which respect the given conditions",
+                        "schema": {
+                            "$ref": "#/definitions/models.RollupSeries"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid parameters"
+                    },
+                    "404": {
+                        "description": "No such campaign"
+                    },
+                    "500": {
+                        "description": "Generally a database error"
+                    }
+                }
+            }
+        },
+        "/enroll": {
+            "post": {
+                "description": "Creates a pending enrollment request for a new sensor, which has to present a valid one-time enrollment code. Does not require authentication.",
+                "consumes": [
+                    "application/json"
+                ],
+                "tags": [
+                    "enrollment"
+                ],
+                "summary": "Request enrollment for a sensor",
+                "parameters": [
+                    {
+                        "description": "Enrollment request object",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.EnrollmentRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "The enrollment request is now pending approval"
+                    },
+                    "400": {
+                        "description": "Malformed request"
+                    },
+                    "403": {
+                        "description": "The enrollment code is invalid, expired or already used"
+                    },
+                    "409": {
+                        "description": "The sensor is already enrolled or has a pending request"
+                    }
+                }
+            }
+        },
+        "/enroll/{sensor_id}": {
+            "get": {
+                "description": "Returns the NATS credentials issued to a sensor once its enrollment request has been approved. The enrollment code used for the request must be sent in the ` + "`" + `X-Enrollment-Code` + "`" + ` header. Credentials can only be retrieved once. Does not require authentication.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "enrollment"
+                ],
+                "summary": "Retrieve node credentials",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Node hardware ID",
+                        "name": "sensor_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Enrollment code used for the request",
+                        "name": "X-Enrollment-Code",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "NATS credentials for the node",
+                        "schema": {
+                            "$ref": "#/definitions/models.NodeCredentials"
+                        }
+                    },
+                    "403": {
+                        "description": "The enrollment code does not match"
+                    },
+                    "404": {
+                        "description": "No such enrollment request"
+                    },
+                    "409": {
+                        "description": "The request has not been approved yet, or the credentials were already retrieved"
+                    }
+                }
+            }
+        },
+        "/enrollments": {
+            "get": {
+                "security": [
+                    {
+                        "BasicAuth": []
+                    }
+                ],
+                "description": "Returns all enrolled nodes and enrollment requests in the organization of the user, optionally filtered by status.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "enrollment"
+                ],
+                "summary": "List enrollment requests",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "One of pending, approved, rejected, revoked",
+                        "name": "status",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "All nodes matching the given status",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.Node"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Generally a database error"
+                    }
+                }
+            }
+        },
+        "/enrollments/codes": {
+            "post": {
+                "security": [
+                    {
+                        "BasicAuth": []
+                    }
+                ],
+                "description": "Generates a new one-time enrollment code for the organization of the user, valid for 24 hours. The code is only shown once.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "enrollment"
+                ],
+                "summary": "Generate an enrollment code",
+                "responses": {
+                    "201": {
+                        "description": "The new enrollment code",
+                        "schema": {
+                            "$ref": "#/definitions/api.enrollmentCode"
+                        }
+                    },
+                    "500": {
+                        "description": "Generally a database error"
+                    }
+                }
+            }
+        },
+        "/enrollments/{sensor_id}/approve": {
+            "post": {
+                "security": [
+                    {
+                        "BasicAuth": []
+                    }
+                ],
+                "description": "Approves a pending enrollment request and issues node-specific NATS credentials.",
+                "tags": [
+                    "enrollment"
+                ],
+                "summary": "Approve an enrollment request",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Node hardware ID",
+                        "name": "sensor_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "The node has been approved"
+                    },
+                    "409": {
+                        "description": "The node has no pending enrollment request"
+                    }
+                }
+            }
+        },
+        "/enrollments/{sensor_id}/reject": {
+            "post": {
+                "security": [
+                    {
+                        "BasicAuth": []
+                    }
+                ],
+                "description": "Rejects a pending enrollment request.",
+                "tags": [
+                    "enrollment"
+                ],
+                "summary": "Reject an enrollment request",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Node hardware ID",
+                        "name": "sensor_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "The node has been rejected"
+                    },
+                    "409": {
+                        "description": "The node has no pending enrollment request"
+                    }
+                }
+            }
+        },
+        "/events": {
+            "get": {
+                "security": [
+                    {
+                        "BasicAuth": []
+                    }
+                ],
+                "description": "Streams events for the organization of the user (such as measurement job updates) as server-sent events. The event name is the type of the event (e.g. ` + "`" + `job` + "`" + `) and its data is a JSON object.",
+                "produces": [
+                    "text/event-stream"
+                ],
+                "tags": [
+                    "events"
+                ],
+                "summary": "Stream backend events",
+                "responses": {
+                    "200": {
+                        "description": "A never-ending stream of events"
+                    }
+                }
+            }
+        },
+        "/ingest": {
+            "post": {
+                "security": [
+                    {
+                        "BasicAuth": []
+                    }
+                ],
+                "description": "Accepts a batch of samples from an enrolled sensor, authenticated with its NATS credentials. The batch can be an Avro object container file (` + "`" + `application/avro` + "`" + `), a sequence of Avro records each prefixed with its length as a big endian uint32 (` + "`" + `application/octet-stream` + "`" + `) or one JSON sample per line (` + "`" + `application/x-ndjson` + "`" + `), optionally compressed with ` + "`" + `Content-Encoding: gzip` + "`" + `. Samples go through the same validation as samples sent to the collector: samples belonging to other sensors are rejected, and samples which do not match their campaign are quarantined.",
+                "consumes": [
+                    "application/avro",
+                    "application/octet-stream",
+                    "application/x-ndjson"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "data"
+                ],
+                "summary": "Upload a batch of samples",
+                "responses": {
+                    "200": {
+                        "description": "Outcome for each sample in the batch",
+                        "schema": {
+                            "$ref": "#/definitions/models.IngestResult"
+                        }
+                    },
+                    "400": {
+                        "description": "The batch could not be read"
+                    },
+                    "401": {
+                        "description": "Not an enrolled sensor"
+                    },
+                    "415": {
+                        "description": "Unsupported content type"
+                    }
+                }
+            }
+        },
+        "/jobs/{job_id}": {
+            "get": {
+                "security": [
+                    {
+                        "BasicAuth": []
+                    }
+                ],
+                "description": "Returns the dispatch progress of a measurement job: the status of each sensor, acknowledgements, retries and the resulting campaign, if any.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "measurement"
+                ],
+                "summary": "Get a measurement job",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Job ID",
+                        "name": "job_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "The job object",
+                        "schema": {
+                            "$ref": "#/definitions/models.Job"
+                        }
+                    },
+                    "404": {
+                        "description": "No such job"
+                    },
+                    "500": {
+                        "description": "Generally a database error"
+                    }
+                }
+            }
+        },
         "/nodes": {
             "get": {
                 "security": [
@@ -126,7 +570,7 @@ const docTemplate = `{
                         "BasicAuth": []
                     }
                 ],
-                "description": "Returns a list of all connected nodes by their hardware ID. Will time out in ` + "`" + `300ms` + "`" + ` if any one of the nodes does not respond.",
+                "description": "Returns a list of all connected nodes belonging to the organization of the user by their hardware ID. Will time out in ` + "`" + `300ms` + "`" + ` if any one of the nodes does not respond.",
                 "produces": [
                     "application/json"
                 ],
@@ -185,6 +629,142 @@ const docTemplate = `{
                         "description": "When the internal timeout for information retrieval expires"
                     }
                 }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "BasicAuth": []
+                    }
+                ],
+                "description": "Revokes the credentials of an enrolled node and immediately disconnects it from the NATS server.",
+                "tags": [
+                    "enrollment"
+                ],
+                "summary": "Revoke a node",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Node hardware ID",
+                        "name": "sensor_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "The node has been revoked"
+                    },
+                    "404": {
+                        "description": "No approved node with the given ID"
+                    }
+                }
+            }
+        },
+        "/quarantine": {
+            "get": {
+                "security": [
+                    {
+                        "BasicAuth": []
+                    }
+                ],
+                "description": "Returns the samples rejected by the collector in the organization of the user, along with the reason they were rejected. Samples are quarantined if their campaign does not exist, if the sensor is not part of the campaign, if the sample type does not match the campaign type or if the sample was recorded outside of the campaign.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "data"
+                ],
+                "summary": "List quarantined samples",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Matches samples which claim to belong to this campaign",
+                        "name": "campaignId",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Matches samples which claim to come from this sensor",
+                        "name": "sensorId",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "All quarantined samples which match the given parameters",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.QuarantinedSample"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Generally a database error"
+                    }
+                }
+            }
+        },
+        "/quarantine/{id}": {
+            "delete": {
+                "security": [
+                    {
+                        "BasicAuth": []
+                    }
+                ],
+                "description": "Permanently deletes a sample from the quarantine.",
+                "tags": [
+                    "data"
+                ],
+                "summary": "Discard a quarantined sample",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Quarantined sample ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "The sample has been deleted"
+                    },
+                    "404": {
+                        "description": "No such quarantined sample"
+                    }
+                }
+            }
+        },
+        "/quarantine/{id}/release": {
+            "post": {
+                "security": [
+                    {
+                        "BasicAuth": []
+                    }
+                ],
+                "description": "Removes a sample from the quarantine and stores it along with the samples of the campaign it claims to belong to.",
+                "tags": [
+                    "data"
+                ],
+                "summary": "Release a quarantined sample",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Quarantined sample ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "The sample has been released"
+                    },
+                    "404": {
+                        "description": "No such quarantined sample"
+                    }
+                }
             }
         },
         "/raw": {
@@ -194,7 +774,7 @@ const docTemplate = `{
                         "BasicAuth": []
                     }
                 ],
-                "description": "Sends a raw measurement request to the nodes specified in ` + "`" + `sensors` + "`" + ` and returns a list of ` + "`" + `stats.Stats` + "`" + ` objects for all sensors taking part in the campaign. Will time out in ` + "`" + `300ms` + "`" + ` if any sensor does not respond.",
+                "description": "Creates a job which sends a raw measurement request to the nodes specified in ` + "`" + `sensors` + "`" + ` in the background, retrying for sensors which do not acknowledge it. The campaign is created right away with the ` + "`" + `pending` + "`" + ` status, and becomes ` + "`" + `active` + "`" + ` once the first sensor acknowledges the request (or ` + "`" + `failed` + "`" + ` if none does). Job progress can be followed on ` + "`" + `/jobs/{job_id}` + "`" + ` or on the ` + "`" + `/events` + "`" + ` stream.",
                 "consumes": [
                     "application/json"
                 ],
@@ -204,7 +784,7 @@ const docTemplate = `{
                 "tags": [
                     "measurement"
                 ],
-                "summary": "Get a raw spectrum measurement from a list of nodes",
+                "summary": "Start a raw spectrum measurement on a list of nodes",
                 "parameters": [
                     {
                         "description": "Measurement request object",
@@ -217,23 +797,23 @@ const docTemplate = `{
                     }
                 ],
                 "responses": {
-                    "201": {
-                        "description": "Bare statistics for all nodes in the measurement campaign. Will always include sensor status information.",
+                    "202": {
+                        "description": "The new job, with per-sensor dispatch status",
                         "schema": {
-                            "type": "array",
-                            "items": {
-                                "$ref": "#/definitions/stats.Stats"
-                            }
+                            "$ref": "#/definitions/models.Job"
                         },
                         "headers": {
                             "Location": {
                                 "type": "string",
-                                "description": "Location of the new campaign object."
+                                "description": "Location of the new job object."
                             }
                         }
                     },
+                    "400": {
+                        "description": "Malformed request"
+                    },
                     "500": {
-                        "description": "When the internal timeout for information retrieval expires"
+                        "description": "Generally a database error"
                     }
                 }
             }
@@ -256,49 +836,132 @@ const docTemplate = `{
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "Sensor which the samples belong to",
+                        "description": "Sensor which the samples belong to (all sensors of the campaign if missing)",
                         "name": "sensorId",
-                        "in": "path",
-                        "required": true
+                        "in": "query"
                     },
                     {
                         "type": "string",
                         "description": "Campaign which the samples belong to",
                         "name": "campaignId",
-                        "in": "path",
+                        "in": "query",
                         "required": true
                     },
                     {
                         "type": "string",
                         "description": "Samples returned will have been received strictly later than this date (must be in ISO 8601/RFC 3339)",
                         "name": "from",
-                        "in": "path"
+                        "in": "query"
                     },
                     {
                         "type": "string",
                         "description": "Samples returned will have been received strictly before this date (must be in ISO 8601/RFC 3339)",
                         "name": "to",
-                        "in": "path"
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Maximum number of samples returned (1000 by default)",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "All samples which respect the given conditions",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.Sample"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid parameters"
+                    },
+                    "404": {
+                        "description": "No such campaign"
+                    },
+                    "500": {
+                        "description": "Generally a database error"
+                    }
+                }
+            }
+        },
+        "/schemas": {
+            "get": {
+                "security": [
+                    {
+                        "BasicAuth": []
                     }
                 ],
+                "description": "Returns all Avro schemas which sensors can use to write samples, identified by their CRC-64-AVRO fingerprint. Samples in Avro single-object encoding are decoded with the schema matching their fingerprint and resolved to the current schema, while samples without a fingerprint are assumed to use the current schema.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "data"
+                ],
+                "summary": "List sample schemas",
                 "responses": {
                     "200": {
-                        "description": "All samples which respect the given conditions",
+                        "description": "All known schemas",
                         "schema": {
                             "type": "array",
                             "items": {
-                                "$ref": "#/definitions/models.Sample"
+                                "$ref": "#/definitions/models.SampleSchema"
                             }
                         }
+                    }
+                }
+            }
+        },
+        "/storage": {
+            "get": {
+                "security": [
+                    {
+                        "BasicAuth": []
+                    }
+                ],
+                "description": "Returns the backend used to store samples (selected by backend.storage), the number of stored samples and the space they take, as well as the space reclaimed by garbage collection since the backend started. Statistics cover the samples of all organizations, so only users of the default organization can read them.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "administration"
+                ],
+                "summary": "Get sample storage statistics",
+                "responses": {
+                    "200": {
+                        "description": "Statistics of the sample store",
+                        "schema": {
+                            "$ref": "#/definitions/models.StoreStats"
+                        }
+                    },
+                    "403": {
+                        "description": "The user does not belong to the default organization"
                     },
                     "500": {
-                        "description": "Generally a database error"
+                        "description": "The sample store could not be read"
                     }
                 }
             }
         }
     },
     "definitions": {
+        "api.enrollmentCode": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "description": "The one-time enrollment code",
+                    "type": "string"
+                },
+                "expiresAt": {
+                    "description": "The code cannot be used after this time",
+                    "type": "string"
+                }
+            }
+        },
         "models.Campaign": {
             "type": "object",
             "properties": {
@@ -313,10 +976,18 @@ const docTemplate = `{
                 "createdAt": {
                     "type": "string"
                 },
+                "derivedFrom": {
+                    "description": "The campaign whose samples this campaign was computed from, if it was not recorded\nby sensors",
+                    "type": "string"
+                },
                 "end": {
                     "description": "The time at which the campaign will end",
                     "type": "string"
                 },
+                "organization": {
+                    "description": "The organization which owns the campaign",
+                    "type": "string"
+                },
                 "sensors": {
                     "description": "The list of sensor partaking in the campaign",
                     "type": "array",
@@ -324,12 +995,248 @@ const docTemplate = `{
                         "type": "string"
                     }
                 },
+                "status": {
+                    "description": "Campaigns are pending until at least one sensor acknowledges the request, and failed\nif none ever does. Active campaigns expire once their samples are deleted according\nto the retention rules",
+                    "type": "string"
+                },
                 "type": {
                     "description": "The type of measurements requested",
                     "type": "string"
                 }
             }
         },
+        "models.EnrollmentRequest": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "description": "One-time enrollment code handed out by an administrator",
+                    "type": "string"
+                },
+                "sensorId": {
+                    "description": "The unique hardware id of the sensor",
+                    "type": "string"
+                }
+            }
+        },
+        "models.IngestResult": {
+            "type": "object",
+            "properties": {
+                "accepted": {
+                    "description": "Number of samples which were stored",
+                    "type": "integer"
+                },
+                "items": {
+                    "description": "Outcome for each sample, in the same order as the batch",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.IngestedSample"
+                    }
+                },
+                "rejected": {
+                    "description": "Number of samples which were quarantined or could not be read",
+                    "type": "integer"
+                }
+            }
+        },
+        "models.IngestedSample": {
+            "type": "object",
+            "properties": {
+                "reason": {
+                    "description": "Why the sample was not accepted",
+                    "type": "string"
+                },
+                "status": {
+                    "description": "One of accepted, quarantined, rejected",
+                    "type": "string"
+                }
+            }
+        },
+        "models.Job": {
+            "type": "object",
+            "properties": {
+                "attempts": {
+                    "description": "Number of dispatch attempts made so far",
+                    "type": "integer"
+                },
+                "campaignId": {
+                    "description": "The campaign the request belongs to, which only lists acknowledged sensors",
+                    "type": "string"
+                },
+                "createdAt": {
+                    "type": "string"
+                },
+                "error": {
+                    "description": "Reason for the failure of the job, if any",
+                    "type": "string"
+                },
+                "jobId": {
+                    "description": "The textual, random ID for the job",
+                    "type": "string"
+                },
+                "organization": {
+                    "description": "The organization which owns the job",
+                    "type": "string"
+                },
+                "request": {
+                    "description": "The original measurement request",
+                    "type": "object"
+                },
+                "sensors": {
+                    "description": "Dispatch progress for each sensor, by hardware ID",
+                    "type": "object",
+                    "additionalProperties": {
+                        "$ref": "#/definitions/models.SensorDispatch"
+                    }
+                },
+                "status": {
+                    "description": "Overall status of the job (running, succeeded, partial, failed)",
+                    "type": "string"
+                },
+                "type": {
+                    "description": "The type of measurements requested (PSD or IQ)",
+                    "type": "string"
+                },
+                "updatedAt": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.Node": {
+            "type": "object",
+            "properties": {
+                "createdAt": {
+                    "type": "string"
+                },
+                "organization": {
+                    "description": "The organization which owns the node",
+                    "type": "string"
+                },
+                "sensorId": {
+                    "description": "The unique hardware id of the sensor",
+                    "type": "string"
+                },
+                "status": {
+                    "description": "Enrollment status (pending, approved, rejected, revoked)",
+                    "type": "string"
+                },
+                "updatedAt": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.NodeCredentials": {
+            "type": "object",
+            "properties": {
+                "password": {
+                    "description": "NATS password, only ever returned once",
+                    "type": "string"
+                },
+                "username": {
+                    "description": "NATS username, always equal to the sensor hardware ID",
+                    "type": "string"
+                }
+            }
+        },
+        "models.QuarantinedSample": {
+            "type": "object",
+            "properties": {
+                "campaignId": {
+                    "description": "The campaign which the sample claims to belong to",
+                    "type": "string"
+                },
+                "createdAt": {
+                    "type": "string"
+                },
+                "id": {
+                    "description": "Unique identifier of the quarantined sample",
+                    "type": "integer"
+                },
+                "organization": {
+                    "description": "The organization of the campaign or, if it does not exist, of the sensor",
+                    "type": "string"
+                },
+                "reason": {
+                    "description": "Why the sample was rejected",
+                    "type": "string"
+                },
+                "sampleType": {
+                    "description": "Sample type string (IQ, PSD, DEC)",
+                    "type": "string"
+                },
+                "sensorId": {
+                    "description": "The sensor which the sample claims to come from",
+                    "type": "string"
+                }
+            }
+        },
+        "models.Rollup": {
+            "type": "object",
+            "properties": {
+                "campaignId": {
+                    "description": "Campaign the aggregated frames belong to",
+                    "type": "string"
+                },
+                "centerFreq": {
+                    "description": "Center frequency in Hz of the aggregated frames",
+                    "type": "integer"
+                },
+                "count": {
+                    "description": "Number of frames which had a value for each bin",
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                },
+                "max": {
+                    "description": "Maximum value of each bin",
+                    "type": "array",
+                    "items": {
+                        "type": "number"
+                    }
+                },
+                "mean": {
+                    "description": "Mean value of each bin",
+                    "type": "array",
+                    "items": {
+                        "type": "number"
+                    }
+                },
+                "min": {
+                    "description": "Minimum value of each bin",
+                    "type": "array",
+                    "items": {
+                        "type": "number"
+                    }
+                },
+                "resolution": {
+                    "description": "Length of the bucket (1m, 1h or 1d)",
+                    "type": "string"
+                },
+                "sensorId": {
+                    "description": "The unique hardware id of the sensor",
+                    "type": "string"
+                },
+                "start": {
+                    "description": "Beginning of the bucket, aligned to its length in UTC",
+                    "type": "string"
+                }
+            }
+        },
+        "models.RollupSeries": {
+            "type": "object",
+            "properties": {
+                "resolution": {
+                    "description": "Resolution of the rollups, either requested or chosen for the queried time range",
+                    "type": "string"
+                },
+                "rollups": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.Rollup"
+                    }
+                }
+            }
+        },
         "models.Sample": {
             "type": "object",
             "properties": {
@@ -339,7 +1246,11 @@ const docTemplate = `{
                 },
                 "config": {
                     "description": "Sensor configuration for the recorded data set",
-                    "$ref": "#/definitions/models.SampleConfig"
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/models.SampleConfig"
+                        }
+                    ]
                 },
                 "createdAt": {
                     "type": "string"
@@ -351,6 +1262,14 @@ const docTemplate = `{
                         "type": "number"
                     }
                 },
+                "lossRate": {
+                    "description": "Sample loss rate in percent, only sent by sensors using a newer schema",
+                    "type": "number"
+                },
+                "obfuscation": {
+                    "description": "Method used to obfuscate IQ spectrum data, only sent by sensors using a newer schema",
+                    "type": "string"
+                },
                 "sampleType": {
                     "description": "Sample type string (IQ, PSD, DEC)",
                     "type": "string"
@@ -361,7 +1280,11 @@ const docTemplate = `{
                 },
                 "time": {
                     "description": "Sample timestamp with microseconds precision",
-                    "$ref": "#/definitions/models.SampleTime"
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/models.SampleTime"
+                        }
+                    ]
                 }
             }
         },
@@ -423,6 +1346,23 @@ const docTemplate = `{
                 }
             }
         },
+        "models.SampleSchema": {
+            "type": "object",
+            "properties": {
+                "current": {
+                    "description": "Whether this is the schema all samples are resolved to",
+                    "type": "boolean"
+                },
+                "fingerprint": {
+                    "description": "CRC-64-AVRO fingerprint of the schema, as a hexadecimal string",
+                    "type": "string"
+                },
+                "schema": {
+                    "description": "The schema itself, in canonical form",
+                    "type": "object"
+                }
+            }
+        },
         "models.SampleTime": {
             "type": "object",
             "properties": {
@@ -436,6 +1376,56 @@ const docTemplate = `{
                 }
             }
         },
+        "models.SensorDispatch": {
+            "type": "object",
+            "properties": {
+                "acknowledgedAt": {
+                    "description": "The time at which the sensor acknowledged the request",
+                    "type": "string"
+                },
+                "attempts": {
+                    "description": "Number of times the request was sent to the sensor",
+                    "type": "integer"
+                },
+                "stats": {
+                    "description": "Statistics returned by the sensor along with its acknowledgement",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/stats.Stats"
+                        }
+                    ]
+                },
+                "status": {
+                    "description": "Dispatch status (pending, acknowledged, failed)",
+                    "type": "string"
+                }
+            }
+        },
+        "models.StoreStats": {
+            "type": "object",
+            "properties": {
+                "backend": {
+                    "description": "Type of the store (badger, files, postgres)",
+                    "type": "string"
+                },
+                "bytes": {
+                    "description": "Space taken by the stored samples in bytes, including any overhead of the store",
+                    "type": "integer"
+                },
+                "lastCollected": {
+                    "description": "Time of the last garbage collection, if any",
+                    "type": "string"
+                },
+                "reclaimed": {
+                    "description": "Space reclaimed by garbage collection since the backend started, in bytes (only\nfor stores which need garbage collection)",
+                    "type": "integer"
+                },
+                "samples": {
+                    "description": "Number of stored samples",
+                    "type": "integer"
+                }
+            }
+        },
         "stats.Stats": {
             "type": "object",
             "properties": {
@@ -462,6 +1452,23 @@ const docTemplate = `{
                 }
             }
         },
+        "stream.WelchConfig": {
+            "type": "object",
+            "properties": {
+                "fftSize": {
+                    "description": "Number of IQ samples in each segment, a power of two (1024 by default)",
+                    "type": "integer"
+                },
+                "overlap": {
+                    "description": "Fraction of each segment overlapping the next one, at least 0 and less than 1 (0.5\nby default)",
+                    "type": "number"
+                },
+                "window": {
+                    "description": "Window function applied to each segment: rectangular, hann (the default), hamming\nor blackman",
+                    "type": "string"
+                }
+            }
+        },
         "types.AggregatedMeasurementRequest": {
             "type": "object",
             "properties": {
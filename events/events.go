@@ -0,0 +1,60 @@
+package events
+
+import (
+	"sync"
+)
+
+// Size of the buffer of each subscriber: events are dropped for slow subscribers
+// once their buffer is full.
+const bufferSize = 64
+
+// Type Event is a notification about something which happened in the backend.
+type Event struct {
+	// Type of the event (e.g. "job")
+	Type string `json:"type"`
+
+	// Arbitrary event data
+	Data any `json:"data"`
+}
+
+var (
+	subscribers = map[string]map[chan Event]struct{}{}
+	mu          sync.RWMutex
+)
+
+// Publishes an event to all subscribers of the given organization. Never blocks.
+func Publish(org string, eventType string, data any) {
+	event := Event{
+		Type: eventType,
+		Data: data,
+	}
+
+	mu.RLock()
+	defer mu.RUnlock()
+	for sub := range subscribers[org] {
+		select {
+		case sub <- event:
+		default:
+		}
+	}
+}
+
+// Subscribes to all events of the given organization. The returned function must be
+// called exactly once to unsubscribe, which also closes the channel.
+func Subscribe(org string) (<-chan Event, func()) {
+	sub := make(chan Event, bufferSize)
+
+	mu.Lock()
+	if subscribers[org] == nil {
+		subscribers[org] = map[chan Event]struct{}{}
+	}
+	subscribers[org][sub] = struct{}{}
+	mu.Unlock()
+
+	return sub, func() {
+		mu.Lock()
+		delete(subscribers[org], sub)
+		mu.Unlock()
+		close(sub)
+	}
+}
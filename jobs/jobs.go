@@ -0,0 +1,651 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	oteltrace "go.opentelemetry.io/otel/trace"
+
+	"github.com/openrfsense/backend/database"
+	"github.com/openrfsense/backend/database/models"
+	"github.com/openrfsense/backend/events"
+	"github.com/openrfsense/backend/nats"
+	"github.com/openrfsense/backend/tracing"
+	"github.com/openrfsense/common/id"
+	"github.com/openrfsense/common/logging"
+	"github.com/openrfsense/common/stats"
+)
+
+var log = logging.New().
+	WithPrefix("jobs").
+	WithLevel(logging.DebugLevel).
+	WithFlags(logging.FlagsDevelopment)
+
+const (
+	// Maximum number of times a request is sent to sensors which have not acknowledged it
+	maxAttempts = 5
+
+	// Timeout for the first attempt, doubled on each retry to accommodate slow links
+	baseTimeout = 2 * time.Second
+
+	// The outbox is polled at this interval even if no new job was submitted
+	pollInterval = time.Second
+
+	// Maximum number of commands being sent to sensors at the same time
+	maxDispatches = 16
+)
+
+var ErrNotFound = errors.New("job not found")
+
+var tracer = otel.Tracer("github.com/openrfsense/backend/jobs")
+
+// Request and reply subjects for each type of campaign. Each job gets replies on its own
+// subject below the reply subject (see replySubject), so that sensors answering a job are
+// never mistaken for sensors answering another one.
+var subjects = map[string][2]string{
+	"PSD": {"node.all.aggregated", "node.get.all.aggregated"},
+	"IQ":  {"node.all.raw", "node.get.all.raw"},
+}
+
+// Wakes up the outbox worker when a new job is submitted
+var wake = make(chan struct{}, 1)
+
+// Type command is an outgoing request waiting in the outbox.
+type command struct {
+	ID      uint
+	JobId   string `db:"job_id"`
+	Subject string
+	Reply   string
+	Payload map[string]any
+
+	// Trace context of the request which submitted the job
+	TraceContext map[string]string `db:"trace_context"`
+}
+
+// Starts the outbox worker, which dispatches the requests of all running jobs to the
+// sensors. Jobs interrupted by a restart are resumed. Must be called after nats.Start.
+func Start(ctx context.Context) {
+	// Commands are sent concurrently, so that a job whose sensors are slow to answer does
+	// not hold up the others
+	slots := make(chan struct{}, maxDispatches)
+
+	go func() {
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-wake:
+			}
+
+		claim:
+			for {
+				select {
+				case slots <- struct{}{}:
+				default:
+					break claim
+				}
+
+				claimed, err := claimNext(ctx)
+				if err != nil {
+					log.Errorf("Could not dispatch outbox command: %v", err)
+				}
+				if claimed == nil || err != nil {
+					<-slots
+					break
+				}
+
+				go func() {
+					defer func() { <-slots }()
+
+					err := dispatch(ctx, *claimed)
+					if err != nil {
+						log.Errorf("Could not dispatch outbox command: %v", err)
+					}
+				}()
+			}
+		}
+	}()
+}
+
+// Creates a new job which dispatches the request to all sensors of the given campaign in
+// the background. The campaign, the job and the outgoing request are stored in a single
+// transaction, so a campaign always exists before any sensor is asked to record it. The
+// campaign stays pending until at least one sensor acknowledges the request. The request
+// must contain a "sensors" field, which is narrowed down to the sensors still missing on
+// each retry.
+func Submit(ctx context.Context, campaign models.Campaign, request any) (models.Job, error) {
+	return submit(ctx, campaign, request, true)
+}
+
+// Creates a new job which computes the samples of the given campaign in the backend
+// rather than asking sensors to record them. The campaign and the job are stored in a
+// single transaction, and the campaign stays pending until the job is finished. Whoever
+// processes the job reports its progress with Progress.
+func SubmitProcessing(ctx context.Context, campaign models.Campaign, request any) (models.Job, error) {
+	return submit(ctx, campaign, request, false)
+}
+
+func submit(ctx context.Context, campaign models.Campaign, request any, dispatch bool) (_ models.Job, err error) {
+	ctx, span := tracer.Start(ctx, "jobs.submit", oteltrace.WithAttributes(
+		attribute.String("campaign.id", campaign.CampaignId),
+		attribute.String("campaign.type", campaign.Type),
+	))
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	raw, err := json.Marshal(request)
+	if err != nil {
+		return models.Job{}, err
+	}
+
+	job := models.Job{
+		JobId:        id.Generate(9),
+		Type:         campaign.Type,
+		Status:       models.JobRunning,
+		Request:      raw,
+		Sensors:      make(map[string]models.SensorDispatch, len(campaign.Sensors)),
+		CampaignId:   &campaign.CampaignId,
+		Organization: campaign.Organization,
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+	}
+	for _, sensor := range campaign.Sensors {
+		job.Sensors[sensor] = models.SensorDispatch{Status: models.DispatchPending}
+	}
+	span.SetAttributes(attribute.String("job.id", job.JobId))
+
+	// Dispatch attempts and samples are correlated with the submitting request
+	traceContext := tracing.Marshal(ctx)
+
+	tx, err := database.Instance().Begin(ctx)
+	if err != nil {
+		return models.Job{}, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	_, err = tx.Exec(
+		ctx,
+		`insert into campaigns ("campaign_id", "sensors", "type", "begin", "end", "organization", "status", "trace_context", "derived_from") values ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		campaign.CampaignId,
+		campaign.Sensors,
+		campaign.Type,
+		campaign.Begin,
+		campaign.End,
+		campaign.Organization,
+		models.CampaignPending,
+		traceContext,
+		campaign.DerivedFrom,
+	)
+	if err != nil {
+		return models.Job{}, err
+	}
+
+	_, err = tx.Exec(
+		ctx,
+		`insert into jobs ("job_id", "organization", "type", "status", "request", "sensors", "campaign_id") values ($1, $2, $3, $4, $5, $6, $7)`,
+		job.JobId,
+		job.Organization,
+		job.Type,
+		job.Status,
+		job.Request,
+		job.Sensors,
+		job.CampaignId,
+	)
+	if err != nil {
+		return models.Job{}, err
+	}
+
+	if dispatch {
+		subject := subjects[job.Type]
+		_, err = tx.Exec(
+			ctx,
+			`insert into outbox ("job_id", "subject", "reply", "payload", "trace_context") values ($1, $2, $3, $4, $5)`,
+			job.JobId,
+			subject[0],
+			replySubject(subject[1], job.JobId),
+			job.Request,
+			traceContext,
+		)
+		if err != nil {
+			return models.Job{}, err
+		}
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return models.Job{}, err
+	}
+
+	events.Publish(job.Organization, "job", job)
+	if dispatch {
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	}
+
+	return job, nil
+}
+
+// Returns a single job belonging to an organization.
+func Get(ctx context.Context, org string, jobId string) (*models.Job, error) {
+	sql, args, _ := database.Instance().
+		Select("*").
+		From("jobs").
+		Where("organization = ?", org).
+		Where("job_id = ?", jobId).
+		ToSql()
+	job, err := database.Single[models.Job](ctx, sql, args...)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+
+	return job, err
+}
+
+// Returns the oldest running job submitted with SubmitProcessing, or ErrNotFound.
+func NextProcessing(ctx context.Context) (*models.Job, error) {
+	sql, args, _ := database.Instance().
+		Select("*").
+		From("jobs").
+		Where("status = ?", models.JobRunning).
+		Where(`"campaign_id" in (select "campaign_id" from campaigns where "derived_from" is not null)`).
+		OrderBy("id").
+		Limit(1).
+		ToSql()
+	job, err := database.Single[models.Job](ctx, sql, args...)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+
+	return job, err
+}
+
+// Stores the progress of a job submitted with SubmitProcessing: sensors whose samples were
+// computed are acknowledged, and those which could not be processed are failed. Once no
+// sensor is pending, the job is finished and its campaign becomes active with the
+// sensors which were processed, or failed if none was.
+func Progress(ctx context.Context, job *models.Job) error {
+	acknowledged := []string{}
+	pending := 0
+	for sensor, dispatch := range job.Sensors {
+		switch dispatch.Status {
+		case models.DispatchAcknowledged:
+			acknowledged = append(acknowledged, sensor)
+		case models.DispatchPending:
+			pending++
+		}
+	}
+
+	tx, err := database.Instance().Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	if pending == 0 {
+		finish(job, len(acknowledged))
+
+		campaignStatus := models.CampaignActive
+		if len(acknowledged) == 0 {
+			campaignStatus = models.CampaignFailed
+		}
+		_, err = tx.Exec(
+			ctx,
+			`update campaigns set "status" = $2, "sensors" = $3 where "campaign_id" = $1`,
+			job.CampaignId,
+			campaignStatus,
+			acknowledged,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	job.UpdatedAt = time.Now()
+	_, err = tx.Exec(
+		ctx,
+		`update jobs set "status" = $2, "sensors" = $3, "attempts" = $4, "error" = $5, "updated_at" = $6 where "job_id" = $1`,
+		job.JobId,
+		job.Status,
+		job.Sensors,
+		job.Attempts,
+		job.Error,
+		job.UpdatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return err
+	}
+
+	// The caller keeps updating the job while subscribers encode the event
+	events.Publish(job.Organization, "job", snapshot(job))
+	return nil
+}
+
+// Type claim is an attempt to dispatch a command, claimed with claimNext.
+type claim struct {
+	cmd command
+	job models.Job
+
+	// Whether a new attempt was counted and the command must be sent
+	send bool
+}
+
+// Takes the oldest command from the outbox which is due and claims the next attempt: the
+// attempt counters of the job are committed and the command is not due again before the
+// attempt times out, so other workers skip it and a crash during dispatch only causes the
+// attempt to be repeated later. Returns nil if no command is due.
+func claimNext(ctx context.Context) (*claim, error) {
+	tx, err := database.Instance().Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	rows, err := tx.Query(
+		ctx,
+		`select "id", "job_id", "subject", "reply", "payload", "trace_context" from outbox where "next_attempt_at" <= now() order by "id" limit 1 for update skip locked`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	cmd, err := pgx.CollectOneRow(rows, database.RowToStructByName[command])
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err = tx.Query(ctx, `select * from jobs where "job_id" = $1 for update`, cmd.JobId)
+	if err != nil {
+		return nil, err
+	}
+	job, err := pgx.CollectOneRow(rows, database.RowToStructByName[models.Job])
+	if err != nil {
+		return nil, err
+	}
+
+	// An attempt claimed before a crash is not sent again once attempts run out
+	send := false
+	if job.Attempts < maxAttempts {
+		for sensor, dispatch := range job.Sensors {
+			if dispatch.Status != models.DispatchPending {
+				continue
+			}
+
+			dispatch.Attempts++
+			job.Sensors[sensor] = dispatch
+			send = true
+		}
+		if send {
+			job.Attempts++
+		}
+	}
+
+	_, err = tx.Exec(
+		ctx,
+		`update outbox set "next_attempt_at" = now() + make_interval(secs => $2) where "id" = $1`,
+		cmd.ID,
+		(2 * timeout(job.Attempts)).Seconds(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	job.UpdatedAt = time.Now()
+	_, err = tx.Exec(
+		ctx,
+		`update jobs set "sensors" = $2, "attempts" = $3, "updated_at" = $4 where "job_id" = $1`,
+		job.JobId,
+		job.Sensors,
+		job.Attempts,
+		job.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &claim{cmd: cmd, job: job, send: send}, nil
+}
+
+// Sends a command claimed with claimNext to the sensors of the job which have not
+// acknowledged it yet, without holding any lock, then reconciles their acknowledgements
+// with the job and the campaign. Each attempt is traced as part of the request which
+// submitted the job.
+func dispatch(ctx context.Context, claimed claim) (err error) {
+	cmd, job := claimed.cmd, claimed.job
+	ctx, span := tracer.Start(
+		tracing.Unmarshal(ctx, cmd.TraceContext),
+		"jobs.dispatch",
+		oteltrace.WithAttributes(
+			attribute.String("job.id", cmd.JobId),
+			attribute.Int("job.attempt", job.Attempts),
+		),
+	)
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	missing := []string{}
+	for sensor, dispatch := range job.Sensors {
+		if dispatch.Status == models.DispatchPending {
+			missing = append(missing, sensor)
+		}
+	}
+
+	var acks []stats.Stats
+	if claimed.send {
+		acks, err = send(ctx, cmd, job, missing)
+		if err != nil {
+			log.Debugf("Job %s: attempt %d: %v", job.JobId, job.Attempts, err)
+		}
+	}
+
+	return reconcile(ctx, cmd, acks)
+}
+
+// Sends the command to the given sensors of the job and returns the acknowledgements of
+// the ones which answered on the reply subject of the job before the attempt timed out.
+func send(ctx context.Context, cmd command, job models.Job, sensors []string) ([]stats.Stats, error) {
+	cmd.Payload["sensors"] = sensors
+	acks, err := nats.PingContext[stats.Stats](ctx, cmd.Subject, replySubject(cmd.Reply, job.JobId), nats.PingConfig{
+		Message:      cmd.Payload,
+		HowMany:      len(sensors),
+		Timeout:      timeout(job.Attempts),
+		Organization: job.Organization,
+	})
+
+	// Sensors which were not asked cannot acknowledge the command
+	acknowledged := acks[:0]
+	for _, ack := range acks {
+		if slices.Contains(sensors, ack.ID) {
+			acknowledged = append(acknowledged, ack)
+		}
+	}
+	return acknowledged, err
+}
+
+// Returns the subject the sensors answer a job on, below the reply subject of its type of
+// campaign (e.g. node.get.all.raw.<job ID>).
+func replySubject(reply string, jobId string) string {
+	suffix := "." + jobId
+	if strings.HasSuffix(reply, suffix) {
+		return reply
+	}
+	return reply + suffix
+}
+
+// Records the acknowledgements of an attempt in the job and updates its campaign. The
+// command is removed from the outbox once all sensors acknowledged it or the last attempt
+// was made, and is retried after a backoff otherwise.
+func reconcile(ctx context.Context, cmd command, acks []stats.Stats) error {
+	tx, err := database.Instance().Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	rows, err := tx.Query(ctx, `select * from jobs where "job_id" = $1 for update`, cmd.JobId)
+	if err != nil {
+		return err
+	}
+	job, err := pgx.CollectOneRow(rows, database.RowToStructByName[models.Job])
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for i := range acks {
+		dispatch, ok := job.Sensors[acks[i].ID]
+		if !ok || dispatch.Status != models.DispatchPending {
+			continue
+		}
+
+		dispatch.Status = models.DispatchAcknowledged
+		dispatch.AcknowledgedAt = &now
+		dispatch.Stats = &acks[i]
+		job.Sensors[acks[i].ID] = dispatch
+	}
+
+	acknowledged := []string{}
+	for sensor, dispatch := range job.Sensors {
+		if dispatch.Status == models.DispatchAcknowledged {
+			acknowledged = append(acknowledged, sensor)
+		}
+	}
+
+	// Give up on the sensors which are still missing after the last attempt
+	done := len(acknowledged) == len(job.Sensors) || job.Attempts >= maxAttempts
+	campaignStatus := models.CampaignPending
+	if len(acknowledged) > 0 {
+		campaignStatus = models.CampaignActive
+	}
+	if done {
+		finish(&job, len(acknowledged))
+		if len(acknowledged) == 0 {
+			campaignStatus = models.CampaignFailed
+		}
+	}
+
+	// Campaigns only ever list the sensors which are actually recording them
+	_, err = tx.Exec(
+		ctx,
+		`update campaigns set "status" = $2, "sensors" = $3 where "campaign_id" = $1`,
+		job.CampaignId,
+		campaignStatus,
+		acknowledged,
+	)
+	if err != nil {
+		return err
+	}
+
+	job.UpdatedAt = now
+	_, err = tx.Exec(
+		ctx,
+		`update jobs set "status" = $2, "sensors" = $3, "attempts" = $4, "error" = $5, "updated_at" = $6 where "job_id" = $1`,
+		job.JobId,
+		job.Status,
+		job.Sensors,
+		job.Attempts,
+		job.Error,
+		job.UpdatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	if done {
+		_, err = tx.Exec(ctx, `delete from outbox where "id" = $1`, cmd.ID)
+	} else {
+		// Sensors which did not answer are given as much time to come back as they were
+		// given to answer
+		_, err = tx.Exec(
+			ctx,
+			`update outbox set "next_attempt_at" = now() + make_interval(secs => $2) where "id" = $1`,
+			cmd.ID,
+			timeout(job.Attempts).Seconds(),
+		)
+	}
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return err
+	}
+
+	events.Publish(job.Organization, "job", job)
+	return nil
+}
+
+// Returns how long sensors are given to acknowledge the given attempt.
+func timeout(attempt int) time.Duration {
+	return baseTimeout << max(attempt-1, 0)
+}
+
+// Returns a deep copy of a job.
+func snapshot(job *models.Job) models.Job {
+	c := *job
+	c.Request = slices.Clone(job.Request)
+	c.Sensors = maps.Clone(job.Sensors)
+	if job.CampaignId != nil {
+		campaignId := *job.CampaignId
+		c.CampaignId = &campaignId
+	}
+	if job.Error != nil {
+		reason := *job.Error
+		c.Error = &reason
+	}
+	return c
+}
+
+// Sets the final status of a job, marking sensors which never acknowledged the
+// request as failed.
+func finish(job *models.Job, acknowledged int) {
+	for sensor, dispatch := range job.Sensors {
+		if dispatch.Status == models.DispatchPending {
+			dispatch.Status = models.DispatchFailed
+			job.Sensors[sensor] = dispatch
+		}
+	}
+
+	switch {
+	case acknowledged == 0:
+		reason := "no sensor acknowledged the request"
+		job.Status = models.JobFailed
+		if job.Error == nil {
+			job.Error = &reason
+		}
+	case acknowledged < len(job.Sensors):
+		job.Status = models.JobPartial
+	default:
+		job.Status = models.JobSucceeded
+	}
+}
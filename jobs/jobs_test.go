@@ -0,0 +1,97 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/knadh/koanf"
+	"github.com/knadh/koanf/providers/confmap"
+	"github.com/nats-io/nats-server/v2/server"
+	natsgo "github.com/nats-io/nats.go"
+
+	"github.com/openrfsense/backend/database/models"
+	"github.com/openrfsense/backend/nats"
+	"github.com/openrfsense/common/stats"
+)
+
+const token = "super_secure_token"
+
+func TestConcurrentJobs(t *testing.T) {
+	config := koanf.New(".")
+	err := config.Load(confmap.Provider(map[string]any{
+		"nats.token": token,
+		"nats.port":  -1,
+	}, "."), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = nats.Start(config, server.Options{Port: -1, Authorization: token})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(nats.Disconnect)
+
+	// Sensors answer the requests they are part of, the first one late enough for the
+	// reply of the second one to arrive first
+	sensors, err := natsgo.Connect(nats.Conn().Conn.ConnectedUrl(), natsgo.Token(token))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(sensors.Close)
+	_, err = sensors.Subscribe("node.all.aggregated", func(msg *natsgo.Msg) {
+		request := struct {
+			Sensors []string `json:"sensors"`
+		}{}
+		_ = json.Unmarshal(msg.Data, &request)
+
+		for _, sensor := range request.Sensors {
+			if sensor == "first" {
+				time.Sleep(100 * time.Millisecond)
+			}
+			data, _ := json.Marshal(stats.Stats{ID: sensor})
+			_ = sensors.Publish(msg.Reply, data)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = sensors.Flush()
+
+	jobs := map[string]string{"a": "first", "b": "second"}
+	acks := map[string][]stats.Stats{}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for jobId, sensor := range jobs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			cmd := command{
+				JobId:   jobId,
+				Subject: subjects["PSD"][0],
+				Reply:   replySubject(subjects["PSD"][1], jobId),
+				Payload: map[string]any{},
+			}
+			job := models.Job{JobId: jobId, Attempts: 1}
+			received, err := send(context.Background(), cmd, job, []string{sensor})
+			if err != nil {
+				t.Error(err)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			acks[jobId] = received
+		}()
+	}
+	wg.Wait()
+
+	for jobId, sensor := range jobs {
+		if len(acks[jobId]) != 1 || acks[jobId][0].ID != sensor {
+			t.Errorf("job %s: expected an acknowledgement from %s only, got %v", jobId, sensor, acks[jobId])
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package jobs
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/openrfsense/backend/database"
+	"github.com/openrfsense/backend/database/models"
+	"github.com/openrfsense/backend/metrics"
+)
+
+// Campaigns are counted with this timeout, so that slow queries cannot stall scrapes
+const collectTimeout = 2 * time.Second
+
+var _ prometheus.Collector = campaignCollector{}
+
+// Type campaignCollector exports the number of ongoing campaigns of each organization.
+type campaignCollector struct{}
+
+var activeCampaigns = prometheus.NewDesc(
+	metrics.Name("campaigns", "active"),
+	"Active campaigns which are currently running, by organization.",
+	[]string{"organization"}, nil,
+)
+
+func init() {
+	metrics.Registry.MustRegister(campaignCollector{})
+}
+
+func (campaignCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- activeCampaigns
+}
+
+func (campaignCollector) Collect(ch chan<- prometheus.Metric) {
+	if database.Instance() == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), collectTimeout)
+	defer cancel()
+
+	sql, args, _ := database.Instance().
+		Select("organization", "count(*)").
+		From("campaigns").
+		Where("status = ?", models.CampaignActive).
+		Where(`"begin" <= now() and "end" >= now()`).
+		GroupBy("organization").
+		ToSql()
+	rows, err := database.Instance().Query(ctx, sql, args...)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var org string
+		var count int64
+		err = rows.Scan(&org, &count)
+		if err != nil {
+			log.Error(err)
+			return
+		}
+		ch <- prometheus.MustNewConstMetric(activeCampaigns, prometheus.GaugeValue, float64(count), org)
+	}
+	if rows.Err() != nil {
+		log.Error(rows.Err())
+	}
+}
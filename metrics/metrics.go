@@ -0,0 +1,132 @@
+package metrics
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Prefix of all metrics exported by the backend
+const namespace = "orfs"
+
+// Label used for samples whose sensor is not known (e.g. because they could not be decoded,
+// or the sensor does not take part in their campaign)
+const UnknownSensor = "unknown"
+
+// The registry holding all metrics exported by the backend
+var Registry = prometheus.NewRegistry()
+
+var (
+	httpRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Duration of HTTP requests, by route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	// Samples received by the collector, by sensor
+	SamplesIngested = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "samples",
+		Name:      "ingested_total",
+		Help:      "Samples received by the collector, by sensor.",
+	}, []string{"sensor"})
+
+	// Bytes received by the collector, by sensor
+	SampleBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "samples",
+		Name:      "ingested_bytes_total",
+		Help:      "Size of the samples received by the collector, by sensor.",
+	}, []string{"sensor"})
+
+	// Samples which could not be decoded
+	SampleDecodeFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "samples",
+		Name:      "decode_failures_total",
+		Help:      "Samples which could not be decoded.",
+	}, []string{"sensor"})
+
+	// Time taken to write a sample to Badger
+	BadgerWriteDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "badger",
+		Name:      "write_duration_seconds",
+		Help:      "Duration of sample writes to Badger.",
+		Buckets:   prometheus.ExponentialBuckets(0.0001, 4, 8),
+	})
+
+	// Pings to sensors which did not receive all expected replies, by organization
+	PingTimeouts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "nats",
+		Name:      "ping_timeouts_total",
+		Help:      "Pings to sensors which timed out before all replies were received, by organization.",
+	}, []string{"organization"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequestDuration,
+		SamplesIngested,
+		SampleBytes,
+		SampleDecodeFailures,
+		BadgerWriteDuration,
+		PingTimeouts,
+	)
+}
+
+// Registers a gauge whose value is computed by the given function every time metrics are
+// collected. Panics if a metric with the same name is already registered.
+func GaugeFunc(subsystem string, name string, help string, value func() float64) {
+	Registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      name,
+		Help:      help,
+	}, value))
+}
+
+// Returns the fully qualified name of a metric exported by the backend.
+func Name(subsystem string, name string) string {
+	return prometheus.BuildFQName(namespace, subsystem, name)
+}
+
+// Returns a handler which serves all metrics in the Prometheus text exposition format.
+func Handler() fiber.Handler {
+	return adaptor.HTTPHandler(promhttp.HandlerFor(Registry, promhttp.HandlerOpts{}))
+}
+
+// Returns a middleware which records the duration of every request, by route.
+func Middleware() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		start := time.Now()
+		err := ctx.Next()
+
+		// Errors are only turned into responses by the error handler, after this returns
+		status := ctx.Response().StatusCode()
+		if err != nil {
+			status = fiber.StatusInternalServerError
+			var fiberErr *fiber.Error
+			if errors.As(err, &fiberErr) {
+				status = fiberErr.Code
+			}
+		}
+
+		httpRequestDuration.
+			WithLabelValues(ctx.Method(), ctx.Route().Path, strconv.Itoa(status)).
+			Observe(time.Since(start).Seconds())
+
+		return err
+	}
+}
@@ -0,0 +1,121 @@
+package nats
+
+import (
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/knadh/koanf"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+)
+
+// The default organization is bound to the global account of the embedded server, which
+// is also the one used by legacy nodes connecting with the global token.
+const DefaultOrganization = "default"
+
+// Prefix for the usernames of the internal clients connected to organization accounts.
+const internalUserPrefix = "$backend:"
+
+// Internal clients connected to each organization account
+var orgConns sync.Map
+
+// Creates a dedicated account for the given organization on the embedded server and
+// connects an internal client to it. Nodes belonging to different organizations cannot
+// see each other's subjects. Does nothing if the organization was already added.
+func AddOrganization(org string) error {
+	if org == DefaultOrganization {
+		return nil
+	}
+	if _, ok := orgConns.Load(org); ok {
+		return nil
+	}
+
+	_, err := account(natsServer, org)
+	if err != nil {
+		return err
+	}
+
+	conn, err := startClient(natsServer.ClientURL(), "", nats.JSON_ENCODER, nats.UserInfo(internalUserPrefix+org, auth.internal))
+	if err != nil {
+		return err
+	}
+
+	orgConns.Store(org, conn)
+	return nil
+}
+
+// Returns the internal client connected to the account of the given organization, or the
+// default internal client for the default organization (or an unknown one).
+func ConnFor(org string) *nats.EncodedConn {
+	conn, ok := orgConns.Load(org)
+	if !ok {
+		return natsConn
+	}
+
+	return conn.(*nats.EncodedConn)
+}
+
+// Returns the internal clients of all organizations, including the default one.
+func Conns() map[string]*nats.EncodedConn {
+	conns := map[string]*nats.EncodedConn{DefaultOrganization: natsConn}
+	orgConns.Range(func(key, value any) bool {
+		conns[key.(string)] = value.(*nats.EncodedConn)
+		return true
+	})
+
+	return conns
+}
+
+// Returns the organizations users are assigned to in the configuration, other than the
+// default one.
+func organizations(config *koanf.Koanf) []string {
+	orgs := []string{}
+	for _, org := range config.StringMap("backend.organizations") {
+		if org != "" && org != DefaultOrganization && !slices.Contains(orgs, org) {
+			orgs = append(orgs, org)
+		}
+	}
+
+	slices.Sort(orgs)
+	return orgs
+}
+
+// Returns the name of the server account bound to an organization.
+func accountName(org string) string {
+	return "org:" + org
+}
+
+// Returns the server account bound to an organization, registering it if needed.
+func account(s *server.Server, org string) (*server.Account, error) {
+	if org == "" || org == DefaultOrganization {
+		return s.GlobalAccount(), nil
+	}
+
+	acc, err := s.LookupAccount(accountName(org))
+	if err == nil {
+		return acc, nil
+	}
+
+	return s.RegisterAccount(accountName(org))
+}
+
+// Returns the organization of an internal client from its username, if it is one.
+func internalOrganization(username string) (string, bool) {
+	if !strings.HasPrefix(username, internalUserPrefix) {
+		return "", false
+	}
+
+	return strings.TrimPrefix(username, internalUserPrefix), true
+}
+
+// Drains and closes all internal clients connected to organization accounts.
+func disconnectOrganizations() {
+	orgConns.Range(func(key, value any) bool {
+		conn := value.(*nats.EncodedConn)
+		_ = conn.Drain()
+		conn.Close()
+		orgConns.Delete(key)
+		return true
+	})
+}
@@ -0,0 +1,174 @@
+package nats
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"sync"
+
+	"github.com/nats-io/nats-server/v2/server"
+)
+
+var _ server.Authentication = (*authenticator)(nil)
+
+var (
+	auth     = &authenticator{internal: newSecret()}
+	reloadMu sync.Mutex
+)
+
+// Type authenticator implements custom client authentication for the embedded server.
+// Clients presenting the global token (the backend itself and legacy nodes) are
+// always let through to the global account, while enrolled nodes authenticate with their
+// own username (the sensor ID) and password, and are restricted to their own subjects
+// within the account of their organization. The internal clients of organizations
+// authenticate with a secret generated when the backend starts, which never leaves it.
+type authenticator struct {
+	token    string
+	internal string
+	nodes    sync.Map
+}
+
+// Type nodeCredentials is stored by the authenticator for each enrolled node.
+type nodeCredentials struct {
+	secretHash   string
+	organization string
+}
+
+// Check implements server.Authentication.
+func (a *authenticator) Check(c server.ClientAuthentication) bool {
+	opts := c.GetOpts()
+
+	// Internal clients are bound to the account of their organization. The global token is
+	// not enough, as legacy nodes have it too
+	if org, ok := internalOrganization(opts.Username); ok {
+		if subtle.ConstantTimeCompare([]byte(opts.Password), []byte(a.internal)) != 1 {
+			return false
+		}
+
+		acc, err := account(natsServer, org)
+		if err != nil {
+			return false
+		}
+		c.RegisterUser(&server.User{
+			Username: opts.Username,
+			Account:  acc,
+		})
+		return true
+	}
+
+	if a.token != "" && subtle.ConstantTimeCompare([]byte(opts.Token), []byte(a.token)) == 1 {
+		return true
+	}
+
+	creds, ok := a.node(opts.Username, opts.Password)
+	if !ok {
+		return false
+	}
+
+	acc, err := account(natsServer, creds.organization)
+	if err != nil {
+		return false
+	}
+
+	c.RegisterUser(&server.User{
+		Username:    opts.Username,
+		Account:     acc,
+		Permissions: nodePermissions(opts.Username),
+	})
+	return true
+}
+
+// Returns the credentials of an enrolled node if the given password is correct.
+func (a *authenticator) node(sensorId string, password string) (nodeCredentials, bool) {
+	value, ok := a.nodes.Load(sensorId)
+	if !ok || password == "" {
+		return nodeCredentials{}, false
+	}
+
+	creds := value.(nodeCredentials)
+	if subtle.ConstantTimeCompare([]byte(HashSecret(password)), []byte(creds.secretHash)) != 1 {
+		return nodeCredentials{}, false
+	}
+
+	return creds, true
+}
+
+// Returns true if the given sensor ID and secret are the credentials of an enrolled
+// node, so that nodes can use the same credentials outside of NATS.
+func CheckNode(sensorId string, secret string) bool {
+	_, ok := auth.node(sensorId, secret)
+	return ok
+}
+
+// Returns a random secret for the internal clients of organizations.
+func newSecret() string {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// Returns the hex-encoded SHA-256 hash of a node secret, as stored in the database
+// and used by the authenticator.
+func HashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// Allows a node to connect to the embedded server using its sensor ID as username and
+// a secret which hashes to secretHash (see HashSecret) as password. The node is bound
+// to the account of the given organization.
+func Authorize(sensorId string, secretHash string, org string) {
+	auth.nodes.Store(sensorId, nodeCredentials{
+		secretHash:   secretHash,
+		organization: org,
+	})
+}
+
+// Removes the credentials for the given node and immediately disconnects it from the
+// embedded server, if it is currently connected.
+func Revoke(sensorId string) error {
+	auth.nodes.Delete(sensorId)
+
+	if natsServer == nil {
+		return nil
+	}
+
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	// Any change to the (otherwise unused) user list makes the server re-check all
+	// connected clients against the authenticator and close the ones which fail
+	opts := *natsOpts
+	if len(opts.Users) == 0 {
+		opts.Users = []*server.User{{Username: "revoked"}}
+	} else {
+		opts.Users = nil
+	}
+
+	err := natsServer.ReloadOptions(&opts)
+	if err != nil {
+		return err
+	}
+
+	natsOpts = &opts
+	return nil
+}
+
+// Returns the permissions for an enrolled node: it can only listen on broadcast
+// subjects and on its own subjects, and only publish replies and logs.
+func nodePermissions(sensorId string) *server.Permissions {
+	own := fmt.Sprintf("node.%s.>", sensorId)
+	return &server.Permissions{
+		Publish: &server.SubjectPermission{
+			Allow: []string{own, "node.get.>", "node.all.error", "node.all.output", "_INBOX.>"},
+		},
+		Subscribe: &server.SubjectPermission{
+			Allow: []string{own, fmt.Sprintf("node.%s", sensorId), "node.all", "node.all.>"},
+		},
+	}
+}
@@ -0,0 +1,175 @@
+package nats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+)
+
+func TestRevoke(t *testing.T) {
+	auth.token = token
+	natsOpts = &server.Options{
+		Host:                       "",
+		Port:                       -1,
+		CustomClientAuthentication: auth,
+	}
+
+	var err error
+	natsServer, err = startServer(natsOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(natsServer.Shutdown)
+
+	Authorize("sensor", HashSecret("secret"), DefaultOrganization)
+
+	_, err = nats.Connect(natsServer.ClientURL(), nats.UserInfo("sensor", "wrong"))
+	if err == nil {
+		t.Fatal("connected with the wrong password")
+	}
+
+	closed := make(chan struct{})
+	nc, err := nats.Connect(
+		natsServer.ClientURL(),
+		nats.UserInfo("sensor", "secret"),
+		nats.NoReconnect(),
+		nats.ClosedHandler(func(_ *nats.Conn) { close(closed) }),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(nc.Close)
+
+	// Nodes can only subscribe to their own subjects
+	_, err = nc.SubscribeSync("node.other.stats")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = nc.Flush()
+	if nc.LastError() == nil {
+		t.Fatal("subscribed to another node's subject")
+	}
+
+	err = Revoke("sensor")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("revoked node is still connected")
+	}
+
+	// The global token still works
+	c := createClientConnSubscribeAndPublish(t, natsServer, "node.all")
+	t.Cleanup(c.Close)
+}
+
+func TestOrganizationIsolation(t *testing.T) {
+	auth.token = token
+	natsOpts = &server.Options{
+		Host:                       "",
+		Port:                       -1,
+		CustomClientAuthentication: auth,
+	}
+
+	var err error
+	natsServer, err = startServer(natsOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(natsServer.Shutdown)
+
+	natsConn, err = startClient(natsServer.ClientURL(), token, nats.JSON_ENCODER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = AddOrganization("university")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(Disconnect)
+
+	Authorize("sensor", HashSecret("secret"), "university")
+	nc, err := nats.Connect(natsServer.ClientURL(), nats.UserInfo("sensor", "secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(nc.Close)
+
+	sub, err := nc.SubscribeSync("node.all")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = nc.Flush()
+
+	// Messages published in the default organization must not reach the node
+	_ = Conn().Publish("node.all", "default")
+	_ = ConnFor("university").Publish("node.all", "university")
+	_ = Conn().Flush()
+	_ = ConnFor("university").Flush()
+
+	msg, err := sub.NextMsg(time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(msg.Data) != `"university"` {
+		t.Fatalf("received message from another organization: %s", msg.Data)
+	}
+
+	acc, _ := account(natsServer, "university")
+	local, _, _ := presence(natsServer, acc, "node.all")
+	if local != 1 {
+		t.Fatalf("expected one subscriber in the organization, got %d", local)
+	}
+	local, _, _ = presence(natsServer, natsServer.GlobalAccount(), "node.all")
+	if local != 0 {
+		t.Fatalf("expected no subscribers in the default organization, got %d", local)
+	}
+}
+
+func TestInternalClients(t *testing.T) {
+	auth.token = token
+	natsOpts = &server.Options{
+		Host:                       "",
+		Port:                       -1,
+		CustomClientAuthentication: auth,
+	}
+
+	var err error
+	natsServer, err = startServer(natsOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(natsServer.Shutdown)
+
+	natsConn, err = startClient(natsServer.ClientURL(), token, nats.JSON_ENCODER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = AddOrganization("university")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(Disconnect)
+
+	// Legacy nodes know the global token, which must not give access to organizations
+	for _, options := range [][]nats.Option{
+		{nats.Token(token), nats.UserInfo(internalUserPrefix+"university", "")},
+		{nats.Token(token), nats.UserInfo(internalUserPrefix+"university", token)},
+		{nats.UserInfo(internalUserPrefix+"university", token)},
+	} {
+		nc, err := nats.Connect(natsServer.ClientURL(), options...)
+		if err == nil {
+			nc.Close()
+			t.Fatal("connected to the account of an organization with the global token")
+		}
+	}
+
+	if !ConnFor("university").Conn.IsConnected() {
+		t.Fatal("the internal client of the organization is not connected")
+	}
+}
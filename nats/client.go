@@ -4,10 +4,10 @@ import (
 	"github.com/nats-io/nats.go"
 )
 
-func startClient(url string, token string, encoder string) (*nats.EncodedConn, error) {
+func startClient(url string, token string, encoder string, options ...nats.Option) (*nats.EncodedConn, error) {
 	c, err := nats.Connect(
 		natsServer.ClientURL(),
-		nats.Token(token),
+		append(options, nats.Token(token))...,
 	)
 	if err != nil {
 		return nil, err
@@ -4,12 +4,22 @@ import (
 	"context"
 	"fmt"
 	"time"
+
+	"github.com/nats-io/nats.go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/openrfsense/backend/metrics"
+	"github.com/openrfsense/backend/tracing"
 )
 
 type PingConfig struct {
-	HowMany int
-	Timeout time.Duration
-	Message interface{}
+	HowMany      int
+	Timeout      time.Duration
+	Message      interface{}
+	Organization string
 }
 
 var defaultConfig = PingConfig{
@@ -18,31 +28,79 @@ var defaultConfig = PingConfig{
 	Timeout: 300 * time.Millisecond,
 }
 
+var tracer = otel.Tracer("github.com/openrfsense/backend/nats")
+
 func Ping[T any](subject string, reply string, config ...PingConfig) ([]T, error) {
+	return PingContext[T](context.Background(), subject, reply, config...)
+}
+
+// Like Ping, but the request is traced as part of the trace in ctx (if any). The trace
+// context is sent to the sensors in the headers of the request, and every reply is
+// recorded as a span linked to the trace context found in its headers.
+func PingContext[T any](ctx context.Context, subject string, reply string, config ...PingConfig) (_ []T, err error) {
 	cfg := configDefault(config...)
 
-	// If not specified, try to count all subscribers to the given subject
+	ctx, span := tracer.Start(
+		ctx,
+		"ping "+subject,
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			semconv.MessagingSystemKey.String("nats"),
+			semconv.MessagingDestinationName(subject),
+			attribute.String("organization", cfg.Organization),
+		),
+	)
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	// If not specified, try to count all subscribers to the given subject. Subscribers on
+	// remote servers cannot be counted, so in that case wait for the whole timeout
+	untilTimeout := false
 	if cfg.HowMany == 0 {
-		nodes, err := Presence(subject)
+		acc, err := account(natsServer, cfg.Organization)
+		if err != nil {
+			return nil, err
+		}
+
+		nodes, remote, err := presence(natsServer, acc, subject)
 		if err != nil {
 			return nil, err
 		}
 
 		// Early return if there are no subcribers to the subject
-		if nodes == 0 {
+		if nodes == 0 && !remote {
 			return []T{}, nil
 		}
 
 		cfg.HowMany = nodes
+		untilTimeout = remote
 	}
 
 	// Asynchronously collect messages in channel as soon as they are received
+	conn := ConnFor(cfg.Organization)
 	collectorChan := make(chan T)
-	sub, err := natsConn.Subscribe(reply, func(t *T) {
-		collectorChan <- *t
+	sub, err := conn.Conn.Subscribe(reply, func(msg *nats.Msg) {
+		_, replySpan := tracer.Start(
+			ctx,
+			"reply "+reply,
+			trace.WithSpanKind(trace.SpanKindConsumer),
+			trace.WithLinks(trace.LinkFromContext(tracing.ExtractNATS(context.Background(), msg))),
+		)
+		defer replySpan.End()
+
+		var t T
+		err := conn.Enc.Decode(msg.Subject, msg.Data, &t)
+		if err != nil {
+			tracing.RecordError(replySpan, err)
+			log.Error(err)
+			return
+		}
+		collectorChan <- t
 	})
 	defer func() {
-		err = sub.Unsubscribe()
+		err := sub.Unsubscribe()
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -52,11 +110,21 @@ func Ping[T any](subject string, reply string, config ...PingConfig) ([]T, error
 	}
 
 	// Send the message but register a flush with the given timeout
-	err = natsConn.PublishRequest(subject, reply, cfg.Message)
+	data, err := conn.Enc.Encode(subject, cfg.Message)
+	if err != nil {
+		return nil, err
+	}
+	msg := &nats.Msg{
+		Subject: subject,
+		Reply:   reply,
+		Data:    data,
+	}
+	tracing.InjectNATS(ctx, msg)
+	err = conn.Conn.PublishMsg(msg)
 	if err != nil {
 		return nil, err
 	}
-	err = natsConn.FlushTimeout(cfg.Timeout)
+	err = conn.FlushTimeout(cfg.Timeout)
 	if err != nil {
 		return nil, err
 	}
@@ -68,14 +136,22 @@ func Ping[T any](subject string, reply string, config ...PingConfig) ([]T, error
 	// Terminate if either one of these conditions is true:
 	// - The number of responses equals the given expected quantity
 	// - The timeout expires
-	for i := 0; i < cfg.HowMany; i++ {
+	// If there are remote subscribers, all responses are collected until the timeout expires.
+	defer func() { span.SetAttributes(attribute.Int("replies", len(collector))) }()
+	for i := 0; i < cfg.HowMany || untilTimeout; i++ {
 		select {
 		case p := <-collectorChan:
 			collector = append(collector, p)
+			continue
 		case <-c.Done():
+		}
+
+		if !untilTimeout {
 			log.Debugf("Ping timeout for request %#v on %s -> %s", cfg, subject, reply)
+			metrics.PingTimeouts.WithLabelValues(cfg.Organization).Inc()
 			err = fmt.Errorf("Ping timed out after %v for request on '%s'", cfg.Timeout, subject)
 		}
+		break
 	}
 
 	return collector, err
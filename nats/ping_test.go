@@ -0,0 +1,79 @@
+package nats
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/openrfsense/common/stats"
+)
+
+func TestPingTracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+
+	s, err := startServer(&server.Options{
+		Port:          -1,
+		Authorization: token,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Shutdown)
+	natsServer = s
+
+	natsConn, err = startClient(s.ClientURL(), token, nats.JSON_ENCODER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(natsConn.Close)
+
+	// A sensor which answers with the trace context it received
+	sensor := createClientConnSubscribeAndPublish(t, s)
+	t.Cleanup(sensor.Close)
+	_, err = sensor.Subscribe("node.all", func(msg *nats.Msg) {
+		data, _ := json.Marshal(stats.Stats{ID: "sensor"})
+		reply := nats.NewMsg(msg.Reply)
+		reply.Data = data
+		reply.Header = msg.Header
+		_ = sensor.PublishMsg(reply)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = sensor.Flush()
+
+	ctx, span := otel.Tracer("test").Start(context.Background(), "request")
+	replies, err := PingContext[stats.Stats](ctx, "node.all", "node.get.all", PingConfig{HowMany: 1})
+	span.End()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(replies) != 1 || replies[0].ID != "sensor" {
+		t.Fatalf("unexpected replies %v", replies)
+	}
+
+	spans := map[string]tracetest.SpanStub{}
+	for _, stub := range exporter.GetSpans() {
+		spans[stub.Name] = stub
+	}
+
+	ping, ok := spans["ping node.all"]
+	if !ok || ping.Parent.SpanID() != span.SpanContext().SpanID() {
+		t.Fatal("ping is not part of the trace of the request")
+	}
+
+	reply, ok := spans["reply node.get.all"]
+	if !ok || reply.Parent.SpanID() != ping.SpanContext.SpanID() {
+		t.Fatal("reply is not part of the trace of the ping")
+	}
+	if len(reply.Links) != 1 || reply.Links[0].SpanContext.SpanID() != ping.SpanContext.SpanID() {
+		t.Fatal("reply is not linked to the trace context sent by the sensor")
+	}
+}
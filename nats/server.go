@@ -8,12 +8,14 @@ import (
 	"github.com/nats-io/nats-server/v2/server"
 	"github.com/nats-io/nats.go"
 
+	"github.com/openrfsense/backend/metrics"
 	"github.com/openrfsense/common/logging"
 )
 
 var (
 	natsConn   *nats.EncodedConn
 	natsServer *server.Server
+	natsOpts   *server.Options
 
 	log = logging.New().
 		WithPrefix("nats").
@@ -23,22 +25,62 @@ var (
 
 var ErrNotReady = errors.New("server still isn't ready for connections")
 
+func init() {
+	metrics.GaugeFunc("nats", "connections", "Clients connected to the embedded NATS server.", func() float64 {
+		if natsServer == nil {
+			return 0
+		}
+		return float64(natsServer.NumClients())
+	})
+	metrics.GaugeFunc("nats", "subscriptions", "Subscriptions on the embedded NATS server.", func() float64 {
+		if natsServer == nil {
+			return 0
+		}
+		return float64(natsServer.NumSubscriptions())
+	})
+}
+
 // Start the embedded NATS server. If options are passed as parameters, they will override the internal
-// options (the common config module is used).
+// options (the common config module is used). Clients can authenticate either with the global token or
+// with node-specific credentials (see Authorize).
 func Start(config *koanf.Koanf, options ...server.Options) error {
 	token := config.MustString("nats.token")
+	auth.token = token
+
+	cluster, routes, err := clusterOptions(config)
+	if err != nil {
+		return err
+	}
+
+	// The accounts of organizations are created upfront, so that leafnode connections can
+	// be bound to them
+	accounts := make([]*server.Account, 0)
+	for _, org := range organizations(config) {
+		accounts = append(accounts, server.NewAccount(accountName(org)))
+	}
+
+	leafnodes, err := leafnodeOptions(config, accounts)
+	if err != nil {
+		return err
+	}
+
 	opts := server.Options{
-		Host:          config.String("backend.host"),
-		Port:          config.MustInt("nats.port"),
-		JetStream:     false,
-		Authorization: token,
-		Debug:         true,
+		ServerName:                 config.String("nats.name"),
+		Host:                       config.String("backend.host"),
+		Port:                       config.MustInt("nats.port"),
+		JetStream:                  false,
+		CustomClientAuthentication: auth,
+		Cluster:                    cluster,
+		Routes:                     routes,
+		Accounts:                   accounts,
+		LeafNode:                   leafnodes,
+		Debug:                      true,
 	}
 	if len(options) > 0 {
 		opts = options[0]
 	}
 
-	var err error
+	natsOpts = &opts
 	natsServer, err = startServer(&opts)
 	if err != nil {
 		return err
@@ -50,17 +92,46 @@ func Start(config *koanf.Koanf, options ...server.Options) error {
 	return err
 }
 
-// Returns the number of subscribers on a given subject.
+// Returns the number of subscribers on a given subject (in the default organization) which
+// are connected to the embedded server. Subscribers connected to other servers in the
+// cluster or to leafnodes are not counted, see RemoteInterest.
 func Presence(subject string) (int, error) {
-	subsz, err := natsServer.Subsz(&server.SubszOptions{
+	local, _, err := presence(natsServer, natsServer.GlobalAccount(), subject)
+	return local, err
+}
+
+// Returns true if there are subscribers on a given subject which are connected to other
+// servers in the cluster or to remote sites through leafnodes. Their exact number is not
+// known to the embedded server, as interest is aggregated along routes and leafnodes.
+func RemoteInterest(subject string) (bool, error) {
+	_, remote, err := presence(natsServer, natsServer.GlobalAccount(), subject)
+	return remote, err
+}
+
+// Returns the number of local subscribers on a given subject within an account, and
+// whether there are remote ones.
+func presence(s *server.Server, account *server.Account, subject string) (int, bool, error) {
+	subsz, err := s.Subsz(&server.SubszOptions{
 		Subscriptions: true,
+		Account:       account.GetName(),
 		Test:          subject,
 	})
 	if err != nil {
-		return 0, err
+		return 0, false, err
 	}
 
-	return len(subsz.Subs), nil
+	local := 0
+	for _, sub := range subsz.Subs {
+		if s.GetClient(sub.Cid) != nil {
+			local++
+		}
+	}
+
+	// Subsz only reports local subscriptions, while the account interest also
+	// includes the ones propagated by routes and leafnodes
+	remote := account.Interest(subject) > len(subsz.Subs)
+
+	return local, remote, nil
 }
 
 // Returns the default internal client.
@@ -68,8 +139,9 @@ func Conn() *nats.EncodedConn {
 	return natsConn
 }
 
-// Drains and closes the connection to the embedded NATS server.
+// Drains and closes all connections to the embedded NATS server.
 func Disconnect() {
+	disconnectOrganizations()
 	_ = natsConn.Drain()
 	natsConn.Close()
 }
@@ -0,0 +1,297 @@
+package nodes
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/basicauth"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/openrfsense/backend/database"
+	"github.com/openrfsense/backend/database/models"
+	"github.com/openrfsense/backend/nats"
+	"github.com/openrfsense/common/logging"
+)
+
+var log = logging.New().
+	WithPrefix("nodes").
+	WithLevel(logging.DebugLevel).
+	WithFlags(logging.FlagsDevelopment)
+
+// Enrollment codes are only valid for this long after being issued
+const codeValidity = 24 * time.Hour
+
+var (
+	ErrInvalidCode   = errors.New("invalid or expired enrollment code")
+	ErrInvalidId     = errors.New("invalid sensor ID")
+	ErrAlreadyExists = errors.New("node is already enrolled or has a pending request")
+	ErrNotFound      = errors.New("node not found")
+	ErrNotPending    = errors.New("node has no pending enrollment request")
+	ErrNotApproved   = errors.New("node enrollment has not been approved yet")
+)
+
+// Loads all approved nodes from the database and allows them to connect to the
+// embedded NATS server. Must be called after nats.Start.
+func Init(ctx context.Context) error {
+	sql, args, _ := database.Instance().
+		Select("*").
+		From("nodes").
+		Where("status = ?", models.NodeApproved).
+		ToSql()
+	approved, err := database.Multiple[models.Node](ctx, sql, args...)
+	if err != nil {
+		return err
+	}
+
+	for _, node := range approved {
+		if node.SecretHash != nil {
+			nats.Authorize(node.SensorId, *node.SecretHash, node.Organization)
+		}
+	}
+
+	log.Debugf("Authorized %d enrolled nodes", len(approved))
+	return nil
+}
+
+// Creates a new one-time enrollment code for the given organization. Only a hash of the
+// code is stored, so the returned value has to be handed to the sensor operator right away.
+func CreateCode(ctx context.Context, org string) (string, time.Time, error) {
+	code, err := randomHex(8)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	expires := time.Now().Add(codeValidity)
+	err = database.Do(
+		ctx,
+		`insert into enrollment_codes ("code_hash", "expires_at", "organization") values ($1, $2, $3)`,
+		nats.HashSecret(code),
+		expires,
+		org,
+	)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	return code, expires, nil
+}
+
+// Consumes an enrollment code and creates a pending enrollment request for the sensor,
+// which will belong to the same organization as the code. Previously rejected or revoked
+// sensors can enroll again with a new code.
+func Enroll(ctx context.Context, req models.EnrollmentRequest) error {
+	sensorId := strings.Trim(req.SensorId, ".")
+	if sensorId == "" || strings.ContainsAny(sensorId, ".*> ") {
+		return ErrInvalidId
+	}
+
+	codeHash := nats.HashSecret(req.Code)
+	tx, err := database.Instance().Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	var org string
+	err = tx.QueryRow(
+		ctx,
+		`update enrollment_codes set "used_at" = now()
+		where "code_hash" = $1 and "used_at" is null and "expires_at" > now()
+		returning "organization"`,
+		codeHash,
+	).Scan(&org)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrInvalidCode
+	}
+	if err != nil {
+		return err
+	}
+
+	tag, err := tx.Exec(
+		ctx,
+		`insert into nodes ("sensor_id", "status", "code_hash", "organization") values ($1, $2, $3, $4)
+		on conflict ("sensor_id") do update set "status" = $2, "code_hash" = $3, "organization" = $4, "updated_at" = now()
+		where nodes."status" in ($5, $6)`,
+		sensorId,
+		models.NodePending,
+		codeHash,
+		org,
+		models.NodeRejected,
+		models.NodeRevoked,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrAlreadyExists
+	}
+
+	return tx.Commit(ctx)
+}
+
+// Returns all nodes belonging to an organization, optionally filtered by enrollment status.
+func List(ctx context.Context, org string, status string) ([]models.Node, error) {
+	builder := database.Instance().Select("*").From("nodes").Where("organization = ?", org)
+	if len(status) > 0 {
+		builder = builder.Where("status = ?", status)
+	}
+
+	sql, args, _ := builder.OrderBy("created_at").ToSql()
+	return database.Multiple[models.Node](ctx, sql, args...)
+}
+
+// Approves a pending enrollment request: new credentials are generated for the node,
+// which is then allowed to connect to the embedded NATS server.
+func Approve(ctx context.Context, org string, sensorId string) error {
+	secret, err := randomHex(32)
+	if err != nil {
+		return err
+	}
+	secretHash := nats.HashSecret(secret)
+
+	err = setStatus(
+		ctx,
+		org,
+		sensorId,
+		models.NodePending,
+		models.NodeApproved,
+		`, "secret_hash" = $5, "pending_secret" = $6`,
+		secretHash,
+		secret,
+	)
+	if err != nil {
+		return err
+	}
+
+	nats.Authorize(sensorId, secretHash, org)
+	return nil
+}
+
+// Rejects a pending enrollment request.
+func Reject(ctx context.Context, org string, sensorId string) error {
+	return setStatus(ctx, org, sensorId, models.NodePending, models.NodeRejected, "")
+}
+
+// Revokes the credentials of an approved node and disconnects it from the
+// embedded NATS server.
+func Revoke(ctx context.Context, org string, sensorId string) error {
+	err := setStatus(
+		ctx,
+		org,
+		sensorId,
+		models.NodeApproved,
+		models.NodeRevoked,
+		`, "secret_hash" = null, "pending_secret" = null`,
+	)
+	if err != nil {
+		return err
+	}
+
+	return nats.Revoke(sensorId)
+}
+
+// Returns a middleware which requires basic HTTP authentication with the NATS credentials
+// of an enrolled node. The sensor ID is stored in the "username" local.
+func Authentication() fiber.Handler {
+	return basicauth.New(basicauth.Config{
+		Authorizer: nats.CheckNode,
+	})
+}
+
+// Hands out the credentials issued on approval to the sensor which presents the
+// same enrollment code it enrolled with. Credentials can only be retrieved once: the
+// secret is cleared by the same statement which reads it, and restored if the code does
+// not match.
+func Credentials(ctx context.Context, sensorId string, code string) (models.NodeCredentials, error) {
+	creds := models.NodeCredentials{Username: sensorId}
+	codeHash := []byte(nats.HashSecret(code))
+
+	tx, err := database.Instance().Begin(ctx)
+	if err != nil {
+		return creds, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	var secret, storedHash string
+	err = tx.QueryRow(
+		ctx,
+		`update nodes set "pending_secret" = null, "updated_at" = now()
+		where "sensor_id" = $1 and "status" = $2 and "pending_secret" is not null
+		returning "pending_secret", "code_hash"`,
+		sensorId,
+		models.NodeApproved,
+	).Scan(&secret, &storedHash)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return creds, credentialsError(ctx, sensorId, codeHash)
+	}
+	if err != nil {
+		return creds, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(storedHash), codeHash) != 1 {
+		return creds, ErrInvalidCode
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return creds, err
+	}
+
+	creds.Password = secret
+	return creds, nil
+}
+
+// Returns the reason why no credentials can be handed out to a sensor.
+func credentialsError(ctx context.Context, sensorId string, codeHash []byte) error {
+	node, err := database.Single[models.Node](ctx, `select * from nodes where "sensor_id" = $1`, sensorId)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(node.CodeHash), codeHash) != 1 {
+		return ErrInvalidCode
+	}
+	return ErrNotApproved
+}
+
+// Moves a node of the given organization from one status to another. Extra assignments
+// can be appended to the update statement, with their arguments starting from $5.
+func setStatus(ctx context.Context, org string, sensorId string, from string, to string, extra string, args ...any) error {
+	tag, err := database.Instance().Exec(
+		ctx,
+		`update nodes set "status" = $3, "updated_at" = now()`+extra+`
+		where "sensor_id" = $1 and "status" = $2 and "organization" = $4`,
+		append([]any{sensorId, from, to, org}, args...)...,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		if from == models.NodePending {
+			return ErrNotPending
+		}
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// Returns a random hex string generated from n random bytes.
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,77 @@
+package orgs
+
+import (
+	"context"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/basicauth"
+	"github.com/knadh/koanf"
+
+	"github.com/openrfsense/backend/database"
+	"github.com/openrfsense/backend/nats"
+	"github.com/openrfsense/common/logging"
+)
+
+var log = logging.New().
+	WithPrefix("orgs").
+	WithLevel(logging.DebugLevel).
+	WithFlags(logging.FlagsDevelopment)
+
+// Maps each user to its organization
+var members = map[string]string{}
+
+// Loads the organization of each user from the configuration, stores all organizations in
+// the database and creates their accounts on the embedded NATS server. Users which are not
+// assigned to any organization belong to the default one. Must be called after nats.Start.
+func Init(ctx context.Context, config *koanf.Koanf) error {
+	members = config.StringMap("backend.organizations")
+
+	all := map[string]struct{}{nats.DefaultOrganization: {}}
+	for _, org := range members {
+		all[org] = struct{}{}
+	}
+
+	for org := range all {
+		err := database.Do(
+			ctx,
+			`insert into organizations ("name") values ($1) on conflict do nothing`,
+			org,
+		)
+		if err != nil {
+			return err
+		}
+
+		err = nats.AddOrganization(org)
+		if err != nil {
+			return err
+		}
+	}
+
+	log.Debugf("Loaded %d organizations", len(all))
+	return nil
+}
+
+// Returns the organization the given user belongs to.
+func Of(username string) string {
+	org, ok := members[username]
+	if !ok || org == "" {
+		return nats.DefaultOrganization
+	}
+
+	return org
+}
+
+// Returns a middleware which requires basic HTTP authentication with one of the users
+// defined in the configuration.
+func Authentication(config *koanf.Koanf) fiber.Handler {
+	return basicauth.New(basicauth.Config{
+		Users: config.MustStringMap("backend.users"),
+	})
+}
+
+// Returns the organization of the authenticated user which made the request. All
+// queries must be scoped to this organization.
+func Current(ctx *fiber.Ctx) string {
+	username, _ := ctx.Locals("username").(string)
+	return Of(username)
+}
@@ -2,53 +2,175 @@ package samples
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"os"
+	"time"
 
-	"github.com/dgraph-io/badger/v3"
-	"github.com/hamba/avro/v2"
 	"github.com/knadh/koanf"
-	"github.com/openrfsense/backend/database/models"
 	"github.com/openrfsense/backend/samples/stream"
+	"github.com/reugn/go-streams"
 	"github.com/reugn/go-streams/flow"
 )
 
+// Starts the collector, which writes the samples it receives to the store opened by
+// OpenStore.
 func StartCollector(ctx context.Context, config *koanf.Koanf) error {
+	if store == nil {
+		return ErrNoStore
+	}
+
+	// Writer schemas used by sensors besides the default one
+	if dir := config.String("collector.schemas"); dir != "" {
+		err := LoadSchemas(dir)
+		if err != nil {
+			return err
+		}
+	}
+
 	// Define a channel-based TCP listener
 	addr := fmt.Sprintf(":%d", config.MustInt("collector.port"))
-	source, err := stream.NewTCPSource(ctx, addr)
+	tlsConfig, err := collectorTLS(config)
 	if err != nil {
 		return err
 	}
 
-	// Define a BadgerDB sink for data with a custom bucket key extractor
-	opts := badger.DefaultOptions(config.MustString("backend.storage"))
-	opts.SyncWrites = true
-	sink, err := stream.NewBadgerSinkWithPrefixExtractor(opts, extractPrefix(DefaultSchema))
+	// Legacy nodes connected with the global token can publish on the subject of any sensor,
+	// so samples received over NATS would get around mutual TLS unless this is explicitly
+	// allowed
+	requireClientCerts := tlsConfig != nil && tlsConfig.ClientAuth == tls.RequireAndVerifyClientCert
+	if requireClientCerts && config.Bool("collector.nats.enabled") && !config.Bool("collector.nats.unauthenticated") {
+		return errors.New("NATS ingestion is not bound to client certificates and cannot be enabled along with them unless collector.nats.unauthenticated is set")
+	}
+
+	source, err := stream.NewTCPSourceWithConfig(ctx, addr, stream.TCPSourceConfig{
+		MaxFrameSize:   uint32(config.MustInt("collector.maxframesize")),
+		AckWindow:      uint16(config.MustInt("collector.ackwindow")),
+		SchemaVersions: []uint16{SchemaVersion},
+		TLS:            tlsConfig,
+		Authorize:      authorizeSample,
+	})
 	if err != nil {
 		return err
 	}
 
-	go source.
-		Via(flow.NewPassThrough()).
-		To(sink)
+	sources := []streams.Flow{source.Via(flow.NewPassThrough())}
+
+	// Lightweight sensors can send samples over UDP, one per datagram
+	if udpPort := config.Int("collector.udp.port"); udpPort > 0 {
+		// UDP samples cannot be bound to a client certificate, so they would get around
+		// mutual TLS unless this is explicitly allowed
+		if requireClientCerts && !config.Bool("collector.udp.unauthenticated") {
+			return errors.New("UDP ingestion is not authenticated and cannot be enabled along with client certificates unless collector.udp.unauthenticated is set")
+		}
+
+		udpSource, err := stream.NewUDPSource(ctx, fmt.Sprintf(":%d", udpPort))
+		if err != nil {
+			return err
+		}
+
+		sources = append(sources, udpSource.Via(flow.NewPassThrough()))
+		go logUDPStats(ctx, udpSource)
+	}
+
+	// Samples which do not belong to an active campaign are quarantined
+	go flow.Merge(sources...).
+		Via(newValidator(ctx, config.Duration("collector.tolerance"))).
+		To(newStoreSink(ctx, store))
+
+	// Sensors can also publish samples on their NATS connection
+	if config.Bool("collector.nats.enabled") {
+		return StartNATSIngestion(ctx)
+	}
 
 	return nil
 }
 
+// Periodically logs the loss counters of the UDP source, if they changed.
+func logUDPStats(ctx context.Context, source *stream.UDPSource) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	last := stream.UDPSourceStats{}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		stats := source.Stats()
+		if stats != last {
+			log.Infof(
+				"UDP collector: %d received, %d dropped, %d out of order, %d malformed",
+				stats.Received,
+				stats.Dropped,
+				stats.OutOfOrder,
+				stats.Malformed,
+			)
+			last = stats
+		}
+	}
+}
+
 // func (c *Collector) Start() {
 // 	c.source.
 // 		Via(flow.NewPassThrough()).
 // 		To(c.sink)
 // }
 
-func extractPrefix(schema avro.Schema) stream.BadgerPrefixExtractor {
-	return func(b []byte) []byte {
-		var s models.Sample
-		err := avro.Unmarshal(schema, b, &s)
+// Returns the TLS configuration for the collector, or nil if TLS is disabled. Client
+// certificates are required if a client CA is configured.
+func collectorTLS(config *koanf.Koanf) (*tls.Config, error) {
+	certFile := config.String("collector.tls.cert")
+	if certFile == "" {
+		return nil, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, config.String("collector.tls.key"))
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	caFile := config.String("collector.tls.clientca")
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
 		if err != nil {
-			log.Error(err)
-			return nil
+			return nil, err
 		}
-		return makePrefix(s.CampaignId, s.SensorId)
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", caFile)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return tlsConfig, nil
+}
+
+// Only accepts samples sent by the sensor they belong to.
+func authorizeSample(identities []string, b []byte) bool {
+	s, err := Decode(b)
+	if err != nil {
+		log.Error(err)
+		return false
 	}
+
+	for _, identity := range identities {
+		if identity == s.SensorId {
+			return true
+		}
+	}
+
+	log.Warnf("Rejected sample for sensor %s sent by %v", s.SensorId, identities)
+	return false
 }
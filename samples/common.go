@@ -17,6 +17,9 @@ var schemasFs embed.FS
 
 var DefaultSchema avro.Schema
 
+// Version of the sample schema, announced by sensors during the collector handshake
+const SchemaVersion uint16 = 1
+
 func init() {
 	// Initialize schema
 	schemaBytes, err := schemasFs.ReadFile("sample.avsc")
@@ -24,11 +27,9 @@ func init() {
 		log.Fatal(err)
 	}
 	DefaultSchema = avro.MustParse(string(schemaBytes))
-}
 
-func makePrefix(campaignId string, sensorId string) []byte {
-	return append(
-		append([]byte(campaignId), byte('_')),
-		[]byte(sensorId)...,
-	)
+	defaultFingerprint, err = RegisterSchema(DefaultSchema)
+	if err != nil {
+		log.Fatal(err)
+	}
 }
@@ -0,0 +1,212 @@
+package samples
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/openrfsense/backend/database/models"
+	"github.com/openrfsense/backend/jobs"
+	"github.com/openrfsense/backend/samples/stream"
+	"github.com/openrfsense/common/id"
+)
+
+var ErrNotIQCampaign = errors.New("only IQ campaigns can be processed into PSD")
+
+const (
+	// Processing jobs are looked for at this interval even if none was submitted
+	derivePollInterval = time.Minute
+
+	// Number of times a processing job is started before it is given up, in case it keeps
+	// being interrupted
+	maxDeriveAttempts = 3
+)
+
+// Wakes up the processing worker when a new job is submitted
+var wakeDerive = make(chan struct{}, 1)
+
+// Type DeriveRequest is the request of a job which computes the PSD of an IQ campaign.
+type DeriveRequest struct {
+	// The IQ campaign the PSD is computed from
+	CampaignId string `json:"campaignId"`
+
+	stream.WelchConfig
+}
+
+// Creates a PSD campaign derived from an IQ campaign of the organization, along with a job
+// which computes its samples in the background with Welch's method (see stream.Welch).
+// The derived campaign has the same sensors, begin and end as the IQ campaign, and stays
+// pending until the job is finished. Returns ErrUnknownCampaign if the IQ campaign does
+// not exist or has no samples anymore, or ErrNotIQCampaign if it does not hold IQ samples.
+func DerivePSD(ctx context.Context, org string, campaignId string, config stream.WelchConfig) (models.Job, error) {
+	err := config.Validate()
+	if err != nil {
+		return models.Job{}, err
+	}
+
+	source, err := ownedCampaign(ctx, org, campaignId)
+	if err != nil {
+		return models.Job{}, err
+	}
+	if source.Status != models.CampaignActive {
+		return models.Job{}, ErrUnknownCampaign
+	}
+	if source.Type != "IQ" {
+		return models.Job{}, ErrNotIQCampaign
+	}
+
+	job, err := jobs.SubmitProcessing(ctx, models.Campaign{
+		CampaignId:   id.Generate(9),
+		Sensors:      source.Sensors,
+		Type:         "PSD",
+		Begin:        source.Begin,
+		End:          source.End,
+		Organization: org,
+		DerivedFrom:  &source.CampaignId,
+	}, DeriveRequest{
+		CampaignId:  source.CampaignId,
+		WelchConfig: config,
+	})
+	if err != nil {
+		return models.Job{}, err
+	}
+
+	select {
+	case wakeDerive <- struct{}{}:
+	default:
+	}
+	return job, nil
+}
+
+// Starts the processing worker, which computes the samples of derived campaigns one job
+// at a time. Jobs interrupted by a restart start over. Must be called after OpenStore.
+func StartDerivations(ctx context.Context) error {
+	if store == nil {
+		return ErrNoStore
+	}
+
+	go func() {
+		ticker := time.NewTicker(derivePollInterval)
+		defer ticker.Stop()
+
+		for {
+			for {
+				job, err := jobs.NextProcessing(ctx)
+				if errors.Is(err, jobs.ErrNotFound) {
+					break
+				}
+				if err == nil {
+					err = derive(ctx, job)
+				}
+				if err != nil {
+					if !errors.Is(err, context.Canceled) {
+						log.Errorf("Could not process job: %v", err)
+					}
+					break
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-wakeDerive:
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Computes the samples of the derived campaign of a processing job, one sensor at a time.
+func derive(ctx context.Context, job *models.Job) error {
+	request := DeriveRequest{}
+	err := json.Unmarshal(job.Request, &request)
+	if err != nil {
+		return err
+	}
+
+	// Samples computed before an interruption are computed again
+	if job.Attempts > 0 {
+		err = store.DeleteCampaign(ctx, *job.CampaignId)
+		if err != nil {
+			return err
+		}
+	}
+
+	status := models.DispatchPending
+	if job.Attempts >= maxDeriveAttempts {
+		reason := "processing was interrupted too many times"
+		job.Error = &reason
+		status = models.DispatchFailed
+	}
+	for sensor, dispatch := range job.Sensors {
+		dispatch.Status = status
+		dispatch.AcknowledgedAt = nil
+		job.Sensors[sensor] = dispatch
+	}
+	job.Attempts++
+
+	err = jobs.Progress(ctx, job)
+	if err != nil || status == models.DispatchFailed {
+		return err
+	}
+
+	sensors := make([]string, 0, len(job.Sensors))
+	for sensor := range job.Sensors {
+		sensors = append(sensors, sensor)
+	}
+	slices.Sort(sensors)
+
+	for _, sensor := range sensors {
+		dispatch := job.Sensors[sensor]
+		dispatch.Attempts++
+
+		err = deriveSensor(ctx, request, *job.CampaignId, sensor)
+		if errors.Is(err, context.Canceled) {
+			return err
+		}
+		if err != nil {
+			reason := fmt.Sprintf("sensor %s: %v", sensor, err)
+			job.Error = &reason
+			dispatch.Status = models.DispatchFailed
+		} else {
+			now := time.Now()
+			dispatch.Status = models.DispatchAcknowledged
+			dispatch.AcknowledgedAt = &now
+		}
+		job.Sensors[sensor] = dispatch
+
+		err = jobs.Progress(ctx, job)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Computes the PSD of all IQ samples recorded by a sensor during the campaign of the
+// request, and stores them in the derived campaign.
+func deriveSensor(ctx context.Context, request DeriveRequest, campaignId string, sensorId string) error {
+	q := SampleQuery{CampaignId: request.CampaignId, SensorId: sensorId}
+	return store.Range(ctx, q, func(s models.Sample) error {
+		psd, err := stream.Welch(request.WelchConfig, s)
+		if errors.Is(err, stream.ErrNotIQ) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		psd.CampaignId = campaignId
+		b, err := Encode(psd)
+		if err != nil {
+			return err
+		}
+		return store.Append(ctx, b, psd)
+	})
+}
@@ -0,0 +1,64 @@
+package samples
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/openrfsense/backend/database/models"
+	"github.com/openrfsense/backend/samples/stream"
+)
+
+func TestDeriveSensor(t *testing.T) {
+	st, err := openStore("files:" + filepath.Join(t.TempDir(), "files"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = st.Close() })
+
+	previous := store
+	store = st
+	t.Cleanup(func() { store = previous })
+
+	ctx := context.Background()
+	for i, sampleType := range []string{"IQ", "PSD", "IQ"} {
+		s := models.Sample{
+			SensorId:   "sensor",
+			CampaignId: "raw",
+			SampleType: sampleType,
+			SampleTime: models.SampleTime{Seconds: int64(i)},
+			Data:       make([]float32, 2*64),
+		}
+		s.Data[0] = 1
+		b, err := Encode(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = st.Append(ctx, b, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = deriveSensor(ctx, DeriveRequest{CampaignId: "raw", WelchConfig: stream.WelchConfig{FFTSize: 32}}, "derived", "sensor")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	derived := []models.Sample{}
+	err = st.Range(ctx, SampleQuery{CampaignId: "derived", SensorId: "sensor"}, func(s models.Sample) error {
+		derived = append(derived, s)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(derived) != 2 {
+		t.Fatalf("expected the PSD of both IQ samples, got %d samples", len(derived))
+	}
+	for _, s := range derived {
+		if s.SampleType != "PSD" || len(s.Data) != 32 || s.CampaignId != "derived" {
+			t.Errorf("unexpected derived sample %+v", s)
+		}
+	}
+}
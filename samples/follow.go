@@ -0,0 +1,103 @@
+package samples
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/dgraph-io/badger/v3/pb"
+
+	"github.com/openrfsense/backend/database/models"
+)
+
+var ErrFollowerTooSlow = errors.New("too many new samples are waiting to be read")
+
+// Maximum number of new samples waiting to be read by a follower
+const followQueueSize = 10000
+
+// Type Follower is implemented by stores which can deliver new samples as they are written.
+type Follower interface {
+	// Calls fn for each stored sample which matches the query, like Range, then for each
+	// matching sample written afterwards, until the context is done or fn returns an error.
+	// No sample is skipped or repeated between the two.
+	Follow(ctx context.Context, q SampleQuery, fn func(models.Sample) error) error
+}
+
+// Calls fn for each sample which matches the query, then for each new sample as it is
+// written if the store can follow new samples. Returns once the context is done, if the
+// store can follow new samples, or once all stored samples have been read otherwise.
+func Follow(ctx context.Context, q SampleQuery, fn func(models.Sample) error) error {
+	if store == nil {
+		return ErrNoStore
+	}
+
+	if follower, ok := store.(Follower); ok {
+		return follower.Follow(ctx, q, fn)
+	}
+	return store.Range(ctx, q, fn)
+}
+
+// Type followQueue holds the entries received by a subscription until they are read, so
+// that a slow reader never blocks writes.
+type followQueue struct {
+	mu      sync.Mutex
+	kvs     []*pb.KV
+	notify  chan struct{}
+	isReady chan struct{}
+	once    sync.Once
+}
+
+func newFollowQueue() *followQueue {
+	return &followQueue{
+		notify:  make(chan struct{}, 1),
+		isReady: make(chan struct{}),
+	}
+}
+
+// Marks the subscription as active.
+func (fq *followQueue) ready() {
+	fq.once.Do(func() { close(fq.isReady) })
+}
+
+// Adds an entry to the queue. Returns false if the queue is full.
+func (fq *followQueue) push(kv *pb.KV) bool {
+	fq.mu.Lock()
+	defer fq.mu.Unlock()
+
+	if len(fq.kvs) >= followQueueSize {
+		return false
+	}
+	fq.kvs = append(fq.kvs, kv)
+
+	select {
+	case fq.notify <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// Waits for entries and returns all of them. Returns the error of the subscription if it
+// ends before.
+func (fq *followQueue) pop(ctx context.Context, subscribed <-chan error) ([]*pb.KV, error) {
+	for {
+		fq.mu.Lock()
+		kvs := fq.kvs
+		fq.kvs = nil
+		fq.mu.Unlock()
+		if len(kvs) > 0 {
+			return kvs, nil
+		}
+
+		select {
+		case <-fq.notify:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case err := <-subscribed:
+			if err == nil {
+				// The store was closed
+				err = ErrNoStore
+			}
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package samples
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+
+	"github.com/hamba/avro/v2/ocf"
+
+	"github.com/openrfsense/backend/database/models"
+)
+
+// Content types accepted by Ingest
+const (
+	// Avro object container file
+	ContentTypeOCF = "application/avro"
+
+	// Avro records, each prefixed with its length as a big endian uint32
+	ContentTypeRecords = "application/octet-stream"
+
+	// One JSON sample per line
+	ContentTypeNDJSON = "application/x-ndjson"
+)
+
+var (
+	ErrUnsupportedContentType = errors.New("unsupported content type")
+	ErrCollectorStopped       = errors.New("the collector is not running")
+	ErrMalformedBatch         = errors.New("malformed batch")
+)
+
+// Maximum size of a single length-prefixed record
+const maxRecordSize = 16 << 20
+
+// Type batchItem is a single sample read from a batch, or the reason why it could not be read.
+type batchItem struct {
+	sample models.Sample
+	err    error
+
+	// The sample as it should be stored, if it was received in Avro binary format
+	data []byte
+}
+
+// Reads a batch of samples sent by a sensor and sends them through the same validation
+// as samples received by the collector. Samples belonging to other sensors are rejected.
+// Returns an error only if the batch as a whole cannot be read.
+func Ingest(ctx context.Context, sensorId string, contentType string, body io.Reader) (models.IngestResult, error) {
+	result := models.IngestResult{Items: []models.IngestedSample{}}
+	if pipeline == nil {
+		return result, ErrCollectorStopped
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return result, ErrUnsupportedContentType
+	}
+
+	var items []batchItem
+	switch mediaType {
+	case ContentTypeOCF:
+		items, err = readOCF(body)
+	case ContentTypeRecords:
+		items, err = readRecords(body)
+	case ContentTypeNDJSON:
+		items, err = readNDJSON(body)
+	default:
+		return result, ErrUnsupportedContentType
+	}
+	if err != nil {
+		return result, fmt.Errorf("%w: %v", ErrMalformedBatch, err)
+	}
+
+	for _, item := range items {
+		outcome, err := ingest(ctx, sensorId, item)
+		if err != nil {
+			return result, err
+		}
+
+		if outcome.Status == models.IngestAccepted {
+			result.Accepted++
+		} else {
+			result.Rejected++
+		}
+		result.Items = append(result.Items, outcome)
+	}
+
+	return result, nil
+}
+
+// Validates a single sample and hands it to the collector if it is valid.
+func ingest(ctx context.Context, sensorId string, item batchItem) (models.IngestedSample, error) {
+	if item.err != nil {
+		observeSample("", 0, item.err)
+		return models.IngestedSample{Status: models.IngestRejected, Reason: item.err.Error()}, nil
+	}
+
+	s := item.sample
+	if s.SensorId != sensorId {
+		return models.IngestedSample{
+			Status: models.IngestRejected,
+			Reason: fmt.Sprintf("sample belongs to sensor %s", s.SensorId),
+		}, nil
+	}
+
+	b := item.data
+	if b == nil {
+		var err error
+		b, err = Encode(s)
+		if err != nil {
+			return models.IngestedSample{Status: models.IngestRejected, Reason: err.Error()}, nil
+		}
+	}
+
+	reason, err := pipeline.accept(ctx, s, b)
+	if err != nil {
+		return models.IngestedSample{}, err
+	}
+	pipeline.observe(s, len(b))
+	if reason != "" {
+		return models.IngestedSample{Status: models.IngestQuarantined, Reason: reason}, nil
+	}
+
+	select {
+	case trusted <- b:
+	case <-ctx.Done():
+		return models.IngestedSample{}, ctx.Err()
+	}
+
+	return models.IngestedSample{Status: models.IngestAccepted}, nil
+}
+
+// Reads all samples from an Avro object container file, which embeds its own schema.
+func readOCF(body io.Reader) ([]batchItem, error) {
+	decoder, err := ocf.NewDecoder(body)
+	if err != nil {
+		return nil, err
+	}
+
+	items := []batchItem{}
+	for decoder.HasNext() {
+		item := batchItem{}
+		item.err = decoder.Decode(&item.sample)
+		items = append(items, item)
+	}
+
+	return items, decoder.Error()
+}
+
+// Reads length-prefixed Avro records, either in single-object encoding or written with
+// the default schema.
+func readRecords(body io.Reader) ([]batchItem, error) {
+	reader := bufio.NewReader(body)
+	size := make([]byte, 4)
+
+	items := []batchItem{}
+	for {
+		_, err := io.ReadFull(reader, size)
+		if errors.Is(err, io.EOF) {
+			return items, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		length := binary.BigEndian.Uint32(size)
+		if length > maxRecordSize {
+			return nil, fmt.Errorf("record of %d bytes is too large", length)
+		}
+
+		record := make([]byte, length)
+		_, err = io.ReadFull(reader, record)
+		if err != nil {
+			return nil, err
+		}
+
+		item := batchItem{}
+		item.data, item.sample, item.err = normalize(record)
+		items = append(items, item)
+	}
+}
+
+// Reads samples encoded as JSON, one per line.
+func readNDJSON(body io.Reader) ([]batchItem, error) {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), maxRecordSize)
+
+	items := []batchItem{}
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		item := batchItem{}
+		item.err = json.Unmarshal(scanner.Bytes(), &item.sample)
+		items = append(items, item)
+	}
+
+	return items, scanner.Err()
+}
@@ -0,0 +1,40 @@
+package samples
+
+import (
+	"github.com/openrfsense/backend/metrics"
+)
+
+func init() {
+	metrics.GaugeFunc("badger", "lsm_size_bytes", "Size of the Badger LSM tree.", func() float64 {
+		bs, ok := store.(*badgerStore)
+		if !ok {
+			return 0
+		}
+		lsm, _ := bs.Size()
+		return float64(lsm)
+	})
+	metrics.GaugeFunc("badger", "vlog_size_bytes", "Size of the Badger value log.", func() float64 {
+		bs, ok := store.(*badgerStore)
+		if !ok {
+			return 0
+		}
+		_, vlog := bs.Size()
+		return float64(vlog)
+	})
+}
+
+// Counts a sample received by the collector, or a decoding failure if err is not nil.
+// The sensor ID may be empty if it is not known.
+func observeSample(sensorId string, size int, err error) {
+	if sensorId == "" {
+		sensorId = metrics.UnknownSensor
+	}
+
+	if err != nil {
+		metrics.SampleDecodeFailures.WithLabelValues(sensorId).Inc()
+		return
+	}
+
+	metrics.SamplesIngested.WithLabelValues(sensorId).Inc()
+	metrics.SampleBytes.WithLabelValues(sensorId).Add(float64(size))
+}
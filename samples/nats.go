@@ -0,0 +1,86 @@
+package samples
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	natsgo "github.com/nats-io/nats.go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/openrfsense/backend/database/models"
+	"github.com/openrfsense/backend/nats"
+	"github.com/openrfsense/backend/tracing"
+)
+
+const (
+	// Sensors publish their samples on node.<sensor ID>.samples
+	samplesSubject = "node.*.samples"
+
+	// Backends in the same cluster share the samples published by sensors
+	samplesQueue = "samples"
+
+	// Samples (and bytes) waiting to be processed before the subscription starts
+	// dropping them
+	maxPendingSamples = 256
+	maxPendingBytes   = 64 << 20
+)
+
+// Subscribes to the samples published by sensors of all organizations on the embedded
+// NATS server and sends them through the same validation as samples received by the
+// collector. Samples are processed one at a time: sensors should publish them as requests
+// and wait for the reply (a models.IngestedSample) before sending the next one, so that
+// they cannot overrun the backend. Must be called after StartCollector.
+func StartNATSIngestion(ctx context.Context) error {
+	for org, conn := range nats.Conns() {
+		sub, err := conn.Conn.QueueSubscribe(samplesSubject, samplesQueue, handleNATSSample(ctx))
+		if err != nil {
+			return err
+		}
+
+		err = sub.SetPendingLimits(maxPendingSamples, maxPendingBytes)
+		if err != nil {
+			return err
+		}
+
+		log.Debugf("Receiving samples over NATS for organization %s", org)
+	}
+
+	return nil
+}
+
+func handleNATSSample(ctx context.Context) natsgo.MsgHandler {
+	return func(msg *natsgo.Msg) {
+		// Enrolled nodes can only publish on their own subjects
+		sensorId := strings.TrimSuffix(strings.TrimPrefix(msg.Subject, "node."), ".samples")
+
+		// Sensors may send the trace context of the sample in the message headers
+		msgCtx, span := tracer.Start(
+			tracing.ExtractNATS(ctx, msg),
+			"samples.receive",
+			trace.WithSpanKind(trace.SpanKindConsumer),
+			trace.WithAttributes(attribute.String("sensor.id", sensorId)),
+		)
+		defer span.End()
+
+		item := batchItem{}
+		item.data, item.sample, item.err = normalize(msg.Data)
+
+		outcome, err := ingest(msgCtx, sensorId, item)
+		if err != nil {
+			log.Error(err)
+			outcome = models.IngestedSample{Status: models.IngestRejected, Reason: err.Error()}
+		}
+
+		if msg.Reply == "" {
+			return
+		}
+
+		reply, _ := json.Marshal(outcome)
+		err = msg.Respond(reply)
+		if err != nil {
+			log.Error(err)
+		}
+	}
+}
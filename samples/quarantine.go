@@ -0,0 +1,81 @@
+package samples
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/openrfsense/backend/database"
+	"github.com/openrfsense/backend/database/models"
+)
+
+var ErrNotQuarantined = errors.New("no such quarantined sample")
+
+// Returns the samples quarantined in an organization, optionally filtered by campaign
+// and sensor.
+func Quarantined(ctx context.Context, org string, campaignId string, sensorId string) ([]models.QuarantinedSample, error) {
+	builder := database.Instance().
+		Select("*").
+		From("quarantine").
+		Where("organization = ?", org)
+	if len(campaignId) > 0 {
+		builder = builder.Where("campaign_id = ?", campaignId)
+	}
+	if len(sensorId) > 0 {
+		builder = builder.Where("sensor_id = ?", sensorId)
+	}
+
+	sql, args, _ := builder.OrderBy("created_at").ToSql()
+	return database.Multiple[models.QuarantinedSample](ctx, sql, args...)
+}
+
+// Removes a sample from the quarantine and stores it as if it had passed validation. The
+// sample is only deleted from the quarantine once it has been handed to the collector.
+func Release(ctx context.Context, org string, id uint64) error {
+	tx, err := database.Instance().Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	data, err := unquarantine(ctx, tx, org, id)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case trusted <- data:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	return tx.Commit(ctx)
+}
+
+// Deletes a sample from the quarantine.
+func Discard(ctx context.Context, org string, id uint64) error {
+	_, err := unquarantine(ctx, database.Instance(), org, id)
+	return err
+}
+
+// Deletes a sample from the quarantine and returns its data.
+func unquarantine(ctx context.Context, q querier, org string, id uint64) ([]byte, error) {
+	var data []byte
+	err := q.QueryRow(
+		ctx,
+		`delete from quarantine where "id" = $1 and "organization" = $2 returning "data"`,
+		id,
+		org,
+	).Scan(&data)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotQuarantined
+	}
+
+	return data, err
+}
+
+// Either a transaction or the connection pool
+type querier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
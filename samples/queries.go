@@ -2,31 +2,115 @@ package samples
 
 import (
 	"context"
+	"errors"
 	"time"
 
+	"github.com/jackc/pgx/v5"
+
+	"github.com/openrfsense/backend/database"
 	"github.com/openrfsense/backend/database/models"
 )
 
-// TODO: force pagination?
-func RetrieveSamples(ctx context.Context, campaignId string, sensorId string, from time.Time, to time.Time) ([]models.Sample, error) {
-	samples := []models.Sample{}
-	compareFrom := !from.IsZero()
-	compareTo := !to.IsZero()
+var ErrUnknownCampaign = errors.New("no such campaign")
+
+// Returned by the Range callback once enough samples have been read
+var errLimit = errors.New("limit reached")
 
-	var fromSampleTime, toSampleTime models.SampleTime
-	if compareFrom {
-		fromSampleTime.Seconds = from.Unix()
-		fromSampleTime.Microseconds = int32(from.UnixMicro() - (from.Unix() * 10e5))
+// Returns at most limit samples which match the query, read from the sample store. The
+// campaign must belong to the given organization.
+func RetrieveSamples(ctx context.Context, org string, q SampleQuery, limit int) ([]models.Sample, error) {
+	if store == nil {
+		return nil, ErrNoStore
 	}
-	if compareTo {
-		toSampleTime.Seconds = to.Unix()
-		toSampleTime.Microseconds = int32(to.UnixMicro() - (to.Unix() * 10e5))
+
+	_, err := ownedCampaign(ctx, org, q.CampaignId)
+	if err != nil {
+		return nil, err
 	}
 
-	// source, err := stream.NewBadgerSource(ctx, badger.DefaultOptions(""), makePrefix(campaignId, sensorId))
-	// if err != nil {
-	// 	return nil, err
-	// }
+	samples := []models.Sample{}
+	err = store.Range(ctx, q, func(s models.Sample) error {
+		if len(samples) >= limit {
+			return errLimit
+		}
+		samples = append(samples, s)
+		return nil
+	})
+	if err != nil && !errors.Is(err, errLimit) {
+		return nil, err
+	}
 
 	return samples, nil
 }
+
+// Returns at most limit rollups which match the query, read from the sample store. If no
+// resolution is given, the finest one which needs at most limit buckets to cover the
+// queried time range (or the whole campaign) for each sensor and center frequency is
+// used. The campaign must belong to the given organization.
+func RetrieveRollups(ctx context.Context, org string, q SampleQuery, resolution string, limit int) (models.RollupSeries, error) {
+	series := models.RollupSeries{Rollups: []models.Rollup{}}
+	if store == nil {
+		return series, ErrNoStore
+	}
+
+	campaign, err := ownedCampaign(ctx, org, q.CampaignId)
+	if err != nil {
+		return series, err
+	}
+
+	if resolution == "" {
+		from, to := q.From, q.To
+		if from.IsZero() {
+			from = campaign.Begin
+		}
+		if to.IsZero() {
+			to = campaign.End
+		}
+		resolution = pickResolution(to.Sub(from), limit).Name
+	}
+	_, err = ResolutionByName(resolution)
+	if err != nil {
+		return series, err
+	}
+	series.Resolution = resolution
+
+	err = store.RangeRollups(ctx, resolution, q, func(r models.Rollup) error {
+		if len(series.Rollups) >= limit {
+			return errLimit
+		}
+		series.Rollups = append(series.Rollups, r)
+		return nil
+	})
+	if err != nil && !errors.Is(err, errLimit) {
+		return series, err
+	}
+
+	return series, nil
+}
+
+// Returns the finest resolution which covers the given duration with at most limit
+// buckets, or the coarsest one.
+func pickResolution(span time.Duration, limit int) Resolution {
+	for _, res := range Resolutions {
+		if int64(span/res.Duration) < int64(limit) {
+			return res
+		}
+	}
+	return Resolutions[len(Resolutions)-1]
+}
+
+// Returns a campaign if it belongs to the given organization, or ErrUnknownCampaign.
+func ownedCampaign(ctx context.Context, org string, campaignId string) (*models.Campaign, error) {
+	sql, args, _ := database.Instance().
+		Select("*").
+		From("campaigns").
+		Where("campaign_id = ?", campaignId).
+		Where("organization = ?", org).
+		ToSql()
+
+	campaign, err := database.Single[models.Campaign](ctx, sql, args...)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrUnknownCampaign
+	}
+	return campaign, err
+}
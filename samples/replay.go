@@ -0,0 +1,242 @@
+package samples
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/openrfsense/backend/database/models"
+)
+
+// Modes of the waterfall endpoint, see waterfallMessage.Mode
+const (
+	ModeLive   = "live"
+	ModeReplay = "replay"
+)
+
+// Commands which control a replay, see waterfallMessage.Command
+const (
+	CommandPause  = "pause"
+	CommandResume = "resume"
+	CommandSeek   = "seek"
+)
+
+// Number of samples read from the store at once during a replay
+const replayBatchSize = 256
+
+// Returned while a replay is playing to restart it from another time
+var errSeek = errors.New("seek")
+
+// Type replayer reads the samples of a sensor from the store and sends them paced by the
+// time they were recorded at, at the speed of the current settings.
+type replayer struct {
+	q        SampleQuery
+	settings *atomic.Pointer[waterfallMessage]
+	messages chan waterfallMessage
+	out      chan any
+
+	// The replay had reached the recording time eventRef at wallRef (or reached eventRef
+	// and stopped there if paused)
+	wallRef  time.Time
+	eventRef time.Time
+	speed    int
+
+	paused bool
+	seekTo time.Time
+}
+
+// Starts replaying the samples which match the query from q.From. Samples are sent on the
+// channel returned by samples, which is closed once the context is done. Once all samples
+// have been sent, the replayer waits for the client to seek back.
+func replay(ctx context.Context, q SampleQuery, settings *atomic.Pointer[waterfallMessage]) *replayer {
+	r := &replayer{
+		q:        q,
+		settings: settings,
+		messages: make(chan waterfallMessage),
+		out:      make(chan any),
+	}
+
+	go r.run(ctx)
+	return r
+}
+
+// Returns the channel the samples are sent on.
+func (r *replayer) samples() chan any {
+	return r.out
+}
+
+// Passes a message of the client to the replayer: either a command, or new settings which
+// may change the speed.
+func (r *replayer) control(ctx context.Context, message waterfallMessage) {
+	select {
+	case r.messages <- message:
+	case <-ctx.Done():
+	}
+}
+
+func (r *replayer) run(ctx context.Context) {
+	defer close(r.out)
+
+	if store == nil {
+		log.Error(ErrNoStore)
+		return
+	}
+
+	from := r.q.From
+	for {
+		r.wallRef = time.Time{}
+		err := r.play(ctx, from)
+
+		// All samples have been sent, so only a seek can start the replay again
+		for err == nil {
+			err = r.wait(ctx, nil)
+		}
+
+		if !errors.Is(err, errSeek) {
+			if !errors.Is(err, context.Canceled) {
+				log.Error(err)
+			}
+			return
+		}
+		from = r.seekTo
+	}
+}
+
+// Sends all samples recorded from the given time, reading them in batches so that no
+// transaction stays open for the whole replay. Each batch resumes at the time of the last
+// sample sent, after the samples recorded at that time which were already sent: several
+// samples can be recorded in the same microsecond, and they are always read in the same
+// order.
+func (r *replayer) play(ctx context.Context, from time.Time) error {
+	q := r.q
+	q.From = from
+
+	// Number of samples recorded at q.From which were already sent
+	sent := 0
+	for {
+		batch := make([]models.Sample, 0, replayBatchSize)
+		skipped := 0
+		err := store.Range(ctx, q, func(s models.Sample) error {
+			if skipped < sent && sampleTime(s).Equal(q.From) {
+				skipped++
+				return nil
+			}
+
+			batch = append(batch, s)
+			if len(batch) == replayBatchSize {
+				return errLimit
+			}
+			return nil
+		})
+		if err != nil && !errors.Is(err, errLimit) {
+			return err
+		}
+
+		for _, s := range batch {
+			err = r.send(ctx, s)
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(batch) < replayBatchSize {
+			return nil
+		}
+
+		last := sampleTime(batch[len(batch)-1])
+		if !last.Equal(q.From) {
+			q.From, sent = last, 0
+		}
+		for i := len(batch) - 1; i >= 0 && sampleTime(batch[i]).Equal(last); i-- {
+			sent++
+		}
+	}
+}
+
+// Waits until the replay reaches the time the sample was recorded at, then sends it.
+func (r *replayer) send(ctx context.Context, s models.Sample) error {
+	recorded := sampleTime(s)
+
+	// The replay starts with this sample, without waiting from the requested time
+	if r.wallRef.IsZero() {
+		r.wallRef, r.eventRef, r.speed = time.Now(), recorded, r.settings.Load().Speed
+	}
+
+	for {
+		if speed := r.settings.Load().Speed; speed != r.speed {
+			r.eventRef, r.wallRef, r.speed = r.position(), time.Now(), speed
+		}
+
+		due := r.wallRef.Add(recorded.Sub(r.eventRef) / time.Duration(r.speed))
+		if !r.paused && !time.Now().Before(due) {
+			break
+		}
+
+		timer := time.NewTimer(time.Until(due))
+		err := r.wait(ctx, timer.C)
+		timer.Stop()
+		if err != nil {
+			return err
+		}
+	}
+
+	// Messages are still handled while the pipeline is busy, so that the client is never
+	// blocked
+	for {
+		select {
+		case r.out <- s:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		case message := <-r.messages:
+			err := r.handle(message)
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Returns the recording time the replay has reached.
+func (r *replayer) position() time.Time {
+	if r.paused {
+		return r.eventRef
+	}
+	return r.eventRef.Add(time.Since(r.wallRef) * time.Duration(r.speed))
+}
+
+// Waits for the timer (forever if nil or paused) or for a message of the client. Returns
+// errSeek if the client asked to seek.
+func (r *replayer) wait(ctx context.Context, timer <-chan time.Time) error {
+	if r.paused {
+		timer = nil
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+
+	case <-timer:
+		return nil
+
+	case message := <-r.messages:
+		return r.handle(message)
+	}
+}
+
+// Applies a command of the client. Returns errSeek if the client asked to seek.
+func (r *replayer) handle(message waterfallMessage) error {
+	switch {
+	case message.Command == CommandPause && !r.paused:
+		r.eventRef = r.position()
+		r.paused = true
+	case message.Command == CommandResume && r.paused:
+		r.wallRef = time.Now()
+		r.paused = false
+	case message.Command == CommandSeek:
+		r.seekTo = time.UnixMicro(message.Seek)
+		return errSeek
+	}
+	return nil
+}
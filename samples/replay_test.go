@@ -0,0 +1,158 @@
+package samples
+
+import (
+	"context"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/openrfsense/backend/database/models"
+)
+
+func TestReplay(t *testing.T) {
+	st, err := openStore("files:" + filepath.Join(t.TempDir(), "files"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = st.Close() })
+
+	previous := store
+	store = st
+	t.Cleanup(func() { store = previous })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// More samples than a batch, 10 ms apart
+	const total = replayBatchSize + 44
+	begin := time.Unix(1700000000, 0)
+	for i := 0; i < total; i++ {
+		recorded := begin.Add(time.Duration(i) * 10 * time.Millisecond)
+		s := models.Sample{
+			SensorId:   "sensor",
+			CampaignId: "campaign",
+			SampleType: "PSD",
+			SampleTime: models.SampleTime{Seconds: recorded.Unix(), Microseconds: int32(recorded.Nanosecond() / 1000)},
+			Data:       []float32{float32(i)},
+		}
+		b, err := Encode(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = st.Append(ctx, b, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	settings := atomic.Pointer[waterfallMessage]{}
+	settings.Store(&waterfallMessage{Speed: 100})
+	player := replay(ctx, SampleQuery{CampaignId: "campaign", SensorId: "sensor"}, &settings)
+
+	next := func() int {
+		select {
+		case s := <-player.samples():
+			return int(s.(models.Sample).Data[0])
+		case <-ctx.Done():
+			t.Fatal("replay stopped")
+			return 0
+		}
+	}
+
+	started := time.Now()
+	for i := 0; i < total; i++ {
+		if v := next(); v != i {
+			t.Fatalf("expected sample %d, got %d", i, v)
+		}
+	}
+	// 3 s of samples at 100x
+	if elapsed := time.Since(started); elapsed < 25*time.Millisecond {
+		t.Fatalf("replay was not paced, took %v", elapsed)
+	}
+
+	// Seek back once the replay is over, then pause
+	player.control(ctx, waterfallMessage{Command: CommandSeek, Seek: begin.Add(2 * time.Second).UnixMicro()})
+	if v := next(); v != 200 {
+		t.Fatalf("expected sample 200 after seeking, got %d", v)
+	}
+	player.control(ctx, waterfallMessage{Command: CommandPause})
+	select {
+	case s := <-player.samples():
+		// At most the sample which was already due
+		if v := int(s.(models.Sample).Data[0]); v != 201 {
+			t.Fatalf("received sample %d while paused", v)
+		}
+	case <-time.After(100 * time.Millisecond):
+	}
+	select {
+	case <-player.samples():
+		t.Fatal("received a sample while paused")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	player.control(ctx, waterfallMessage{Command: CommandResume})
+	if v := next(); v < 201 || v > 202 {
+		t.Fatalf("expected the replay to resume where it was paused, got sample %d", v)
+	}
+}
+
+func TestReplaySameTime(t *testing.T) {
+	st, err := openStore("files:" + filepath.Join(t.TempDir(), "files"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = st.Close() })
+
+	previous := store
+	store = st
+	t.Cleanup(func() { store = previous })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Batches end in the middle of samples recorded in the same microsecond, and one of
+	// them only holds samples recorded at the same time
+	times := []int32{}
+	for range replayBatchSize - 2 {
+		times = append(times, 0)
+	}
+	for range replayBatchSize + 4 {
+		times = append(times, 1)
+	}
+	times = append(times, 2, 2, 3)
+
+	begin := time.Unix(1700000000, 0)
+	for i, micros := range times {
+		s := models.Sample{
+			SensorId:   "sensor",
+			CampaignId: "campaign",
+			SampleType: "PSD",
+			SampleTime: models.SampleTime{Seconds: begin.Unix(), Microseconds: micros},
+			Data:       []float32{float32(i)},
+		}
+		b, err := Encode(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = st.Append(ctx, b, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	settings := atomic.Pointer[waterfallMessage]{}
+	settings.Store(&waterfallMessage{Speed: 1})
+	player := replay(ctx, SampleQuery{CampaignId: "campaign", SensorId: "sensor"}, &settings)
+
+	for i := range times {
+		select {
+		case s := <-player.samples():
+			if v := int(s.(models.Sample).Data[0]); v != i {
+				t.Fatalf("expected sample %d, got %d", i, v)
+			}
+		case <-ctx.Done():
+			t.Fatalf("replay stopped after %d samples", i)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package samples
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/knadh/koanf"
+
+	"github.com/openrfsense/backend/database"
+	"github.com/openrfsense/backend/database/models"
+)
+
+// Type Retention tells for how long samples are kept, depending on their type. Samples
+// are kept forever if their retention is zero.
+type Retention struct {
+	// Retention of samples whose type is not listed in Types
+	Default time.Duration
+
+	// Retention of each sample type, with upper case keys (IQ, PSD, DEC)
+	Types map[string]time.Duration
+}
+
+// The retention rules of the running backend
+var retention Retention
+
+// Type garbageCollector is implemented by stores which need to be told when to reclaim
+// the space taken by expired or deleted samples.
+type garbageCollector interface {
+	// Reclaims unused space, as long as at least ratio of a file can be discarded.
+	// Returns the number of bytes reclaimed.
+	collectGarbage(ratio float64) (int64, error)
+}
+
+// Returns the retention rules set in retention.default and retention.types.
+func loadRetention(config *koanf.Koanf) Retention {
+	r := Retention{
+		Default: config.Duration("retention.default"),
+		Types:   map[string]time.Duration{},
+	}
+	for _, sampleType := range config.MapKeys("retention.types") {
+		r.Types[strings.ToUpper(sampleType)] = config.Duration("retention.types." + sampleType)
+	}
+
+	return r
+}
+
+// Returns for how long samples of the given type are kept, or zero if they are kept forever.
+func (r Retention) TTL(sampleType string) time.Duration {
+	ttl, ok := r.Types[strings.ToUpper(sampleType)]
+	if !ok {
+		return r.Default
+	}
+	return ttl
+}
+
+// Starts a background goroutine which periodically (every retention.interval) deletes
+// the samples of expired campaigns and, if the store needs it, reclaims unused space.
+// Nothing is started if the interval is zero.
+func StartRetention(ctx context.Context, config *koanf.Koanf) error {
+	if store == nil {
+		return ErrNoStore
+	}
+
+	interval := config.Duration("retention.interval")
+	if interval <= 0 {
+		return nil
+	}
+	ratio := config.Float64("retention.gcratio")
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			err := expireCampaigns(ctx, time.Now())
+			if err != nil {
+				log.Errorf("Could not expire campaigns: %v", err)
+			}
+
+			if gc, ok := store.(garbageCollector); ok {
+				reclaimed, err := gc.collectGarbage(ratio)
+				if err != nil {
+					log.Errorf("Could not collect garbage: %v", err)
+				} else if reclaimed > 0 {
+					log.Infof("Reclaimed %d bytes of sample storage", reclaimed)
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Deletes the samples of the active campaigns which ended longer than their retention
+// before now, and marks them as expired.
+func expireCampaigns(ctx context.Context, now time.Time) error {
+	sql, args, _ := database.Instance().
+		Select("*").
+		From("campaigns").
+		Where("status = ?", models.CampaignActive).
+		Where(`"end" < ?`, now).
+		ToSql()
+	campaigns, err := database.Multiple[models.Campaign](ctx, sql, args...)
+	if err != nil {
+		return err
+	}
+
+	for _, campaign := range campaigns {
+		ttl := retention.TTL(campaign.Type)
+		if ttl == 0 || now.Before(campaign.End.Add(ttl)) {
+			continue
+		}
+
+		err = store.DeleteCampaign(ctx, campaign.CampaignId)
+		if err != nil {
+			return err
+		}
+
+		sql, args, _ := database.Instance().
+			Update("campaigns").
+			Set("status", models.CampaignExpired).
+			Where("campaign_id = ?", campaign.CampaignId).
+			ToSql()
+		err = database.Do(ctx, sql, args...)
+		if err != nil {
+			return err
+		}
+
+		log.Infof("Campaign %s has expired", campaign.CampaignId)
+	}
+
+	return nil
+}
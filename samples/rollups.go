@@ -0,0 +1,498 @@
+package samples
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/knadh/koanf"
+
+	"github.com/openrfsense/backend/database"
+	"github.com/openrfsense/backend/database/models"
+)
+
+// Type Resolution is the length of the buckets of a rollup.
+type Resolution struct {
+	Name     string
+	Duration time.Duration
+}
+
+// Resolutions of rollups, from the finest to the coarsest. Each resolution is computed from
+// the previous one (the finest one from raw samples), so each duration must be a multiple
+// of the previous one.
+var Resolutions = []Resolution{
+	{Name: "1m", Duration: time.Minute},
+	{Name: "1h", Duration: time.Hour},
+	{Name: "1d", Duration: 24 * time.Hour},
+}
+
+var ErrUnknownResolution = errors.New("unknown resolution")
+
+// Returns the resolution with the given name.
+func ResolutionByName(name string) (Resolution, error) {
+	for _, res := range Resolutions {
+		if res.Name == name {
+			return res, nil
+		}
+	}
+	return Resolution{}, fmt.Errorf("%w %q", ErrUnknownResolution, name)
+}
+
+// Type rollupKey identifies the rollup a frame or a finer rollup is aggregated into.
+type rollupKey struct {
+	sensorId   string
+	start      int64
+	centerFreq int64
+}
+
+// Type accumulator aggregates PSD frames bin by bin.
+type accumulator struct {
+	count []int64
+	sum   []float64
+	min   []float32
+	max   []float32
+}
+
+// Adds the bins of a PSD frame.
+func (acc *accumulator) add(data []float32) {
+	acc.grow(len(data))
+	for i, v := range data {
+		acc.merge(i, 1, float64(v), v, v)
+	}
+}
+
+// Adds the bins of a finer rollup.
+func (acc *accumulator) addRollup(r models.Rollup) {
+	acc.grow(len(r.Count))
+	for i, count := range r.Count {
+		if count == 0 || i >= len(r.Mean) || i >= len(r.Min) || i >= len(r.Max) {
+			continue
+		}
+		acc.merge(i, count, float64(r.Mean[i])*float64(count), r.Min[i], r.Max[i])
+	}
+}
+
+func (acc *accumulator) merge(i int, count int64, sum float64, min float32, max float32) {
+	if acc.count[i] == 0 || min < acc.min[i] {
+		acc.min[i] = min
+	}
+	if acc.count[i] == 0 || max > acc.max[i] {
+		acc.max[i] = max
+	}
+	acc.count[i] += count
+	acc.sum[i] += sum
+}
+
+// Makes room for at least n bins. Frames of different lengths are aggregated bin by bin,
+// which is why each bin has its own count.
+func (acc *accumulator) grow(n int) {
+	for len(acc.count) < n {
+		acc.count = append(acc.count, 0)
+		acc.sum = append(acc.sum, 0)
+		acc.min = append(acc.min, 0)
+		acc.max = append(acc.max, 0)
+	}
+}
+
+// Returns the rollup of all aggregated bins.
+func (acc *accumulator) rollup(campaignId string, res Resolution, key rollupKey) models.Rollup {
+	r := models.Rollup{
+		SensorId:   key.sensorId,
+		CampaignId: campaignId,
+		Resolution: res.Name,
+		Start:      time.Unix(key.start, 0).UTC(),
+		CenterFreq: key.centerFreq,
+		Count:      acc.count,
+		Min:        acc.min,
+		Mean:       make([]float32, len(acc.sum)),
+		Max:        acc.max,
+	}
+	for i, sum := range acc.sum {
+		if acc.count[i] > 0 {
+			r.Mean[i] = float32(sum / float64(acc.count[i]))
+		}
+	}
+
+	return r
+}
+
+// Type rollupBuilder aggregates frames or finer rollups into the buckets of a resolution.
+type rollupBuilder struct {
+	campaignId string
+	res        Resolution
+	buckets    map[rollupKey]*accumulator
+}
+
+func newRollupBuilder(campaignId string, res Resolution) *rollupBuilder {
+	return &rollupBuilder{
+		campaignId: campaignId,
+		res:        res,
+		buckets:    map[rollupKey]*accumulator{},
+	}
+}
+
+func (rb *rollupBuilder) bucket(sensorId string, t time.Time, centerFreq int64) *accumulator {
+	key := rollupKey{
+		sensorId:   sensorId,
+		start:      t.Truncate(rb.res.Duration).Unix(),
+		centerFreq: centerFreq,
+	}
+
+	acc, ok := rb.buckets[key]
+	if !ok {
+		acc = &accumulator{}
+		rb.buckets[key] = acc
+	}
+	return acc
+}
+
+func (rb *rollupBuilder) addSample(s models.Sample) error {
+	rb.bucket(s.SensorId, sampleTime(s), s.SampleConfig.CenterFreq).add(s.Data)
+	return nil
+}
+
+func (rb *rollupBuilder) addRollup(r models.Rollup) error {
+	rb.bucket(r.SensorId, r.Start, r.CenterFreq).addRollup(r)
+	return nil
+}
+
+// Returns all rollups, sorted by sensor, time and center frequency.
+func (rb *rollupBuilder) rollups() []models.Rollup {
+	keys := make([]rollupKey, 0, len(rb.buckets))
+	for key := range rb.buckets {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].sensorId != keys[j].sensorId {
+			return keys[i].sensorId < keys[j].sensorId
+		}
+		if keys[i].start != keys[j].start {
+			return keys[i].start < keys[j].start
+		}
+		return keys[i].centerFreq < keys[j].centerFreq
+	})
+
+	rollups := make([]models.Rollup, 0, len(keys))
+	for _, key := range keys {
+		rollups = append(rollups, rb.buckets[key].rollup(rb.campaignId, rb.res, key))
+	}
+	return rollups
+}
+
+// Starts a background goroutine which periodically (every rollups.interval) aggregates
+// the PSD frames of active campaigns into rollups. Buckets are aggregated once they ended
+// more than rollups.lag ago. Samples stored after their bucket was aggregated (samples
+// sent in batches, released from the quarantine...) mark it as stale, and stale buckets
+// are aggregated again. Nothing is started if the interval is zero.
+func StartRollups(ctx context.Context, config *koanf.Koanf) error {
+	if store == nil {
+		return ErrNoStore
+	}
+
+	interval := config.Duration("rollups.interval")
+	if interval <= 0 {
+		return nil
+	}
+	lag := config.Duration("rollups.lag")
+	tolerance := config.Duration("collector.tolerance")
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			err := rollUp(ctx, time.Now().Add(-lag), tolerance)
+			if err != nil {
+				log.Errorf("Could not roll up samples: %v", err)
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Aggregates the PSD frames of all active campaigns recorded before the given time, and
+// aggregates their stale buckets again. Campaigns whose last buckets were aggregated are
+// skipped, unless some of their buckets are stale.
+func rollUp(ctx context.Context, until time.Time, tolerance time.Duration) error {
+	sql, args, _ := database.Instance().
+		Select("*").
+		From("campaigns").
+		Where("status = ?", models.CampaignActive).
+		Where(`"type" = ?`, "PSD").
+		Where(`"begin" < ?`, until).
+		Where(
+			`(not exists (
+				select 1 from rollup_progress p
+				where p.campaign_id = campaigns.campaign_id and p.resolution = ? and p.until >= campaigns."end" + make_interval(secs => ?)
+			) or exists (
+				select 1 from rollup_stale s where s.campaign_id = campaigns.campaign_id
+			))`,
+			Resolutions[len(Resolutions)-1].Name,
+			tolerance.Seconds(),
+		).
+		ToSql()
+	campaigns, err := database.Multiple[models.Campaign](ctx, sql, args...)
+	if err != nil {
+		return err
+	}
+
+	for _, campaign := range campaigns {
+		// Once no more samples can be accepted for the campaign, its last buckets are
+		// complete as well
+		end := campaign.End.Add(tolerance)
+		final := !end.After(until)
+		if !final {
+			end = until
+		}
+
+		err = rollUpCampaign(ctx, campaign, campaign.Begin.Add(-tolerance), end, final)
+		if err == nil {
+			err = rollUpStale(ctx, campaign)
+		}
+		if err != nil {
+			return fmt.Errorf("campaign %s: %w", campaign.CampaignId, err)
+		}
+	}
+
+	return nil
+}
+
+// Aggregates the frames of a campaign recorded between begin and until, in each resolution,
+// starting where the last run stopped. Complete buckets of the finest resolution are
+// computed from raw samples, then each resolution from the previous one. If final is
+// true, no more samples will be recorded after until, so the buckets which contain it
+// are complete.
+func rollUpCampaign(ctx context.Context, campaign models.Campaign, begin time.Time, until time.Time, final bool) error {
+	for i, res := range Resolutions {
+		from, err := rollupProgress(ctx, campaign.CampaignId, res)
+		if err != nil {
+			return err
+		}
+		if from.IsZero() {
+			from = begin.Truncate(res.Duration)
+		}
+
+		to := until.Truncate(res.Duration)
+		if final && to.Before(until) {
+			to = to.Add(res.Duration)
+		}
+		if i > 0 {
+			// Coarser buckets need all finer buckets to be complete
+			finer, err := rollupProgress(ctx, campaign.CampaignId, Resolutions[i-1])
+			if err != nil {
+				return err
+			}
+			if !final || finer.Before(until) {
+				to = finer.Truncate(res.Duration)
+			}
+		}
+		if !to.After(from) {
+			continue
+		}
+
+		if i == 0 {
+			// Samples stored from now on in these buckets might not be seen while they are
+			// aggregated, so they mark their bucket as stale
+			rolledUp.advance(campaign.CampaignId, to)
+		}
+
+		err = aggregate(ctx, campaign.CampaignId, i, campaign.Sensors, from, to)
+		if err != nil {
+			return err
+		}
+
+		err = setRollupProgress(ctx, campaign.CampaignId, res, to)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Aggregates the frames (or the finer rollups) recorded by the given sensors between from
+// and to into the buckets of the i-th resolution, replacing the existing rollups.
+func aggregate(ctx context.Context, campaignId string, i int, sensors []string, from time.Time, to time.Time) error {
+	rb := newRollupBuilder(campaignId, Resolutions[i])
+	for _, sensorId := range sensors {
+		q := SampleQuery{CampaignId: campaignId, SensorId: sensorId, From: from, To: to}
+
+		var err error
+		if i == 0 {
+			err = store.Range(ctx, q, rb.addSample)
+		} else {
+			err = store.RangeRollups(ctx, Resolutions[i-1].Name, q, rb.addRollup)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, rollup := range rb.rollups() {
+		err := store.AppendRollup(ctx, rollup)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Type staleBucket is a bucket of the finest resolution which received samples after it
+// was aggregated.
+type staleBucket struct {
+	SensorId string `db:"sensor_id"`
+	Start    time.Time
+	MarkedAt time.Time `db:"marked_at"`
+}
+
+// Aggregates the stale buckets of a campaign again, along with the coarser buckets which
+// contain them and were already aggregated.
+func rollUpStale(ctx context.Context, campaign models.Campaign) error {
+	sql, args, _ := database.Instance().
+		Select("sensor_id", `"start"`, "marked_at").
+		From("rollup_stale").
+		Where("campaign_id = ?", campaign.CampaignId).
+		ToSql()
+	stale, err := database.Multiple[staleBucket](ctx, sql, args...)
+	if err != nil || len(stale) == 0 {
+		return err
+	}
+
+	for i, res := range Resolutions {
+		until, err := rollupProgress(ctx, campaign.CampaignId, res)
+		if err != nil {
+			return err
+		}
+
+		done := map[rollupKey]bool{}
+		for _, bucket := range stale {
+			// Buckets which were not aggregated yet will be aggregated with the others
+			start := bucket.Start.Truncate(res.Duration)
+			key := rollupKey{sensorId: bucket.SensorId, start: start.Unix()}
+			if !start.Before(until) || done[key] {
+				continue
+			}
+			done[key] = true
+
+			err = aggregate(ctx, campaign.CampaignId, i, []string{bucket.SensorId}, start, start.Add(res.Duration))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, bucket := range stale {
+		// Buckets marked again in the meantime stay stale
+		sql, args, _ := database.Instance().
+			Delete("rollup_stale").
+			Where("campaign_id = ?", campaign.CampaignId).
+			Where("sensor_id = ?", bucket.SensorId).
+			Where(`"start" = ?`, bucket.Start).
+			Where("marked_at = ?", bucket.MarkedAt).
+			ToSql()
+		err = database.Do(ctx, sql, args...)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Type rolledUpCache holds the time until which the finest buckets of each campaign are
+// (or are being) aggregated, so that samples stored too late to be aggregated with their
+// bucket can be told apart without querying the database each time.
+type rolledUpCache struct {
+	until map[string]time.Time
+	sync.Mutex
+}
+
+var rolledUp = rolledUpCache{until: map[string]time.Time{}}
+
+// Returns the time until which the finest buckets of a campaign are aggregated.
+func (c *rolledUpCache) get(ctx context.Context, campaignId string) (time.Time, error) {
+	c.Lock()
+	until, ok := c.until[campaignId]
+	c.Unlock()
+	if ok {
+		return until, nil
+	}
+
+	until, err := rollupProgress(ctx, campaignId, Resolutions[0])
+	if err != nil {
+		return time.Time{}, err
+	}
+	return c.advance(campaignId, until), nil
+}
+
+// Moves the time until which the finest buckets of a campaign are aggregated forward, and
+// returns it.
+func (c *rolledUpCache) advance(campaignId string, until time.Time) time.Time {
+	c.Lock()
+	defer c.Unlock()
+
+	current, ok := c.until[campaignId]
+	if !ok || until.After(current) {
+		c.until[campaignId] = until
+		return until
+	}
+	return current
+}
+
+// Marks the finest bucket of a stored sample as stale if it was already aggregated, so
+// that it is aggregated again along with the coarser buckets which contain it.
+func markStale(ctx context.Context, s models.Sample) error {
+	t := sampleTime(s)
+	until, err := rolledUp.get(ctx, s.CampaignId)
+	if err != nil || !t.Before(until) {
+		return err
+	}
+
+	sql, args, _ := database.Instance().
+		Insert("rollup_stale").
+		Columns("campaign_id", "sensor_id", "start").
+		Values(s.CampaignId, s.SensorId, t.Truncate(Resolutions[0].Duration)).
+		Suffix(`on conflict ("campaign_id", "sensor_id", "start") do update set "marked_at" = now()`).
+		ToSql()
+	return database.Do(ctx, sql, args...)
+}
+
+// Returns the time until which the campaign has been aggregated at the given resolution,
+// or zero if it never was.
+func rollupProgress(ctx context.Context, campaignId string, res Resolution) (time.Time, error) {
+	sql, args, _ := database.Instance().
+		Select("until").
+		From("rollup_progress").
+		Where("campaign_id = ?", campaignId).
+		Where("resolution = ?", res.Name).
+		ToSql()
+
+	var until time.Time
+	err := database.Instance().QueryRow(ctx, sql, args...).Scan(&until)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return time.Time{}, nil
+	}
+	return until, err
+}
+
+func setRollupProgress(ctx context.Context, campaignId string, res Resolution, until time.Time) error {
+	sql, args, _ := database.Instance().
+		Insert("rollup_progress").
+		Columns("campaign_id", "resolution", "until").
+		Values(campaignId, res.Name, until).
+		Suffix(`on conflict ("campaign_id", "resolution") do update set "until" = excluded."until"`).
+		ToSql()
+	return database.Do(ctx, sql, args...)
+}
@@ -0,0 +1,68 @@
+package samples
+
+import (
+	"testing"
+	"time"
+
+	"github.com/openrfsense/backend/database/models"
+)
+
+func TestRollupBuilder(t *testing.T) {
+	begin := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	frames := []struct {
+		offset time.Duration
+		data   []float32
+	}{
+		{0, []float32{1, 4}},
+		{30 * time.Second, []float32{3, 2, 5}},
+		{90 * time.Second, []float32{6, 6}},
+	}
+
+	minutes := newRollupBuilder("campaign", Resolutions[0])
+	for _, frame := range frames {
+		t := begin.Add(frame.offset)
+		_ = minutes.addSample(models.Sample{
+			SensorId:     "sensor",
+			SampleTime:   models.SampleTime{Seconds: t.Unix()},
+			SampleConfig: models.SampleConfig{CenterFreq: 100},
+			Data:         frame.data,
+		})
+	}
+
+	rollups := minutes.rollups()
+	if len(rollups) != 2 || !rollups[0].Start.Equal(begin) || !rollups[1].Start.Equal(begin.Add(time.Minute)) {
+		t.Fatalf("expected two minute buckets, got %+v", rollups)
+	}
+	first := rollups[0]
+	if first.Count[0] != 2 || first.Count[2] != 1 || first.Min[1] != 2 || first.Max[1] != 4 || first.Mean[0] != 2 {
+		t.Fatalf("unexpected first bucket %+v", first)
+	}
+
+	// Coarser buckets are computed from finer ones, weighted by their counts
+	hours := newRollupBuilder("campaign", Resolutions[1])
+	for _, r := range rollups {
+		_ = hours.addRollup(r)
+	}
+
+	rollups = hours.rollups()
+	if len(rollups) != 1 {
+		t.Fatalf("expected a single hour bucket, got %+v", rollups)
+	}
+	hour := rollups[0]
+	if hour.Count[0] != 3 || hour.Mean[0] != float32(10)/3 || hour.Min[0] != 1 || hour.Max[0] != 6 || hour.Count[2] != 1 {
+		t.Fatalf("unexpected hour bucket %+v", hour)
+	}
+}
+
+func TestPickResolution(t *testing.T) {
+	cases := map[time.Duration]string{
+		time.Hour:            "1m",
+		30 * 24 * time.Hour:  "1h",
+		365 * 24 * time.Hour: "1d",
+	}
+	for span, expected := range cases {
+		if res := pickResolution(span, 1000); res.Name != expected {
+			t.Errorf("expected %s for %s, got %s", expected, span, res.Name)
+		}
+	}
+}
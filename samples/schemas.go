@@ -0,0 +1,184 @@
+package samples
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/hamba/avro/v2"
+
+	"github.com/openrfsense/backend/database/models"
+)
+
+// Samples may be sent in Avro single-object encoding: a two byte marker followed by the
+// little endian CRC-64-AVRO fingerprint of the writer schema and by the Avro payload.
+// Samples without the marker are assumed to have been written with DefaultSchema. All
+// samples are stored in single-object encoding, so that the schema they were written
+// with is always known. The marker cannot be mistaken for the beginning of a sample
+// written with DefaultSchema, as it would be a negative string length.
+var singleObjectMarker = []byte{0xC3, 0x01}
+
+const singleObjectHeaderSize = 10
+
+var ErrUnknownSchema = errors.New("unknown writer schema")
+
+// Writer schemas known to the backend, by fingerprint
+var (
+	writers   = map[uint64]avro.Schema{}
+	writersMu sync.RWMutex
+)
+
+// Fingerprint of DefaultSchema
+var defaultFingerprint uint64
+
+// Returns the CRC-64-AVRO fingerprint of a schema.
+func fingerprint(schema avro.Schema) (uint64, error) {
+	fp, err := schema.FingerprintUsing(avro.CRC64Avro)
+	if err != nil {
+		return 0, err
+	}
+
+	return binary.BigEndian.Uint64(fp), nil
+}
+
+// Adds a writer schema to the registry. Samples written with this schema are resolved to
+// DefaultSchema, so the two must be compatible. Returns the fingerprint of the schema.
+func RegisterSchema(schema avro.Schema) (uint64, error) {
+	err := avro.NewSchemaCompatibility().Compatible(DefaultSchema, schema)
+	if err != nil {
+		return 0, err
+	}
+
+	fp, err := fingerprint(schema)
+	if err != nil {
+		return 0, err
+	}
+
+	writersMu.Lock()
+	writers[fp] = schema
+	writersMu.Unlock()
+
+	return fp, nil
+}
+
+// Registers all writer schemas (.avsc files) found in a directory.
+func LoadSchemas(dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.avsc"))
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		text, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+
+		schema, err := avro.Parse(string(text))
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+
+		fp, err := RegisterSchema(schema)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+
+		log.Debugf("Registered writer schema %016x from %s", fp, file)
+	}
+
+	return nil
+}
+
+// Returns all writer schemas known to the backend.
+func Schemas() []models.SampleSchema {
+	writersMu.RLock()
+	defer writersMu.RUnlock()
+
+	all := make([]models.SampleSchema, 0, len(writers))
+	for fp, schema := range writers {
+		all = append(all, models.SampleSchema{
+			Fingerprint: fmt.Sprintf("%016x", fp),
+			Current:     fp == defaultFingerprint,
+			Schema:      []byte(schema.String()),
+		})
+	}
+
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].Fingerprint < all[j].Fingerprint
+	})
+	return all
+}
+
+// Decodes a sample written with any known schema, resolving it to DefaultSchema. Fields
+// unknown to DefaultSchema are dropped, and fields missing from the writer schema are
+// left empty.
+func Decode(b []byte) (models.Sample, error) {
+	s := models.Sample{}
+	schema, payload, err := writerSchema(b)
+	if err != nil {
+		return s, err
+	}
+
+	err = avro.Unmarshal(schema, payload, &s)
+	return s, err
+}
+
+// Encodes a sample with DefaultSchema, in single-object encoding.
+func Encode(s models.Sample) ([]byte, error) {
+	payload, err := avro.Marshal(DefaultSchema, s)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(singleObjectHeader(defaultFingerprint), payload...), nil
+}
+
+// Decodes a sample and returns it in the single-object encoding used for storage, which
+// keeps the original payload and records its writer schema.
+func normalize(b []byte) ([]byte, models.Sample, error) {
+	s, err := Decode(b)
+	if err != nil {
+		return nil, s, err
+	}
+
+	if isSingleObject(b) {
+		return b, s, nil
+	}
+
+	return append(singleObjectHeader(defaultFingerprint), b...), s, nil
+}
+
+// Returns the writer schema of a sample and its Avro payload.
+func writerSchema(b []byte) (avro.Schema, []byte, error) {
+	if !isSingleObject(b) {
+		return DefaultSchema, b, nil
+	}
+
+	fp := binary.LittleEndian.Uint64(b[2:singleObjectHeaderSize])
+	writersMu.RLock()
+	schema, ok := writers[fp]
+	writersMu.RUnlock()
+	if !ok {
+		return nil, nil, fmt.Errorf("%w %016x", ErrUnknownSchema, fp)
+	}
+
+	return schema, b[singleObjectHeaderSize:], nil
+}
+
+func isSingleObject(b []byte) bool {
+	return len(b) >= singleObjectHeaderSize &&
+		b[0] == singleObjectMarker[0] &&
+		b[1] == singleObjectMarker[1]
+}
+
+func singleObjectHeader(fp uint64) []byte {
+	header := make([]byte, singleObjectHeaderSize)
+	copy(header, singleObjectMarker)
+	binary.LittleEndian.PutUint64(header[2:], fp)
+	return header
+}
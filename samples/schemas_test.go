@@ -0,0 +1,92 @@
+package samples
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/hamba/avro/v2"
+
+	"github.com/openrfsense/backend/database/models"
+)
+
+// Returns a newer version of the default schema with an additional optional field.
+func newerSchema(t *testing.T) avro.Schema {
+	text, err := schemasFs.ReadFile("sample.avsc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	record := map[string]any{}
+	_ = json.Unmarshal(text, &record)
+	record["fields"] = append(record["fields"].([]any), map[string]any{
+		"name":    "lossRate",
+		"type":    []any{"null", "double"},
+		"default": nil,
+	})
+	text, _ = json.Marshal(record)
+
+	return avro.MustParse(string(text))
+}
+
+func TestSchemaResolution(t *testing.T) {
+	lossRate := 0.5
+	sample := models.Sample{
+		SensorId:   "sensor",
+		CampaignId: "campaign",
+		SampleType: "PSD",
+		Data:       []float32{0.1},
+		LossRate:   &lossRate,
+	}
+
+	// Samples without a fingerprint use the default schema
+	legacy, err := avro.Marshal(DefaultSchema, sample)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := Decode(legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.SensorId != "sensor" || decoded.LossRate != nil {
+		t.Fatalf("unexpected sample %+v", decoded)
+	}
+
+	// Samples written with a newer schema can only be decoded once it is registered
+	writer := newerSchema(t)
+	fp, err := fingerprint(writer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := avro.Marshal(writer, sample)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded := append(singleObjectHeader(fp), payload...)
+
+	_, err = Decode(encoded)
+	if !errors.Is(err, ErrUnknownSchema) {
+		t.Fatalf("expected unknown schema, got %v", err)
+	}
+
+	_, err = RegisterSchema(writer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err = Decode(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.CampaignId != "campaign" || decoded.LossRate == nil || *decoded.LossRate != lossRate {
+		t.Fatalf("unexpected sample %+v", decoded)
+	}
+
+	// Stored samples always record their writer schema
+	stored, _, err := normalize(legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isSingleObject(stored) {
+		t.Fatal("stored sample does not record its schema")
+	}
+}
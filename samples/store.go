@@ -0,0 +1,173 @@
+package samples
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/knadh/koanf"
+	"github.com/reugn/go-streams"
+
+	"github.com/openrfsense/backend/database/models"
+)
+
+var ErrNoStore = errors.New("sample store is not open")
+
+// Type SampleStore persists the samples accepted by the collector and reads them back.
+// All readers (the API, the WebSocket streamer, exporters) go through the same store.
+type SampleStore interface {
+	// Stores a sample. The sample is given both as encoded by normalize (which is what
+	// gets stored, if the store keeps encoded samples) and decoded.
+	Append(ctx context.Context, b []byte, s models.Sample) error
+
+	// Calls fn for each stored sample which matches the query. The samples of each sensor
+	// are sorted by time, as long as the sensor sent them in order. Stops at the first
+	// error returned by fn and returns it.
+	Range(ctx context.Context, q SampleQuery, fn func(models.Sample) error) error
+
+	// Deletes all samples of a campaign. Rollups are kept.
+	DeleteCampaign(ctx context.Context, campaignId string) error
+
+	// Stores a rollup, replacing any rollup of the same sensor, resolution, bucket and
+	// center frequency.
+	AppendRollup(ctx context.Context, r models.Rollup) error
+
+	// Calls fn for each stored rollup of the given resolution whose bucket starts in the
+	// queried time range. The rollups of each sensor are sorted by time, then by center
+	// frequency. Stops at the first error returned by fn and returns it.
+	RangeRollups(ctx context.Context, resolution string, q SampleQuery, fn func(models.Rollup) error) error
+
+	// Returns the number of stored samples and the space they take.
+	Stats(ctx context.Context) (models.StoreStats, error)
+
+	// Flushes all pending writes and releases the store.
+	Close() error
+}
+
+// Type SampleQuery selects the samples of a campaign, optionally restricted to a single
+// sensor and to a time range.
+type SampleQuery struct {
+	CampaignId string
+
+	// All sensors of the campaign if empty
+	SensorId string
+
+	// Samples recorded at or after this time, unbounded if zero
+	From time.Time
+
+	// Samples recorded strictly before this time, unbounded if zero
+	To time.Time
+}
+
+// The store of the running backend
+var store SampleStore
+
+// Opens the sample store selected by backend.storage, which is one of:
+//   - badger:<directory> (or just a directory): Badger key-value store
+//   - files:<directory>: plain segment files, one directory per campaign and sensor
+//   - postgres: the samples table in the PostgreSQL database (requires database.Init)
+//
+// The retention rules in the retention section are loaded as well.
+func OpenStore(config *koanf.Koanf) error {
+	retention = loadRetention(config)
+
+	var err error
+	store, err = openStore(config.MustString("backend.storage"))
+	return err
+}
+
+// Returns the store of the running backend, or nil if it was not opened yet.
+func Store() SampleStore {
+	return store
+}
+
+// Closes the store of the running backend.
+func CloseStore() error {
+	if store == nil {
+		return nil
+	}
+	return store.Close()
+}
+
+func openStore(location string) (SampleStore, error) {
+	kind, path, found := strings.Cut(location, ":")
+	if !found {
+		return newBadgerStore(location)
+	}
+
+	switch kind {
+	case "badger":
+		return newBadgerStore(path)
+	case "files":
+		return newFileStore(path)
+	case "postgres":
+		return newPostgresStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown sample store %q", kind)
+	}
+}
+
+// Returns the time at which a sample was recorded.
+func sampleTime(s models.Sample) time.Time {
+	return time.Unix(s.SampleTime.Seconds, int64(s.SampleTime.Microseconds)*int64(time.Microsecond))
+}
+
+// Returns the time corresponding to a number of microseconds since the epoch.
+func timeFromMicros(micros uint64) time.Time {
+	return time.UnixMicro(int64(micros))
+}
+
+// Returns true if the query selects samples recorded at the given time.
+func (q SampleQuery) includes(t time.Time) bool {
+	if !q.From.IsZero() && t.Before(q.From) {
+		return false
+	}
+	if !q.To.IsZero() && !t.Before(q.To) {
+		return false
+	}
+	return true
+}
+
+var _ streams.Sink = (*storeSink)(nil)
+
+// Type storeSink is the last step of the collector pipeline, which writes the samples it
+// receives to a store.
+type storeSink struct {
+	in chan any
+}
+
+func newStoreSink(ctx context.Context, st SampleStore) *storeSink {
+	sink := &storeSink{
+		in: make(chan any),
+	}
+
+	go func() {
+		for elem := range sink.in {
+			b := elem.([]byte)
+			s, err := Decode(b)
+			if err != nil {
+				log.Error(err)
+				continue
+			}
+
+			err = st.Append(ctx, b, s)
+			if err != nil {
+				log.Errorf("Could not store sample from sensor %s: %v", s.SensorId, err)
+				continue
+			}
+
+			err = markStale(ctx, s)
+			if err != nil {
+				log.Errorf("Could not mark the rollups of sensor %s as stale: %v", s.SensorId, err)
+			}
+		}
+	}()
+
+	return sink
+}
+
+func (sink *storeSink) In() chan<- any {
+	return sink.in
+}
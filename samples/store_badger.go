@@ -0,0 +1,629 @@
+package samples
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/dgraph-io/badger/v3/pb"
+	"github.com/openrfsense/common/id"
+
+	"github.com/openrfsense/backend/database/models"
+	"github.com/openrfsense/backend/metrics"
+)
+
+const (
+	// Samples are stored under samples/<campaign ID>/<sensor ID>/<time><sequence>, where
+	// the time is in microseconds since the epoch and both are big endian, so that the
+	// samples of each sensor are sorted by time. IDs are escaped (see badgerKeyPart), so
+	// that the prefix of a sensor never matches the samples of another one
+	badgerSampleKeys = "samples/"
+
+	// Sequences which tell apart samples recorded at the same time by the same sensor
+	badgerSequenceKeys = "sequences/"
+
+	// Markers written to find out when a subscription is active
+	badgerMarkerKeys = "markers/"
+
+	// How often markers are written until the subscription sees them
+	badgerMarkerInterval = 10 * time.Millisecond
+
+	// Rollups are stored as JSON under rollups/<resolution>/<campaign ID>/<sensor ID>/<start>
+	// <center frequency>, where the start of the bucket is in microseconds since the epoch
+	badgerRollupKeys = "rollups/"
+
+	// Holds the version of the key layout, once samples stored with the legacy layout were
+	// moved (see migrate)
+	badgerLayoutKey = "meta/layout"
+
+	// Number of sequence numbers leased at once
+	badgerSequenceBandwidth = 1000
+
+	// Length of the time and sequence suffix of sample keys
+	badgerKeySuffixLength = 16
+)
+
+var (
+	_ SampleStore      = (*badgerStore)(nil)
+	_ Follower         = (*badgerStore)(nil)
+	_ garbageCollector = (*badgerStore)(nil)
+)
+
+// Type badgerStore stores encoded samples in a Badger database.
+type badgerStore struct {
+	db  *badger.DB
+	dir string
+
+	mu        sync.Mutex
+	sequences map[string]*badger.Sequence
+
+	// Space reclaimed by value log garbage collection and time of the last collection
+	reclaimed atomic.Int64
+	lastGC    atomic.Pointer[time.Time]
+}
+
+func newBadgerStore(dir string) (*badgerStore, error) {
+	opts := badger.DefaultOptions(dir)
+	opts.SyncWrites = true
+	db, err := badger.Open(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	bs := &badgerStore{
+		db:        db,
+		dir:       dir,
+		sequences: map[string]*badger.Sequence{},
+	}
+
+	err = bs.migrate()
+	if err != nil {
+		_ = bs.Close()
+		return nil, err
+	}
+
+	return bs, nil
+}
+
+func (bs *badgerStore) Append(_ context.Context, b []byte, s models.Sample) error {
+	entry, err := bs.entry(b, s)
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+	err = bs.db.Update(func(txn *badger.Txn) error {
+		return txn.SetEntry(entry)
+	})
+	metrics.BadgerWriteDuration.Observe(time.Since(start).Seconds())
+	return err
+}
+
+func (bs *badgerStore) Range(ctx context.Context, q SampleQuery, fn func(models.Sample) error) error {
+	return bs.db.View(func(txn *badger.Txn) error {
+		return rangeTxn(ctx, txn, q, fn)
+	})
+}
+
+// Calls fn for each stored sample which matches the query, like Range, then for each
+// matching sample written afterwards, until the context is done or fn returns an error.
+// No sample is skipped or repeated between the two. Returns ErrFollowerTooSlow if fn
+// cannot keep up with new samples.
+func (bs *badgerStore) Follow(ctx context.Context, q SampleQuery, fn func(models.Sample) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	prefix := badgerCampaignPrefix(q.CampaignId)
+	if q.SensorId != "" {
+		prefix = badgerSensorPrefix(q.CampaignId, q.SensorId)
+	}
+
+	// Badger does not tell when a subscription is active, so a marker is written until
+	// the subscription sees it: anything written afterwards will be seen too
+	marker := []byte(badgerMarkerKeys + id.Generate(16))
+	subscription := newFollowQueue()
+	subscribed := make(chan error, 1)
+	go func() {
+		subscribed <- bs.db.Subscribe(ctx, func(list *badger.KVList) error {
+			for _, kv := range list.Kv {
+				if bytes.Equal(kv.Key, marker) {
+					subscription.ready()
+					continue
+				}
+				if !subscription.push(kv) {
+					return ErrFollowerTooSlow
+				}
+			}
+			return nil
+		}, []pb.Match{{Prefix: prefix}, {Prefix: marker}})
+	}()
+
+	err := bs.waitForSubscription(ctx, marker, subscription, subscribed)
+	if err != nil {
+		return err
+	}
+
+	// Samples written after the snapshot are delivered by the subscription
+	var readTs uint64
+	err = bs.db.View(func(txn *badger.Txn) error {
+		readTs = txn.ReadTs()
+		return rangeTxn(ctx, txn, q, fn)
+	})
+	if err != nil {
+		return err
+	}
+
+	for {
+		kvs, err := subscription.pop(ctx, subscribed)
+		if err != nil {
+			return err
+		}
+
+		for _, kv := range kvs {
+			if kv.Version <= readTs || len(kv.Key) < len(prefix)+badgerKeySuffixLength {
+				continue
+			}
+			if !q.includes(badgerKeyTime(kv.Key)) {
+				continue
+			}
+
+			s, err := Decode(kv.Value)
+			if err != nil {
+				log.Error(err)
+				continue
+			}
+
+			err = fn(s)
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Writes the marker until the subscription sees it.
+func (bs *badgerStore) waitForSubscription(ctx context.Context, marker []byte, subscription *followQueue, subscribed <-chan error) error {
+	ticker := time.NewTicker(badgerMarkerInterval)
+	defer ticker.Stop()
+
+	for {
+		err := bs.db.Update(func(txn *badger.Txn) error {
+			return txn.SetEntry(badger.NewEntry(marker, nil).WithTTL(time.Minute))
+		})
+		if err != nil {
+			return err
+		}
+
+		select {
+		case <-subscription.isReady:
+			return nil
+		case err := <-subscribed:
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Calls fn for each sample which matches the query, as seen by the transaction.
+func rangeTxn(ctx context.Context, txn *badger.Txn, q SampleQuery, fn func(models.Sample) error) error {
+	prefix := badgerCampaignPrefix(q.CampaignId)
+	seek := prefix
+	if q.SensorId != "" {
+		prefix = badgerSensorPrefix(q.CampaignId, q.SensorId)
+		seek = prefix
+		if !q.From.IsZero() {
+			seek = append(append([]byte{}, prefix...), itob(timeMicros(q.From))...)
+		}
+	}
+
+	opts := badger.DefaultIteratorOptions
+	opts.Prefix = prefix
+	it := txn.NewIterator(opts)
+	defer it.Close()
+
+	for it.Seek(seek); it.ValidForPrefix(prefix); it.Next() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		key := it.Item().Key()
+		if len(key) < badgerKeySuffixLength {
+			continue
+		}
+		recorded := badgerKeyTime(key)
+		if !q.includes(recorded) {
+			// The samples of a single sensor are sorted by time
+			if q.SensorId != "" && !q.To.IsZero() && !recorded.Before(q.To) {
+				return nil
+			}
+			continue
+		}
+
+		b, err := it.Item().ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+		s, err := Decode(b)
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+
+		err = fn(s)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (bs *badgerStore) DeleteCampaign(_ context.Context, campaignId string) error {
+	sequencePrefix := badgerSequenceKeys + badgerKeyPart(campaignId) + "/"
+
+	bs.mu.Lock()
+	for key, seq := range bs.sequences {
+		if strings.HasPrefix(key, sequencePrefix) {
+			_ = seq.Release()
+			delete(bs.sequences, key)
+		}
+	}
+	bs.mu.Unlock()
+
+	return bs.db.DropPrefix(badgerCampaignPrefix(campaignId), []byte(sequencePrefix))
+}
+
+func (bs *badgerStore) AppendRollup(_ context.Context, r models.Rollup) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	key := badgerRollupPrefix(r.Resolution, r.CampaignId, r.SensorId)
+	key = append(key, itob(timeMicros(r.Start))...)
+	key = append(key, itob(uint64(r.CenterFreq))...)
+
+	return bs.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(key, b)
+	})
+}
+
+func (bs *badgerStore) RangeRollups(ctx context.Context, resolution string, q SampleQuery, fn func(models.Rollup) error) error {
+	prefix := badgerRollupPrefix(resolution, q.CampaignId)
+	seek := prefix
+	if q.SensorId != "" {
+		prefix = badgerRollupPrefix(resolution, q.CampaignId, q.SensorId)
+		seek = prefix
+		if !q.From.IsZero() {
+			seek = append(append([]byte{}, prefix...), itob(timeMicros(q.From))...)
+		}
+	}
+
+	return bs.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = prefix
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Seek(seek); it.ValidForPrefix(prefix); it.Next() {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			key := it.Item().Key()
+			if len(key) < badgerKeySuffixLength {
+				continue
+			}
+			start := badgerKeyTime(key)
+			if !q.includes(start) {
+				if q.SensorId != "" && !q.To.IsZero() && !start.Before(q.To) {
+					return nil
+				}
+				continue
+			}
+
+			r := models.Rollup{}
+			err := it.Item().Value(func(b []byte) error {
+				return json.Unmarshal(b, &r)
+			})
+			if err != nil {
+				return err
+			}
+
+			err = fn(r)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (bs *badgerStore) Stats(ctx context.Context) (models.StoreStats, error) {
+	stats := models.StoreStats{
+		Backend:       "badger",
+		Reclaimed:     bs.reclaimed.Load(),
+		LastCollected: bs.lastGC.Load(),
+	}
+	lsm, vlog := bs.db.Size()
+	stats.Bytes = lsm + vlog
+
+	err := bs.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		opts.Prefix = []byte(badgerSampleKeys)
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Rewind(); it.Valid(); it.Next() {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			stats.Samples++
+		}
+
+		return nil
+	})
+
+	return stats, err
+}
+
+func (bs *badgerStore) Close() error {
+	bs.mu.Lock()
+	for _, seq := range bs.sequences {
+		err := seq.Release()
+		if err != nil {
+			log.Error(err)
+		}
+	}
+	bs.sequences = map[string]*badger.Sequence{}
+	bs.mu.Unlock()
+
+	err := bs.db.Sync()
+	if err != nil {
+		return err
+	}
+	return bs.db.Close()
+}
+
+// Runs value log garbage collection until no more files can be rewritten.
+func (bs *badgerStore) collectGarbage(ratio float64) (int64, error) {
+	before, err := bs.vlogSize()
+	if err != nil {
+		return 0, err
+	}
+
+	for err == nil {
+		err = bs.db.RunValueLogGC(ratio)
+	}
+	if !errors.Is(err, badger.ErrNoRewrite) && !errors.Is(err, badger.ErrRejected) {
+		return 0, err
+	}
+
+	after, err := bs.vlogSize()
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	bs.lastGC.Store(&now)
+
+	reclaimed := max(before-after, 0)
+	bs.reclaimed.Add(reclaimed)
+	return reclaimed, nil
+}
+
+// Returns the size of the value log files on disk. Unlike Size, it is always up to date.
+func (bs *badgerStore) vlogSize() (int64, error) {
+	files, err := filepath.Glob(filepath.Join(bs.dir, "*.vlog"))
+	if err != nil {
+		return 0, err
+	}
+
+	var size int64
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if errors.Is(err, fs.ErrNotExist) {
+			// Removed by the garbage collector in the meantime
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		size += info.Size()
+	}
+
+	return size, nil
+}
+
+// Returns the size in bytes of the LSM tree and of the value log, as last computed by Badger.
+func (bs *badgerStore) Size() (lsm int64, vlog int64) {
+	return bs.db.Size()
+}
+
+// Returns the entry a sample is stored as, under a new key.
+func (bs *badgerStore) entry(b []byte, s models.Sample) (*badger.Entry, error) {
+	prefix := badgerSensorPrefix(s.CampaignId, s.SensorId)
+	seq, err := bs.next(string(prefix))
+	if err != nil {
+		return nil, err
+	}
+
+	key := append(prefix, itob(timeMicros(sampleTime(s)))...)
+	key = append(key, itob(seq)...)
+
+	// Expired samples are dropped by Badger during compaction
+	entry := badger.NewEntry(key, b)
+	if ttl := retention.TTL(s.SampleType); ttl > 0 {
+		entry = entry.WithTTL(ttl)
+	}
+	return entry, nil
+}
+
+// Moves the samples stored by earlier versions to the current key layout, once. These
+// samples were stored under <campaign ID>_<sensor ID><sequence>, with the sequence itself
+// under <campaign ID>_<sensor ID>, and without a schema fingerprint. Keys which cannot be
+// identified as such are left untouched.
+func (bs *badgerStore) migrate() error {
+	err := bs.db.View(func(txn *badger.Txn) error {
+		_, err := txn.Get([]byte(badgerLayoutKey))
+		return err
+	})
+	if !errors.Is(err, badger.ErrKeyNotFound) {
+		return err
+	}
+
+	wb := bs.db.NewWriteBatch()
+	defer wb.Cancel()
+
+	moved := 0
+	err = bs.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		var sequence []byte
+		for it.Rewind(); it.Valid(); it.Next() {
+			key := it.Item().KeyCopy(nil)
+			if !isLegacyBadgerKey(key) {
+				continue
+			}
+
+			value, err := it.Item().ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			b, s, err := normalize(value)
+			prefix := []byte(s.CampaignId + "_" + s.SensorId)
+			if err != nil || len(key) != len(prefix)+8 || !bytes.HasPrefix(key, prefix) {
+				continue
+			}
+
+			entry, err := bs.entry(b, s)
+			if err != nil {
+				return err
+			}
+			err = wb.SetEntry(entry)
+			if err == nil {
+				err = wb.Delete(key)
+			}
+			if err == nil && !bytes.Equal(prefix, sequence) {
+				sequence = prefix
+				err = wb.Delete(sequence)
+			}
+			if err != nil {
+				return err
+			}
+			moved++
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	err = wb.Set([]byte(badgerLayoutKey), []byte{1})
+	if err != nil {
+		return err
+	}
+	err = wb.Flush()
+	if err != nil {
+		return err
+	}
+
+	if moved > 0 {
+		log.Infof("Moved %d samples stored by an earlier version to the current layout", moved)
+	}
+	return nil
+}
+
+// Returns true if the key does not belong to any of the namespaces of the current layout.
+func isLegacyBadgerKey(key []byte) bool {
+	for _, namespace := range []string{badgerSampleKeys, badgerSequenceKeys, badgerMarkerKeys, badgerRollupKeys, "meta/"} {
+		if bytes.HasPrefix(key, []byte(namespace)) {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the next sequence number for the samples under the given key prefix.
+func (bs *badgerStore) next(prefix string) (uint64, error) {
+	key := badgerSequenceKeys + strings.TrimPrefix(prefix, badgerSampleKeys)
+
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
+	seq, ok := bs.sequences[key]
+	if !ok {
+		var err error
+		seq, err = bs.db.GetSequence([]byte(key), badgerSequenceBandwidth)
+		if err != nil {
+			return 0, err
+		}
+		bs.sequences[key] = seq
+	}
+
+	return seq.Next()
+}
+
+func badgerCampaignPrefix(campaignId string) []byte {
+	return []byte(badgerSampleKeys + badgerKeyPart(campaignId) + "/")
+}
+
+func badgerSensorPrefix(campaignId string, sensorId string) []byte {
+	return []byte(badgerSampleKeys + badgerKeyPart(campaignId) + "/" + badgerKeyPart(sensorId) + "/")
+}
+
+// Returns the prefix of the rollups of the given resolution in a campaign, or of a single
+// sensor if given.
+func badgerRollupPrefix(resolution string, campaignId string, sensorId ...string) []byte {
+	prefix := badgerRollupKeys + resolution + "/" + badgerKeyPart(campaignId) + "/"
+	for _, id := range sensorId {
+		prefix += badgerKeyPart(id) + "/"
+	}
+	return []byte(prefix)
+}
+
+// Escapes an ID used in a key, so that it contains no slash. IDs made of letters, digits,
+// dashes, dots and underscores are kept as they are.
+func badgerKeyPart(id string) string {
+	return url.PathEscape(id)
+}
+
+// Returns the time at which the sample stored under the given key was recorded, or the
+// start of the bucket of the rollup stored under it.
+func badgerKeyTime(key []byte) time.Time {
+	suffix := key[len(key)-badgerKeySuffixLength:]
+	return timeFromMicros(binary.BigEndian.Uint64(suffix[:8]))
+}
+
+// Returns the number of microseconds since the epoch, or 0 for earlier times.
+func timeMicros(t time.Time) uint64 {
+	micros := t.UnixMicro()
+	if micros < 0 {
+		return 0
+	}
+	return uint64(micros)
+}
+
+// Returns an 8-byte big endian representation of v.
+func itob(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
@@ -0,0 +1,436 @@
+package samples
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/openrfsense/backend/database/models"
+)
+
+const (
+	// Segments are closed and a new one started once they grow past this size
+	segmentSize = 64 << 20
+
+	// Extension of segment files
+	segmentExt = ".seg"
+
+	// Rollups are stored under <root>/.rollups/<resolution>/<campaign ID>/<sensor ID>.rollup,
+	// using the same records as segments, with the start of the bucket as time and the
+	// rollup in JSON as sample
+	rollupDir = ".rollups"
+	rollupExt = ".rollup"
+
+	// Each record in a segment is the length of the sample (big endian uint32), the time
+	// at which it was recorded (big endian uint64, microseconds since the epoch) and the
+	// encoded sample
+	recordHeaderSize = 12
+)
+
+var _ SampleStore = (*fileStore)(nil)
+
+// Type fileStore stores encoded samples in plain, append-only segment files, under
+// <root>/<campaign ID>/<sensor ID>/<time of the first sample>.seg.
+type fileStore struct {
+	root string
+
+	mu       sync.Mutex
+	segments map[string]*segment
+}
+
+// Type segment is the segment file currently being written for a sensor.
+type segment struct {
+	file *os.File
+	size int64
+}
+
+func newFileStore(root string) (*fileStore, error) {
+	err := os.MkdirAll(root, 0o755)
+	if err != nil {
+		return nil, err
+	}
+
+	return &fileStore{
+		root:     root,
+		segments: map[string]*segment{},
+	}, nil
+}
+
+func (st *fileStore) Append(_ context.Context, b []byte, s models.Sample) error {
+	dir, err := st.dir(s.CampaignId, s.SensorId)
+	if err != nil {
+		return err
+	}
+
+	record := make([]byte, recordHeaderSize, recordHeaderSize+len(b))
+	binary.BigEndian.PutUint32(record[:4], uint32(len(b)))
+	binary.BigEndian.PutUint64(record[4:recordHeaderSize], timeMicros(sampleTime(s)))
+	record = append(record, b...)
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	seg, ok := st.segments[dir]
+	if ok && seg.size+int64(len(record)) > segmentSize {
+		err = seg.file.Close()
+		if err != nil {
+			return err
+		}
+		ok = false
+	}
+	if !ok {
+		seg, err = openSegment(dir, timeMicros(sampleTime(s)))
+		if err != nil {
+			return err
+		}
+		st.segments[dir] = seg
+	}
+
+	n, err := seg.file.Write(record)
+	seg.size += int64(n)
+	return err
+}
+
+func (st *fileStore) Range(ctx context.Context, q SampleQuery, fn func(models.Sample) error) error {
+	sensors := []string{q.SensorId}
+	if q.SensorId == "" {
+		campaignDir, err := st.dir(q.CampaignId)
+		if err != nil {
+			return err
+		}
+		sensors, err = listDir(campaignDir, "")
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, sensorId := range sensors {
+		dir, err := st.dir(q.CampaignId, sensorId)
+		if err != nil {
+			return err
+		}
+		segments, err := listDir(dir, segmentExt)
+		if err != nil {
+			return err
+		}
+
+		for _, name := range segments {
+			err = readSegment(ctx, filepath.Join(dir, name), func(recorded uint64, b []byte) error {
+				if !q.includes(timeFromMicros(recorded)) {
+					return nil
+				}
+
+				s, err := Decode(b)
+				if err != nil {
+					log.Error(err)
+					return nil
+				}
+				return fn(s)
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (st *fileStore) DeleteCampaign(_ context.Context, campaignId string) error {
+	dir, err := st.dir(campaignId)
+	if err != nil {
+		return err
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	for key, seg := range st.segments {
+		if strings.HasPrefix(key, dir+string(filepath.Separator)) {
+			_ = seg.file.Close()
+			delete(st.segments, key)
+		}
+	}
+
+	return os.RemoveAll(dir)
+}
+
+func (st *fileStore) AppendRollup(_ context.Context, r models.Rollup) error {
+	dir, err := st.rollupDir(r.Resolution, r.CampaignId)
+	if err != nil {
+		return err
+	}
+	_, err = joinIds(dir, r.SensorId)
+	if err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	record := make([]byte, recordHeaderSize, recordHeaderSize+len(b))
+	binary.BigEndian.PutUint32(record[:4], uint32(len(b)))
+	binary.BigEndian.PutUint64(record[4:recordHeaderSize], timeMicros(r.Start))
+	record = append(record, b...)
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	err = os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(filepath.Join(dir, r.SensorId+rollupExt), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(record)
+	return errors.Join(err, file.Close())
+}
+
+func (st *fileStore) RangeRollups(ctx context.Context, resolution string, q SampleQuery, fn func(models.Rollup) error) error {
+	dir, err := st.rollupDir(resolution, q.CampaignId)
+	if err != nil {
+		return err
+	}
+
+	files := []string{q.SensorId + rollupExt}
+	if q.SensorId == "" {
+		files, err = listDir(dir, rollupExt)
+		if err != nil {
+			return err
+		}
+	} else if _, err = joinIds(dir, q.SensorId); err != nil {
+		return err
+	}
+
+	for _, name := range files {
+		// Rollups are appended in order, so a bucket which appears again was computed
+		// again: the rollups of the current bucket are held back until the next bucket
+		// starts, so that the last ones computed win
+		bucket := []models.Rollup{}
+		flush := func() error {
+			for _, r := range bucket {
+				err := fn(r)
+				if err != nil {
+					return err
+				}
+			}
+			bucket = bucket[:0]
+			return nil
+		}
+
+		err = readSegment(ctx, filepath.Join(dir, name), func(start uint64, b []byte) error {
+			if !q.includes(timeFromMicros(start)) {
+				return nil
+			}
+
+			r := models.Rollup{}
+			err := json.Unmarshal(b, &r)
+			if err != nil {
+				return err
+			}
+
+			if len(bucket) > 0 {
+				switch current := bucket[0].Start; {
+				case r.Start.Before(current):
+					return nil
+				case r.Start.After(current):
+					err = flush()
+					if err != nil {
+						return err
+					}
+				}
+			}
+
+			i := sort.Search(len(bucket), func(i int) bool {
+				return bucket[i].CenterFreq >= r.CenterFreq
+			})
+			if i < len(bucket) && bucket[i].CenterFreq == r.CenterFreq {
+				bucket[i] = r
+				return nil
+			}
+			bucket = append(bucket, models.Rollup{})
+			copy(bucket[i+1:], bucket[i:])
+			bucket[i] = r
+			return nil
+		})
+		if err == nil {
+			err = flush()
+		}
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (st *fileStore) Stats(ctx context.Context) (models.StoreStats, error) {
+	stats := models.StoreStats{Backend: "files"}
+	err := filepath.WalkDir(st.root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || filepath.Ext(path) != segmentExt {
+			return err
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		stats.Bytes += info.Size()
+
+		return readSegment(ctx, path, func(uint64, []byte) error {
+			stats.Samples++
+			return nil
+		})
+	})
+
+	return stats, err
+}
+
+func (st *fileStore) Close() error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	var err error
+	for key, seg := range st.segments {
+		err = errors.Join(err, seg.file.Sync(), seg.file.Close())
+		delete(st.segments, key)
+	}
+
+	return err
+}
+
+// Returns the directory of a campaign or of a sensor in a campaign.
+func (st *fileStore) dir(ids ...string) (string, error) {
+	return joinIds(st.root, ids...)
+}
+
+// Returns the directory of the rollups of a campaign at the given resolution.
+func (st *fileStore) rollupDir(resolution string, campaignId string) (string, error) {
+	return joinIds(filepath.Join(st.root, rollupDir), resolution, campaignId)
+}
+
+// Joins IDs to a path. IDs are checked so that they cannot point outside of the store,
+// nor to the rollups.
+func joinIds(path string, ids ...string) (string, error) {
+	for _, id := range ids {
+		if id == "" || strings.HasPrefix(id, ".") || strings.ContainsAny(id, `/\`) {
+			return "", fmt.Errorf("invalid ID %q", id)
+		}
+		path = filepath.Join(path, id)
+	}
+
+	return path, nil
+}
+
+// Creates a new segment in the given directory, named after the time of its first sample.
+func openSegment(dir string, first uint64) (*segment, error) {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, err
+	}
+
+	// Samples can arrive out of order, so the name may already be taken
+	name := fmt.Sprintf("%020d", first)
+	path := filepath.Join(dir, name+segmentExt)
+	for i := 1; ; i++ {
+		_, err = os.Stat(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		path = filepath.Join(dir, fmt.Sprintf("%s-%d%s", name, i, segmentExt))
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &segment{file: file}, nil
+}
+
+// Calls fn for each record of a segment. A truncated record at the end of the segment (e.g.
+// one which is still being written) is ignored.
+func readSegment(ctx context.Context, path string, fn func(recorded uint64, b []byte) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	header := make([]byte, recordHeaderSize)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		_, err = io.ReadFull(reader, header)
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		length := binary.BigEndian.Uint32(header[:4])
+		if length > segmentSize {
+			return fmt.Errorf("corrupt record of %d bytes in %s", length, path)
+		}
+
+		b := make([]byte, length)
+		_, err = io.ReadFull(reader, b)
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		err = fn(binary.BigEndian.Uint64(header[4:]), b)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Returns the sorted names of the entries of a directory which have the given extension
+// (or of all subdirectories if the extension is empty). A missing directory is empty.
+func listDir(dir string, ext string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, entry := range entries {
+		if (ext == "" && entry.IsDir()) || (ext != "" && filepath.Ext(entry.Name()) == ext) {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
@@ -0,0 +1,178 @@
+package samples
+
+import (
+	"context"
+
+	"github.com/Masterminds/squirrel"
+
+	"github.com/openrfsense/backend/database"
+	"github.com/openrfsense/backend/database/models"
+)
+
+var _ SampleStore = (*postgresStore)(nil)
+
+// Type postgresStore stores decoded samples in the samples table. Fields which are not
+// part of the table (e.g. those only sent by sensors using a newer schema) are lost.
+type postgresStore struct{}
+
+func newPostgresStore() *postgresStore {
+	return &postgresStore{}
+}
+
+func (postgresStore) Append(ctx context.Context, _ []byte, s models.Sample) error {
+	sql, args, _ := database.Instance().
+		Insert("samples").
+		Columns(
+			"sensor_id",
+			"campaign_id",
+			"sample_type",
+			"time_seconds",
+			"time_microseconds",
+			"config_antenna_gain",
+			"config_antenna_id",
+			"config_center_freq",
+			"config_est_noise_floor",
+			"config_frequency_correction_factor",
+			"config_frontend_gain",
+			"config_hopping_strategy",
+			"config_iq_balance_calibration",
+			"config_rf_sync",
+			"config_sampling_rate",
+			"config_sig_strength_calibration",
+			"config_system_sync",
+			"config_extra_conf",
+			"data",
+		).Values(
+		s.SensorId,
+		s.CampaignId,
+		s.SampleType,
+		s.SampleTime.Seconds,
+		s.SampleTime.Microseconds,
+		s.SampleConfig.AntennaGain,
+		s.SampleConfig.AntennaId,
+		s.SampleConfig.CenterFreq,
+		s.SampleConfig.EstNoiseFloor,
+		s.SampleConfig.FrequencyCorrectionFactor,
+		s.SampleConfig.FrontendGain,
+		s.SampleConfig.HoppingStrategy,
+		s.SampleConfig.IqBalanceCalibration,
+		s.SampleConfig.RfSync,
+		s.SampleConfig.SamplingRate,
+		s.SampleConfig.SigStrengthCalibration,
+		s.SampleConfig.SystemSync,
+		s.SampleConfig.ExtraConf,
+		s.Data,
+	).ToSql()
+
+	return database.Do(ctx, sql, args...)
+}
+
+func (postgresStore) Range(ctx context.Context, q SampleQuery, fn func(models.Sample) error) error {
+	builder := database.Instance().
+		Select("*").
+		From("samples").
+		Where("campaign_id = ?", q.CampaignId)
+	if q.SensorId != "" {
+		builder = builder.Where("sensor_id = ?", q.SensorId)
+	}
+	if !q.From.IsZero() {
+		builder = builder.Where(`("time_seconds", "time_microseconds") >= (?, ?)`, q.From.Unix(), q.From.Nanosecond()/1000)
+	}
+	if !q.To.IsZero() {
+		builder = builder.Where(`("time_seconds", "time_microseconds") < (?, ?)`, q.To.Unix(), q.To.Nanosecond()/1000)
+	}
+
+	sql, args, _ := builder.
+		OrderBy("sensor_id", "time_seconds", "time_microseconds", "id").
+		ToSql()
+	rows, err := database.Instance().Query(ctx, sql, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		s, err := database.RowToStructByName[models.Sample](rows)
+		if err != nil {
+			return err
+		}
+
+		err = fn(s)
+		if err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+func (postgresStore) DeleteCampaign(ctx context.Context, campaignId string) error {
+	sql, args, _ := database.Instance().
+		Delete("samples").
+		Where(squirrel.Eq{"campaign_id": campaignId}).
+		ToSql()
+	return database.Do(ctx, sql, args...)
+}
+
+func (postgresStore) AppendRollup(ctx context.Context, r models.Rollup) error {
+	sql, args, _ := database.Instance().
+		Insert("rollups").
+		Columns("sensor_id", "campaign_id", "resolution", "start", "center_freq", "count", "min", "mean", "max").
+		Values(r.SensorId, r.CampaignId, r.Resolution, r.Start, r.CenterFreq, r.Count, r.Min, r.Mean, r.Max).
+		Suffix(`on conflict ("campaign_id", "resolution", "sensor_id", "start", "center_freq") do update set ` +
+			`"count" = excluded."count", "min" = excluded."min", "mean" = excluded."mean", "max" = excluded."max"`).
+		ToSql()
+	return database.Do(ctx, sql, args...)
+}
+
+func (postgresStore) RangeRollups(ctx context.Context, resolution string, q SampleQuery, fn func(models.Rollup) error) error {
+	builder := database.Instance().
+		Select("*").
+		From("rollups").
+		Where("campaign_id = ?", q.CampaignId).
+		Where("resolution = ?", resolution)
+	if q.SensorId != "" {
+		builder = builder.Where("sensor_id = ?", q.SensorId)
+	}
+	if !q.From.IsZero() {
+		builder = builder.Where(`"start" >= ?`, q.From)
+	}
+	if !q.To.IsZero() {
+		builder = builder.Where(`"start" < ?`, q.To)
+	}
+
+	sql, args, _ := builder.
+		OrderBy("sensor_id", `"start"`, "center_freq").
+		ToSql()
+	rows, err := database.Instance().Query(ctx, sql, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		r, err := database.RowToStructByName[models.Rollup](rows)
+		if err != nil {
+			return err
+		}
+
+		err = fn(r)
+		if err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+func (postgresStore) Stats(ctx context.Context) (models.StoreStats, error) {
+	stats := models.StoreStats{Backend: "postgres"}
+	err := database.Instance().
+		QueryRow(ctx, `select count(*), pg_total_relation_size('samples') from samples`).
+		Scan(&stats.Samples, &stats.Bytes)
+	return stats, err
+}
+
+func (postgresStore) Close() error {
+	return nil
+}
@@ -0,0 +1,343 @@
+package samples
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/hamba/avro/v2"
+
+	"github.com/openrfsense/backend/database/models"
+)
+
+func TestStores(t *testing.T) {
+	for _, kind := range []string{"badger", "files"} {
+		t.Run(kind, func(t *testing.T) {
+			st, err := openStore(kind + ":" + filepath.Join(t.TempDir(), kind))
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { _ = st.Close() })
+
+			ctx := context.Background()
+			begin := time.Unix(1700000000, 0)
+			for i, sensorId := range []string{"a", "b", "a", "a"} {
+				s := models.Sample{
+					SensorId:   sensorId,
+					CampaignId: "campaign",
+					SampleType: "PSD",
+					SampleTime: models.SampleTime{Seconds: begin.Unix() + int64(i)},
+					Data:       []float32{float32(i)},
+				}
+				b, err := Encode(s)
+				if err != nil {
+					t.Fatal(err)
+				}
+				err = st.Append(ctx, b, s)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			read := func(q SampleQuery) []float32 {
+				data := []float32{}
+				err := st.Range(ctx, q, func(s models.Sample) error {
+					data = append(data, s.Data[0])
+					return nil
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+				return data
+			}
+
+			if data := read(SampleQuery{CampaignId: "campaign"}); len(data) != 4 {
+				t.Fatalf("expected all 4 samples, got %v", data)
+			}
+
+			data := read(SampleQuery{
+				CampaignId: "campaign",
+				SensorId:   "a",
+				From:       begin.Add(time.Second),
+				To:         begin.Add(3 * time.Second),
+			})
+			if len(data) != 1 || data[0] != 2 {
+				t.Fatalf("expected only the third sample, got %v", data)
+			}
+
+			stats, err := st.Stats(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stats.Backend != kind || stats.Samples != 4 {
+				t.Fatalf("unexpected stats %+v", stats)
+			}
+
+			// Rollups computed again replace the previous ones
+			for i, start := range []int64{0, 60, 60, 120} {
+				err = st.AppendRollup(ctx, models.Rollup{
+					SensorId:   "a",
+					CampaignId: "campaign",
+					Resolution: "1m",
+					Start:      begin.Add(time.Duration(start) * time.Second),
+					Count:      []int64{int64(i)},
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			rollups := []models.Rollup{}
+			err = st.RangeRollups(ctx, "1m", SampleQuery{CampaignId: "campaign", From: begin.Add(time.Minute)}, func(r models.Rollup) error {
+				rollups = append(rollups, r)
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rollups) != 2 || !rollups[0].Start.Equal(begin.Add(time.Minute)) {
+				t.Fatalf("expected the last two rollups, got %v", rollups)
+			}
+			if rollups[0].Count[0] != 2 {
+				t.Fatalf("expected the rollup computed last to win, got count %d", rollups[0].Count[0])
+			}
+
+			err = st.DeleteCampaign(ctx, "campaign")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if data := read(SampleQuery{CampaignId: "campaign"}); len(data) != 0 {
+				t.Fatalf("expected no samples after deletion, got %v", data)
+			}
+			err = st.RangeRollups(ctx, "1m", SampleQuery{CampaignId: "campaign", SensorId: "a"}, func(r models.Rollup) error {
+				rollups = append(rollups, r)
+				return nil
+			})
+			if err != nil || len(rollups) != 5 {
+				t.Fatalf("rollups should be kept after deletion, got %v (%v)", rollups, err)
+			}
+		})
+	}
+}
+
+func TestBadgerRetention(t *testing.T) {
+	retention = Retention{Types: map[string]time.Duration{"PSD": time.Hour}}
+	t.Cleanup(func() { retention = Retention{} })
+
+	bs, err := newBadgerStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = bs.Close() })
+
+	for _, sampleType := range []string{"PSD", "IQ"} {
+		s := models.Sample{SensorId: sampleType, CampaignId: "campaign", SampleType: sampleType}
+		b, err := Encode(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = bs.Append(context.Background(), b, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expiresAt := map[string]uint64{}
+	err = bs.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		for it.Seek(badgerCampaignPrefix("campaign")); it.ValidForPrefix(badgerCampaignPrefix("campaign")); it.Next() {
+			sensorId := strings.Split(string(it.Item().Key()), "/")[2]
+			expiresAt[sensorId] = it.Item().ExpiresAt()
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := uint64(time.Now().Add(time.Hour).Unix())
+	if expiresAt["PSD"] == 0 || expiresAt["PSD"] > expected {
+		t.Fatalf("PSD sample should expire in an hour, expires at %d", expiresAt["PSD"])
+	}
+	if expiresAt["IQ"] != 0 {
+		t.Fatalf("IQ sample should never expire, expires at %d", expiresAt["IQ"])
+	}
+}
+
+func TestBadgerFollow(t *testing.T) {
+	bs, err := newBadgerStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = bs.Close() })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	write := func(from int, to int) {
+		for i := from; i < to; i++ {
+			s := models.Sample{
+				SensorId:   "sensor",
+				CampaignId: "campaign",
+				SampleType: "PSD",
+				SampleTime: models.SampleTime{Seconds: int64(i)},
+				Data:       []float32{float32(i)},
+			}
+			b, err := Encode(s)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			err = bs.Append(ctx, b, s)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}
+
+	// Samples are written before, while and after the follower reads stored samples
+	const total = 300
+	write(0, 100)
+	go write(100, 200)
+
+	seen := make(chan float32)
+	go func() {
+		_ = bs.Follow(ctx, SampleQuery{CampaignId: "campaign", SensorId: "sensor"}, func(s models.Sample) error {
+			seen <- s.Data[0]
+			return nil
+		})
+	}()
+
+	received := map[float32]int{}
+	for len(received) < total {
+		if len(received) == 150 {
+			go write(200, total)
+		}
+
+		select {
+		case v := <-seen:
+			received[v]++
+			if received[v] > 1 {
+				t.Fatalf("sample %v was received twice", v)
+			}
+		case <-ctx.Done():
+			t.Fatalf("only received %d samples", len(received))
+		}
+	}
+}
+
+func TestBadgerSensorPrefixes(t *testing.T) {
+	bs, err := newBadgerStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = bs.Close() })
+
+	ctx := context.Background()
+	for _, sensorId := range []string{"a", "a/b", "a%2Fb"} {
+		s := models.Sample{SensorId: sensorId, CampaignId: "campaign", SampleType: "PSD"}
+		b, err := Encode(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = bs.Append(ctx, b, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, sensorId := range []string{"a", "a/b", "a%2Fb"} {
+		read := []string{}
+		err = bs.Range(ctx, SampleQuery{CampaignId: "campaign", SensorId: sensorId}, func(s models.Sample) error {
+			read = append(read, s.SensorId)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(read) != 1 || read[0] != sensorId {
+			t.Errorf("expected the sample of sensor %q only, got %q", sensorId, read)
+		}
+	}
+}
+
+func TestBadgerLegacyLayout(t *testing.T) {
+	dir := t.TempDir()
+	db, err := badger.Open(badger.DefaultOptions(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Samples as stored by earlier versions, with a sequence for each campaign and sensor
+	begin := time.Unix(1700000000, 0)
+	sensors := []string{"x_y", "x", "x_y"}
+	err = db.Update(func(txn *badger.Txn) error {
+		for i, sensorId := range sensors {
+			payload, err := avro.Marshal(DefaultSchema, models.Sample{
+				SensorId:   sensorId,
+				CampaignId: "campaign",
+				SampleType: "PSD",
+				SampleTime: models.SampleTime{Seconds: begin.Unix() + int64(i)},
+				Data:       []float32{float32(i)},
+			})
+			if err != nil {
+				return err
+			}
+
+			prefix := []byte("campaign_" + sensorId)
+			err = txn.Set(append(prefix, itob(uint64(i))...), payload)
+			if err == nil {
+				err = txn.Set(prefix, itob(1000))
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return txn.Set([]byte("unrelated"), []byte("kept"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = db.Close()
+
+	bs, err := newBadgerStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = bs.Close() })
+
+	read := map[string][]float32{}
+	err = bs.Range(context.Background(), SampleQuery{CampaignId: "campaign"}, func(s models.Sample) error {
+		read[s.SensorId] = append(read[s.SensorId], s.Data[0])
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(read["x"]) != 1 || len(read["x_y"]) != 2 || read["x_y"][0] != 0 || read["x_y"][1] != 2 {
+		t.Fatalf("unexpected samples after migration: %v", read)
+	}
+
+	legacy := []string{}
+	err = bs.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			if isLegacyBadgerKey(it.Item().Key()) {
+				legacy = append(legacy, string(it.Item().Key()))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(legacy) != 1 || legacy[0] != "unrelated" {
+		t.Fatalf("expected only the unrelated key to be left, got %q", legacy)
+	}
+}
@@ -1,19 +1,47 @@
 package stream
 
 import (
+	"cmp"
+	"math"
+	"slices"
 	"sync"
 	"time"
 
 	"github.com/reugn/go-streams"
 )
 
+// discardingCandidate is the earliest element received so far in a window of a
+// DiscardingWindow.
+type discardingCandidate struct {
+	start     int64
+	end       int64
+	timestamp int64
+	elem      any
+}
+
+// DiscardingWindow only lets through the earliest element of each window, and discards the
+// others. Windows are aligned on multiples of the sliding interval since the epoch.
+//
+// The earliest element of a window is emitted once the watermark passes it (see
+// EventTime), since no element which is not late can come before it anymore: with no
+// out-of-orderness, elements which arrive in order are emitted right away. Elements
+// still held back are emitted once the input is closed.
+//
+// Late elements are handled according to the LatePolicy: with LateUpdate, a late element
+// is still emitted if no element of its window was emitted yet, as long as the watermark
+// did not pass it by more than the allowed lateness.
 type DiscardingWindow struct {
-	slidingInterval    time.Duration
-	lastTimestamp      int64
-	timestampExtractor func(any) int64
-	in                 chan any
-	out                chan any
-	done               chan struct{}
+	slidingInterval time.Duration
+	eventTime       EventTime
+	watermark       watermark
+	candidates      []discardingCandidate
+
+	// Start of the first window which did not emit any element yet
+	next int64
+
+	in   chan any
+	out  chan any
+	late chan any
 	sync.Mutex
 }
 
@@ -23,24 +51,35 @@ var _ streams.Flow = (*DiscardingWindow)(nil)
 // NewDiscardingWindow returns a new processing time based DiscardingWindow.
 // Processing time refers to the system time of the machine that is executing the respective operation.
 //
-// size is the Duration of generated windows.
 // slide is the sliding interval of generated windows.
 func NewDiscardingWindow(slide time.Duration) *DiscardingWindow {
-	return NewDiscardingWindowWithTSExtractor(slide, nil)
+	return NewDiscardingWindowWithEventTime(slide, EventTime{})
 }
 
 // NewDiscardingWindowWithTSExtractor returns a new event time based DiscardingWindow.
 // Event time is the time that each individual event occurred on its producing device.
-// Gives correct results on out-of-order events, late events, or on replays of data.
+// Elements must arrive in order, as they are late as soon as an element with a later
+// timestamp was received.
 //
 // slide is the sliding interval of generated windows.
 // timestampExtractor is the record timestamp (in nanoseconds) extractor.
 func NewDiscardingWindowWithTSExtractor(slide time.Duration, timestampExtractor func(any) int64) *DiscardingWindow {
+	return NewDiscardingWindowWithEventTime(slide, EventTime{TimestampExtractor: timestampExtractor})
+}
+
+// NewDiscardingWindowWithEventTime returns a new DiscardingWindow with the given event time
+// semantics. Processing time is used if the EventTime has no TimestampExtractor.
+//
+// slide is the sliding interval of generated windows.
+func NewDiscardingWindowWithEventTime(slide time.Duration, eventTime EventTime) *DiscardingWindow {
 	window := &DiscardingWindow{
-		slidingInterval:    slide,
-		timestampExtractor: timestampExtractor,
-		in:                 make(chan any),
-		out:                make(chan any),
+		slidingInterval: slide,
+		eventTime:       eventTime,
+		watermark:       newWatermark(eventTime),
+		next:            math.MinInt64,
+		in:              make(chan any),
+		out:             make(chan any),
+		late:            make(chan any),
 	}
 
 	go window.receive()
@@ -68,6 +107,12 @@ func (dw *DiscardingWindow) In() chan<- any {
 	return dw.in
 }
 
+// Late returns the channel late elements are sent on with LateSideOutput. It is closed
+// along with the output channel.
+func (dw *DiscardingWindow) Late() <-chan any {
+	return dw.late
+}
+
 // transmit submits newly created windows to the next Inlet.
 func (dw *DiscardingWindow) transmit(inlet streams.Inlet) {
 	for elem := range dw.Out() {
@@ -76,23 +121,73 @@ func (dw *DiscardingWindow) transmit(inlet streams.Inlet) {
 	close(inlet.In())
 }
 
-// timestamp extracts the timestamp from a record if the timestampExtractor is set.
-// Returns system clock time otherwise.
-func (dw *DiscardingWindow) timestamp(elem any) int64 {
-	if dw.timestampExtractor == nil {
-		return time.Now().UTC().UnixNano()
-	}
-	return dw.timestampExtractor(elem)
+// SetInterval changes the sliding interval, starting with the next record.
+func (dw *DiscardingWindow) SetInterval(slide time.Duration) {
+	dw.Lock()
+	defer dw.Unlock()
+	dw.slidingInterval = slide
 }
 
 func (dw *DiscardingWindow) receive() {
 	for elem := range dw.in {
-		elemTs := dw.timestamp(elem)
-		if (elemTs - dw.lastTimestamp) > int64(dw.slidingInterval) {
-			dw.lastTimestamp = elemTs
-			dw.out <- elem
-		}
+		dw.Lock()
+		slide := int64(dw.slidingInterval)
+		dw.Unlock()
+
+		ts := dw.eventTime.timestamp(elem)
+		dw.add(ts, floorDiv(ts, slide)*slide, slide, elem)
+		dw.watermark.observe(ts)
+		dw.close(dw.watermark.current())
 	}
-	close(dw.done)
+
+	for _, c := range dw.candidates {
+		dw.out <- c.elem
+	}
+	close(dw.late)
 	close(dw.out)
 }
+
+// add makes the element the candidate of its window if it is the earliest one so far.
+func (dw *DiscardingWindow) add(ts int64, start int64, slide int64, elem any) {
+	watermark := dw.watermark.current()
+	if ts < watermark {
+		switch {
+		case dw.eventTime.LatePolicy == LateSideOutput:
+			dw.late <- elem
+			return
+		case dw.eventTime.LatePolicy != LateUpdate || ts+dw.eventTime.allowedLateness() <= watermark:
+			return
+		}
+	}
+
+	// The window already emitted an element
+	if start < dw.next {
+		return
+	}
+
+	candidate := discardingCandidate{start: start, end: start + slide, timestamp: ts, elem: elem}
+	i, found := slices.BinarySearchFunc(dw.candidates, start, func(c discardingCandidate, start int64) int {
+		return cmp.Compare(c.start, start)
+	})
+	switch {
+	case !found:
+		dw.candidates = slices.Insert(dw.candidates, i, candidate)
+	case ts < dw.candidates[i].timestamp:
+		dw.candidates[i] = candidate
+	}
+}
+
+// close emits the candidates which the watermark passed, in the order of their windows.
+func (dw *DiscardingWindow) close(watermark int64) {
+	emitted := 0
+	for _, c := range dw.candidates {
+		if c.timestamp > watermark {
+			break
+		}
+
+		dw.out <- c.elem
+		dw.next = c.end
+		emitted++
+	}
+	dw.candidates = dw.candidates[emitted:]
+}
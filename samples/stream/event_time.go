@@ -0,0 +1,211 @@
+package stream
+
+import (
+	"container/heap"
+	"math"
+	"time"
+
+	"github.com/reugn/go-streams"
+)
+
+// LatePolicy tells what event time flows do with late elements, which arrive once the
+// watermark has passed them.
+type LatePolicy int
+
+const (
+	// LateDrop discards late elements.
+	LateDrop LatePolicy = iota
+
+	// LateSideOutput sends late elements, untouched, to the Late channel of the flow,
+	// which must then be read.
+	LateSideOutput
+
+	// LateUpdate processes late elements anyway: windows which were already emitted are
+	// emitted again with the late elements, as long as the watermark did not pass their
+	// end by more than the allowed lateness.
+	LateUpdate
+)
+
+// EventTime configures the event time semantics of a flow. The watermark of the flow is
+// the latest timestamp it received minus the maximum out-of-orderness: no element with an
+// earlier timestamp is expected anymore, and those which still arrive are late.
+type EventTime struct {
+	// Extracts the timestamp (in nanoseconds) of an element. Processing time is used if nil
+	TimestampExtractor func(any) int64
+
+	// How far behind the latest timestamp elements can arrive without being late
+	MaxOutOfOrderness time.Duration
+
+	// What to do with late elements
+	LatePolicy LatePolicy
+
+	// With LateUpdate, how long after the watermark passed the end of a window it can
+	// still be updated
+	AllowedLateness time.Duration
+}
+
+// timestamp extracts the timestamp from a record if the TimestampExtractor is set.
+// Returns system clock time otherwise.
+func (et EventTime) timestamp(elem any) int64 {
+	if et.TimestampExtractor == nil {
+		return time.Now().UTC().UnixNano()
+	}
+	return et.TimestampExtractor(elem)
+}
+
+// allowedLateness returns how long windows can be updated once closed.
+func (et EventTime) allowedLateness() int64 {
+	if et.LatePolicy != LateUpdate {
+		return 0
+	}
+	return int64(et.AllowedLateness)
+}
+
+// watermark tracks the watermark of a flow.
+type watermark struct {
+	latest int64
+	bound  int64
+	seen   bool
+}
+
+func newWatermark(eventTime EventTime) watermark {
+	return watermark{bound: int64(eventTime.MaxOutOfOrderness)}
+}
+
+// observe advances the watermark according to the timestamp of a new element.
+func (w *watermark) observe(ts int64) {
+	if !w.seen || ts > w.latest {
+		w.latest = ts
+	}
+	w.seen = true
+}
+
+// current returns the watermark, the lowest possible one if no element was received.
+func (w *watermark) current() int64 {
+	if !w.seen {
+		return math.MinInt64
+	}
+	return w.latest - w.bound
+}
+
+// timedElement is an element waiting in an EventTimeOrder.
+type timedElement struct {
+	timestamp int64
+	seq       uint64
+	elem      any
+}
+
+// timedHeap orders elements by timestamp, then by arrival.
+type timedHeap []timedElement
+
+func (h timedHeap) Len() int { return len(h) }
+func (h timedHeap) Less(i, j int) bool {
+	if h[i].timestamp != h[j].timestamp {
+		return h[i].timestamp < h[j].timestamp
+	}
+	return h[i].seq < h[j].seq
+}
+func (h timedHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *timedHeap) Push(x any)   { *h = append(*h, x.(timedElement)) }
+func (h *timedHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// EventTimeOrder holds elements back until the watermark passes them, then emits them in
+// the order of their timestamps (elements with the same timestamp keep their arrival
+// order), so that flows which assume arrival order can process elements which arrive out
+// of order. Elements still held back are emitted once the input is closed. With
+// LateUpdate, late elements are emitted as soon as they arrive, out of order.
+type EventTimeOrder struct {
+	eventTime EventTime
+	watermark watermark
+	pending   timedHeap
+	seq       uint64
+	in        chan any
+	out       chan any
+	late      chan any
+}
+
+// Verify EventTimeOrder satisfies the Flow interface.
+var _ streams.Flow = (*EventTimeOrder)(nil)
+
+// NewEventTimeOrder returns a new EventTimeOrder.
+func NewEventTimeOrder(eventTime EventTime) *EventTimeOrder {
+	order := &EventTimeOrder{
+		eventTime: eventTime,
+		watermark: newWatermark(eventTime),
+		in:        make(chan any),
+		out:       make(chan any),
+		late:      make(chan any),
+	}
+
+	go order.receive()
+	return order
+}
+
+// Via streams data through the given flow
+func (eo *EventTimeOrder) Via(flow streams.Flow) streams.Flow {
+	go eo.transmit(flow)
+	return flow
+}
+
+// To streams data to the given sink
+func (eo *EventTimeOrder) To(sink streams.Sink) {
+	eo.transmit(sink)
+}
+
+// Out returns an output channel for sending data
+func (eo *EventTimeOrder) Out() <-chan any {
+	return eo.out
+}
+
+// In returns an input channel for receiving data
+func (eo *EventTimeOrder) In() chan<- any {
+	return eo.in
+}
+
+// Late returns the channel late elements are sent on with LateSideOutput. It is closed
+// along with the output channel.
+func (eo *EventTimeOrder) Late() <-chan any {
+	return eo.late
+}
+
+// transmit submits ordered elements to the next Inlet.
+func (eo *EventTimeOrder) transmit(inlet streams.Inlet) {
+	for elem := range eo.Out() {
+		inlet.In() <- elem
+	}
+	close(inlet.In())
+}
+
+func (eo *EventTimeOrder) receive() {
+	for elem := range eo.in {
+		ts := eo.eventTime.timestamp(elem)
+		if ts < eo.watermark.current() {
+			switch eo.eventTime.LatePolicy {
+			case LateSideOutput:
+				eo.late <- elem
+			case LateUpdate:
+				eo.out <- elem
+			}
+			continue
+		}
+
+		eo.seq++
+		heap.Push(&eo.pending, timedElement{timestamp: ts, seq: eo.seq, elem: elem})
+		eo.watermark.observe(ts)
+
+		for len(eo.pending) > 0 && eo.pending[0].timestamp <= eo.watermark.current() {
+			eo.out <- heap.Pop(&eo.pending).(timedElement).elem
+		}
+	}
+
+	for len(eo.pending) > 0 {
+		eo.out <- heap.Pop(&eo.pending).(timedElement).elem
+	}
+	close(eo.late)
+	close(eo.out)
+}
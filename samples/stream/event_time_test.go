@@ -0,0 +1,131 @@
+package stream
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/openrfsense/backend/database/models"
+)
+
+// Returns a PSD sample recorded at the given millisecond, whose only bin is v.
+func psdAt(ms int, v float32) models.Sample {
+	return models.Sample{
+		SensorId:   "sensor",
+		SampleType: "PSD",
+		SampleTime: models.SampleTime{Seconds: int64(ms / 1000), Microseconds: int32(ms%1000) * 1000},
+		Data:       []float32{v},
+	}
+}
+
+func sampleTimestamp(elem any) int64 {
+	s := elem.(models.Sample)
+	return s.SampleTime.Seconds*int64(time.Second) + int64(s.SampleTime.Microseconds)*int64(time.Microsecond)
+}
+
+// Sends the samples to the flow, then returns the bins of all elements it emits and of
+// all late elements.
+func runFlow(flow interface {
+	In() chan<- any
+	Out() <-chan any
+	Late() <-chan any
+}, in []models.Sample) ([]float32, []float32) {
+	go func() {
+		for _, s := range in {
+			flow.In() <- s
+		}
+		close(flow.In())
+	}()
+
+	late := make(chan []float32)
+	go func() {
+		values := []float32{}
+		for elem := range flow.Late() {
+			values = append(values, elem.(models.Sample).Data[0])
+		}
+		late <- values
+	}()
+
+	out := []float32{}
+	for elem := range flow.Out() {
+		out = append(out, elem.(models.Sample).Data[0])
+	}
+	return out, <-late
+}
+
+func TestEventTimeOrder(t *testing.T) {
+	in := []models.Sample{psdAt(0, 0), psdAt(300, 3), psdAt(100, 1), psdAt(600, 6), psdAt(200, 2), psdAt(700, 7), psdAt(650, 65)}
+	cases := map[LatePolicy]struct {
+		out  []float32
+		late []float32
+	}{
+		LateDrop:       {[]float32{0, 1, 3, 6, 65, 7}, []float32{}},
+		LateSideOutput: {[]float32{0, 1, 3, 6, 65, 7}, []float32{2}},
+		LateUpdate:     {[]float32{0, 1, 3, 2, 6, 65, 7}, []float32{}},
+	}
+
+	for policy, c := range cases {
+		order := NewEventTimeOrder(EventTime{
+			TimestampExtractor: sampleTimestamp,
+			MaxOutOfOrderness:  250 * time.Millisecond,
+			LatePolicy:         policy,
+		})
+		out, late := runFlow(order, in)
+		if !reflect.DeepEqual(out, c.out) || !reflect.DeepEqual(late, c.late) {
+			t.Errorf("policy %d: expected %v and late %v, got %v and late %v", policy, c.out, c.late, out, late)
+		}
+	}
+}
+
+func TestSpectralWindowLateness(t *testing.T) {
+	// The sample at 500 ms arrives after the watermark passed the end of its window
+	in := []models.Sample{psdAt(0, 1), psdAt(1100, 10), psdAt(1600, 20), psdAt(500, 3), psdAt(2100, 30), psdAt(2600, 40)}
+	cases := map[LatePolicy]struct {
+		out  []float32
+		late []float32
+	}{
+		LateDrop:       {[]float32{1, 15, 35}, []float32{}},
+		LateSideOutput: {[]float32{1, 15, 35}, []float32{3}},
+		LateUpdate:     {[]float32{1, 2, 15, 35}, []float32{}},
+	}
+
+	for policy, c := range cases {
+		window := NewTumblingWindowWithEventTime(time.Second, Average(), EventTime{
+			TimestampExtractor: sampleTimestamp,
+			MaxOutOfOrderness:  500 * time.Millisecond,
+			LatePolicy:         policy,
+			AllowedLateness:    time.Second,
+		})
+		out, late := runFlow(window, in)
+		if !reflect.DeepEqual(out, c.out) || !reflect.DeepEqual(late, c.late) {
+			t.Errorf("policy %d: expected %v and late %v, got %v and late %v", policy, c.out, c.late, out, late)
+		}
+	}
+}
+
+func TestDiscardingWindowLateness(t *testing.T) {
+	// Samples at 90 and 130 ms arrive after their windows emitted a sample, the sample at
+	// 210 ms after the watermark passed it but before its window emitted anything
+	in := []models.Sample{psdAt(0, 0), psdAt(50, 5), psdAt(120, 12), psdAt(110, 11), psdAt(400, 40), psdAt(90, 9), psdAt(210, 21), psdAt(130, 13)}
+	cases := map[LatePolicy]struct {
+		out  []float32
+		late []float32
+	}{
+		LateDrop:       {[]float32{0, 11, 40}, []float32{}},
+		LateSideOutput: {[]float32{0, 11, 40}, []float32{9, 21, 13}},
+		LateUpdate:     {[]float32{0, 11, 21, 40}, []float32{}},
+	}
+
+	for policy, c := range cases {
+		window := NewDiscardingWindowWithEventTime(100*time.Millisecond, EventTime{
+			TimestampExtractor: sampleTimestamp,
+			MaxOutOfOrderness:  150 * time.Millisecond,
+			LatePolicy:         policy,
+			AllowedLateness:    200 * time.Millisecond,
+		})
+		out, late := runFlow(window, in)
+		if !reflect.DeepEqual(out, c.out) || !reflect.DeepEqual(late, c.late) {
+			t.Errorf("policy %d: expected %v and late %v, got %v and late %v", policy, c.out, c.late, out, late)
+		}
+	}
+}
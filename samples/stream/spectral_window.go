@@ -0,0 +1,400 @@
+package stream
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/openrfsense/backend/database/models"
+	"github.com/reugn/go-streams"
+)
+
+// Aggregator combines the bins of the PSD frames of a window, in the order they were
+// recorded, into a single frame. Frames of different lengths are combined bin by bin.
+type Aggregator func(frames [][]float32) []float32
+
+// Average returns an Aggregator which averages each bin.
+func Average() Aggregator {
+	return func(frames [][]float32) []float32 {
+		return combine(frames, func(values []float32) float32 {
+			sum := 0.0
+			for _, v := range values {
+				sum += float64(v)
+			}
+			return float32(sum / float64(len(values)))
+		})
+	}
+}
+
+// MaxHold returns an Aggregator which keeps the highest value of each bin.
+func MaxHold() Aggregator {
+	return func(frames [][]float32) []float32 {
+		return combine(frames, slices.Max[[]float32])
+	}
+}
+
+// MinHold returns an Aggregator which keeps the lowest value of each bin.
+func MinHold() Aggregator {
+	return func(frames [][]float32) []float32 {
+		return combine(frames, slices.Min[[]float32])
+	}
+}
+
+// Percentile returns an Aggregator which keeps the p-th percentile (between 0 and 100) of
+// each bin, interpolating linearly between the closest values.
+func Percentile(p float64) Aggregator {
+	p = min(max(p, 0), 100)
+	return func(frames [][]float32) []float32 {
+		return combine(frames, func(values []float32) float32 {
+			slices.Sort(values)
+			rank := p / 100 * float64(len(values)-1)
+			lower := int(math.Floor(rank))
+			upper := int(math.Ceil(rank))
+			weight := float32(rank - float64(lower))
+			return values[lower] + (values[upper]-values[lower])*weight
+		})
+	}
+}
+
+// ExponentialAverage returns an Aggregator which averages each bin exponentially over the
+// frames of the window: each frame is weighted by alpha (between 0 and 1) and the average
+// of the previous frames by 1 - alpha.
+func ExponentialAverage(alpha float64) Aggregator {
+	alpha = min(max(alpha, 0), 1)
+	return func(frames [][]float32) []float32 {
+		return combine(frames, func(values []float32) float32 {
+			average := float64(values[0])
+			for _, v := range values[1:] {
+				average = alpha*float64(v) + (1-alpha)*average
+			}
+			return float32(average)
+		})
+	}
+}
+
+// combine applies fn to the values of each bin, in the order of the frames.
+func combine(frames [][]float32, fn func(values []float32) float32) []float32 {
+	bins := 0
+	for _, frame := range frames {
+		bins = max(bins, len(frame))
+	}
+
+	out := make([]float32, bins)
+	values := make([]float32, 0, len(frames))
+	for i := range out {
+		values = values[:0]
+		for _, frame := range frames {
+			if i < len(frame) {
+				values = append(values, frame[i])
+			}
+		}
+		out[i] = fn(values)
+	}
+	return out
+}
+
+// spectralFrame is a sample waiting in a window, along with its timestamp.
+type spectralFrame struct {
+	timestamp int64
+	sample    models.Sample
+}
+
+// spectralGroup holds the frames of samples which can be combined together.
+type spectralGroup struct {
+	key string
+
+	// Frames sorted by timestamp, kept as long as a window which contains them can still
+	// be emitted or updated
+	frames []spectralFrame
+
+	// Start of the next window to emit
+	next int64
+}
+
+// SpectralWindow combines the PSD frames of models.Sample elements over time windows and
+// emits a synthetic models.Sample for each window, whose data is the combination of the
+// frames by an Aggregator. Frames are only combined with frames of the same sensor,
+// campaign, sample type, center frequency, sampling rate and number of bins, so that
+// each window of a sweeping sensor gives a sample for each band.
+//
+// Windows are aligned on multiples of the sliding interval since the epoch, and are
+// emitted once the watermark passes their end (see EventTime), or once the input is
+// closed. The synthetic sample takes the metadata of the latest frame of the window and
+// the start of the window as its time. Windows without frames are not emitted.
+//
+// Elements are late once the watermark has passed the end of all the windows they belong
+// to, and are handled according to the LatePolicy. Elements which belong to both emitted
+// and pending windows are only added to the pending ones, unless the policy is LateUpdate.
+type SpectralWindow struct {
+	size      int64
+	slide     int64
+	aggregate Aggregator
+	eventTime EventTime
+	watermark watermark
+	groups    map[string]*spectralGroup
+	in        chan any
+	out       chan any
+	late      chan any
+}
+
+// Verify SpectralWindow satisfies the Flow interface.
+var _ streams.Flow = (*SpectralWindow)(nil)
+
+// NewTumblingWindow returns a new SpectralWindow whose windows are size long and do not
+// overlap. Elements must arrive in order, as they are late as soon as an element with a
+// later timestamp closed their window.
+//
+// timestampExtractor is the record timestamp (in nanoseconds) extractor, processing time
+// is used if nil.
+func NewTumblingWindow(size time.Duration, aggregate Aggregator, timestampExtractor func(any) int64) *SpectralWindow {
+	return NewSlidingWindow(size, size, aggregate, timestampExtractor)
+}
+
+// NewSlidingWindow returns a new SpectralWindow whose windows are size long and start
+// every slide, so that each frame is part of several windows if slide is shorter than size.
+// Elements must arrive in order, as they are late as soon as an element with a later
+// timestamp closed their windows.
+//
+// timestampExtractor is the record timestamp (in nanoseconds) extractor, processing time
+// is used if nil.
+func NewSlidingWindow(size time.Duration, slide time.Duration, aggregate Aggregator, timestampExtractor func(any) int64) *SpectralWindow {
+	return NewSlidingWindowWithEventTime(size, slide, aggregate, EventTime{TimestampExtractor: timestampExtractor})
+}
+
+// NewTumblingWindowWithEventTime returns a new SpectralWindow whose windows are size long
+// and do not overlap, with the given event time semantics.
+func NewTumblingWindowWithEventTime(size time.Duration, aggregate Aggregator, eventTime EventTime) *SpectralWindow {
+	return NewSlidingWindowWithEventTime(size, size, aggregate, eventTime)
+}
+
+// NewSlidingWindowWithEventTime returns a new SpectralWindow whose windows are size long
+// and start every slide, with the given event time semantics.
+func NewSlidingWindowWithEventTime(size time.Duration, slide time.Duration, aggregate Aggregator, eventTime EventTime) *SpectralWindow {
+	if size <= 0 || slide <= 0 {
+		panic(fmt.Sprintf("invalid window size %v or sliding interval %v", size, slide))
+	}
+
+	window := &SpectralWindow{
+		size:      int64(size),
+		slide:     int64(slide),
+		aggregate: aggregate,
+		eventTime: eventTime,
+		watermark: newWatermark(eventTime),
+		groups:    make(map[string]*spectralGroup),
+		in:        make(chan any),
+		out:       make(chan any),
+		late:      make(chan any),
+	}
+
+	go window.receive()
+	return window
+}
+
+// Via streams data through the given flow
+func (sw *SpectralWindow) Via(flow streams.Flow) streams.Flow {
+	go sw.transmit(flow)
+	return flow
+}
+
+// To streams data to the given sink
+func (sw *SpectralWindow) To(sink streams.Sink) {
+	sw.transmit(sink)
+}
+
+// Out returns an output channel for sending data
+func (sw *SpectralWindow) Out() <-chan any {
+	return sw.out
+}
+
+// In returns an input channel for receiving data
+func (sw *SpectralWindow) In() chan<- any {
+	return sw.in
+}
+
+// Late returns the channel late elements are sent on with LateSideOutput. It is closed
+// along with the output channel.
+func (sw *SpectralWindow) Late() <-chan any {
+	return sw.late
+}
+
+// transmit submits newly created windows to the next Inlet.
+func (sw *SpectralWindow) transmit(inlet streams.Inlet) {
+	for elem := range sw.Out() {
+		inlet.In() <- elem
+	}
+	close(inlet.In())
+}
+
+// windowResult is the combination of the frames of a window.
+type windowResult struct {
+	end    int64
+	key    string
+	sample models.Sample
+}
+
+func (sw *SpectralWindow) receive() {
+	for elem := range sw.in {
+		s, ok := elem.(models.Sample)
+		if !ok || len(s.Data) == 0 {
+			continue
+		}
+
+		ts := sw.eventTime.timestamp(elem)
+		results := sw.add(ts, s, elem)
+		sw.watermark.observe(ts)
+		results = append(results, sw.close(sw.watermark.current())...)
+		sw.send(results)
+	}
+
+	sw.send(sw.close(math.MaxInt64))
+	close(sw.late)
+	close(sw.out)
+}
+
+// add puts the sample in its group. Returns the windows updated by the sample, if it is
+// late and the policy is LateUpdate.
+func (sw *SpectralWindow) add(ts int64, s models.Sample, elem any) []windowResult {
+	key := groupKey(s)
+	group, ok := sw.groups[key]
+	if !ok {
+		group = &spectralGroup{key: key, next: math.MinInt64}
+		sw.groups[key] = group
+	}
+
+	watermark := sw.watermark.current()
+	late := sw.lastEnd(ts) <= watermark
+	if late {
+		switch {
+		case sw.eventTime.LatePolicy == LateSideOutput:
+			sw.late <- elem
+			return nil
+		case sw.eventTime.LatePolicy != LateUpdate || sw.lastEnd(ts)+sw.eventTime.allowedLateness() <= watermark:
+			return nil
+		}
+	}
+
+	// Frames are kept sorted, even if they arrive out of order
+	i, _ := slices.BinarySearchFunc(group.frames, ts, func(f spectralFrame, ts int64) int {
+		if f.timestamp > ts {
+			return 1
+		}
+		return -1
+	})
+	group.frames = slices.Insert(group.frames, i, spectralFrame{timestamp: ts, sample: s})
+
+	if sw.eventTime.LatePolicy != LateUpdate {
+		return nil
+	}
+
+	// Emit again the closed windows which contain the frame, as long as they can be updated
+	results := []windowResult{}
+	for start := sw.firstStart(ts); start <= ts && start < group.next; start += sw.slide {
+		if start+sw.size+sw.eventTime.allowedLateness() > watermark {
+			results = append(results, sw.combine(group, start))
+		}
+	}
+	return results
+}
+
+// close returns the windows which end before the watermark, and forgets the frames which
+// cannot be part of a window anymore.
+func (sw *SpectralWindow) close(watermark int64) []windowResult {
+	results := []windowResult{}
+
+	for _, group := range sw.groups {
+		for {
+			// Start of the first window which contains the earliest frame not yet emitted
+			i, _ := slices.BinarySearchFunc(group.frames, group.next, func(f spectralFrame, next int64) int {
+				if f.timestamp >= next {
+					return 1
+				}
+				return -1
+			})
+			if i == len(group.frames) {
+				break
+			}
+			start := max(group.next, sw.firstStart(group.frames[i].timestamp))
+			if start+sw.size > watermark {
+				break
+			}
+
+			results = append(results, sw.combine(group, start))
+			group.next = start + sw.slide
+		}
+
+		first := 0
+		for first < len(group.frames) && sw.lastEnd(group.frames[first].timestamp)+sw.eventTime.allowedLateness() <= watermark {
+			first++
+		}
+		group.frames = group.frames[first:]
+	}
+
+	return results
+}
+
+// combine returns the combination of the frames of the group in the window which starts at
+// the given time.
+func (sw *SpectralWindow) combine(group *spectralGroup, start int64) windowResult {
+	end := start + sw.size
+	frames := [][]float32{}
+	var last models.Sample
+	for _, f := range group.frames {
+		if f.timestamp >= end {
+			break
+		}
+		if f.timestamp >= start {
+			frames = append(frames, f.sample.Data)
+			last = f.sample
+		}
+	}
+
+	startTime := time.Unix(0, start)
+	sample := last
+	sample.SampleTime = models.SampleTime{
+		Seconds:      startTime.Unix(),
+		Microseconds: int32(startTime.Nanosecond() / int(time.Microsecond)),
+	}
+	sample.Data = sw.aggregate(frames)
+	return windowResult{end: end, key: group.key, sample: sample}
+}
+
+// send emits the windows in the order they end.
+func (sw *SpectralWindow) send(results []windowResult) {
+	slices.SortStableFunc(results, func(a, b windowResult) int {
+		return cmp.Or(cmp.Compare(a.end, b.end), strings.Compare(a.key, b.key))
+	})
+	for _, r := range results {
+		sw.out <- r.sample
+	}
+}
+
+// firstStart returns the start of the first window which contains the timestamp.
+func (sw *SpectralWindow) firstStart(ts int64) int64 {
+	return floorDiv(ts-sw.size, sw.slide)*sw.slide + sw.slide
+}
+
+// lastEnd returns the end of the last window which contains the timestamp.
+func (sw *SpectralWindow) lastEnd(ts int64) int64 {
+	return floorDiv(ts, sw.slide)*sw.slide + sw.size
+}
+
+// groupKey returns the key of the frames the sample can be combined with.
+func groupKey(s models.Sample) string {
+	samplingRate := 0
+	if s.SampleConfig.SamplingRate != nil {
+		samplingRate = *s.SampleConfig.SamplingRate
+	}
+	return fmt.Sprintf("%s/%s/%s/%d/%d/%d", s.CampaignId, s.SensorId, s.SampleType, s.SampleConfig.CenterFreq, samplingRate, len(s.Data))
+}
+
+// floorDiv returns a / b rounded towards negative infinity.
+func floorDiv(a int64, b int64) int64 {
+	q := a / b
+	if (a%b != 0) && ((a < 0) != (b < 0)) {
+		q--
+	}
+	return q
+}
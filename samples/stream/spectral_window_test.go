@@ -0,0 +1,88 @@
+package stream
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/openrfsense/backend/database/models"
+)
+
+func TestAggregators(t *testing.T) {
+	frames := [][]float32{{-90, -60}, {-70, -80}, {-80, -70, -50}}
+	cases := map[string]struct {
+		aggregate Aggregator
+		expected  []float32
+	}{
+		"average":     {Average(), []float32{-80, -70, -50}},
+		"max-hold":    {MaxHold(), []float32{-70, -60, -50}},
+		"min-hold":    {MinHold(), []float32{-90, -80, -50}},
+		"median":      {Percentile(50), []float32{-80, -70, -50}},
+		"percentile":  {Percentile(75), []float32{-75, -65, -50}},
+		"exponential": {ExponentialAverage(0.25), []float32{-83.75, -66.25, -50}},
+	}
+
+	for name, c := range cases {
+		if out := c.aggregate(frames); !reflect.DeepEqual(out, c.expected) {
+			t.Errorf("%s: expected %v, got %v", name, c.expected, out)
+		}
+	}
+}
+
+func TestSpectralWindow(t *testing.T) {
+	sample := func(center int64, ms int, v float32) models.Sample {
+		return models.Sample{
+			SensorId:     "sensor",
+			SampleType:   "PSD",
+			SampleTime:   models.SampleTime{Seconds: int64(ms / 1000), Microseconds: int32(ms%1000) * 1000},
+			SampleConfig: models.SampleConfig{CenterFreq: center},
+			Data:         []float32{v},
+		}
+	}
+	extractor := func(elem any) int64 {
+		s := elem.(models.Sample)
+		return s.SampleTime.Seconds*int64(time.Second) + int64(s.SampleTime.Microseconds)*int64(time.Microsecond)
+	}
+	run := func(window *SpectralWindow, in []models.Sample) []models.Sample {
+		go func() {
+			for _, s := range in {
+				window.In() <- s
+			}
+			close(window.In())
+		}()
+
+		out := []models.Sample{}
+		for elem := range window.Out() {
+			out = append(out, elem.(models.Sample))
+		}
+		return out
+	}
+
+	// Two bands, the second one sweeping less often
+	in := []models.Sample{
+		sample(100, 0, 1), sample(200, 100, 10), sample(100, 500, 3),
+		sample(100, 1200, 5), sample(100, 1700, 7), sample(200, 2100, 20), sample(100, 2500, 9),
+	}
+
+	out := run(NewTumblingWindow(time.Second, Average(), extractor), in)
+	expected := []struct {
+		center int64
+		second int64
+		value  float32
+	}{{100, 0, 2}, {200, 0, 10}, {100, 1, 6}, {100, 2, 9}, {200, 2, 20}}
+	if len(out) != len(expected) {
+		t.Fatalf("expected %d windows, got %v", len(expected), out)
+	}
+	for i, e := range expected {
+		s := out[i]
+		if s.SampleConfig.CenterFreq != e.center || s.SampleTime.Seconds != e.second || s.Data[0] != e.value {
+			t.Errorf("window %d: expected %v, got %v", i, e, s)
+		}
+	}
+
+	// Windows of 1 s every 500 ms, for a single band
+	out = run(NewSlidingWindow(time.Second, 500*time.Millisecond, MaxHold(), extractor), in[:1:1])
+	if len(out) != 2 || out[0].SampleTime.Microseconds != 500000 || out[0].SampleTime.Seconds != -1 || out[1].SampleTime.Seconds != 0 {
+		t.Fatalf("a frame should be part of two sliding windows, got %v", out)
+	}
+}
@@ -3,22 +3,118 @@ package stream
 import (
 	"bufio"
 	"context"
+	"crypto/tls"
 	"encoding/binary"
+	"errors"
+	"io"
+	"log"
 	"net"
+	"sync"
 	"time"
 
 	"github.com/reugn/go-streams"
 )
 
+// The TCP source speaks two protocols, told apart by the first four bytes sent by the
+// client. All integers are big endian.
+//
+// In the legacy one-shot mode the client sends a single frame (a uint32 length followed
+// by the payload) and closes the connection.
+//
+// In the persistent mode the client starts with a handshake:
+//
+//	magic "ORFS" | protocol version uint8 | schema version uint16 | sensor ID length uint8 | sensor ID
+//
+// to which the server replies with:
+//
+//	status uint8 | max frame size uint32 | ack window uint16
+//
+// If the status is not StatusOK the server closes the connection. Otherwise the client
+// can send any number of frames (uint32 length followed by the payload), and a frame of
+// length zero ends the session. After every `ack window` frames, and after the final
+// frame, the server sends an acknowledgement:
+//
+//	MessageAck uint8 | number of frames received so far uint64
+//
+// Protocol errors are reported with:
+//
+//	MessageError uint8 | status uint8
+//
+// after which the server closes the connection.
+//
+// Both modes can run over TLS. If the client presented a certificate, the sensor ID sent
+// in the handshake must match either its common name or one of its DNS names, and every
+// frame must be accepted by TCPSourceConfig.Authorize.
+const (
+	// Sent by clients at the start of the handshake
+	Magic = "ORFS"
+
+	// Current version of the persistent protocol
+	ProtocolVersion = 1
+)
+
+// Status codes sent by the server
+const (
+	StatusOK uint8 = iota
+	StatusUnsupportedVersion
+	StatusUnsupportedSchema
+	StatusFrameTooLarge
+	StatusInvalidHandshake
+	StatusUnauthorized
+)
+
+// Types of messages sent by the server after the handshake
+const (
+	MessageAck uint8 = iota + 1
+	MessageError
+)
+
+// TCPSourceConfig contains the framing parameters of a TCPSource.
+type TCPSourceConfig struct {
+	// Frames larger than this are rejected
+	MaxFrameSize uint32
+
+	// Number of frames after which the server sends an acknowledgement
+	AckWindow uint16
+
+	// Schema versions accepted during the handshake
+	SchemaVersions []uint16
+
+	// Connections are closed after this long without receiving anything
+	IdleTimeout time.Duration
+
+	// Enables TLS on the listener if not nil
+	TLS *tls.Config
+
+	// Called for each frame sent by a client which presented a certificate, with the
+	// names from the certificate. Frames are rejected if it returns false.
+	Authorize func(identities []string, frame []byte) bool
+}
+
+var defaultTCPSourceConfig = TCPSourceConfig{
+	MaxFrameSize:   16 << 20,
+	AckWindow:      16,
+	SchemaVersions: []uint16{1},
+	IdleTimeout:    time.Minute,
+}
+
 // TCPSource represents an inbound network socket connector.
 type TCPSource struct {
 	ctx      context.Context
 	listener net.Listener
+	config   TCPSourceConfig
+	wg       sync.WaitGroup
 	out      chan any
 }
 
-// NewTCPSource returns a new instance of TCPSource.
+// NewTCPSource returns a new instance of TCPSource with the default framing parameters.
 func NewTCPSource(ctx context.Context, address string) (*TCPSource, error) {
+	return NewTCPSourceWithConfig(ctx, address, defaultTCPSourceConfig)
+}
+
+// NewTCPSourceWithConfig returns a new instance of TCPSource. Zero values in the
+// configuration are replaced with the defaults.
+func NewTCPSourceWithConfig(ctx context.Context, address string, config TCPSourceConfig) (*TCPSource, error) {
 	var err error
 	var listener net.Listener
 	out := make(chan any)
@@ -27,12 +123,32 @@ func NewTCPSource(ctx context.Context, address string) (*TCPSource, error) {
 	if err != nil {
 		return nil, err
 	}
+	if config.TLS != nil {
+		listener = tls.NewListener(listener, config.TLS)
+	}
+
+	if config.MaxFrameSize == 0 {
+		config.MaxFrameSize = defaultTCPSourceConfig.MaxFrameSize
+	}
+	if config.AckWindow == 0 {
+		config.AckWindow = defaultTCPSourceConfig.AckWindow
+	}
+	if len(config.SchemaVersions) == 0 {
+		config.SchemaVersions = defaultTCPSourceConfig.SchemaVersions
+	}
+	if config.IdleTimeout <= 0 {
+		config.IdleTimeout = defaultTCPSourceConfig.IdleTimeout
+	}
 
 	source := &TCPSource{
 		ctx:      ctx,
 		listener: listener,
+		config:   config,
 		out:      out,
 	}
+	// The accept loop is counted as well, so that connections are never added once
+	// listenCtx is waiting for them
+	source.wg.Add(1)
 	go source.acceptConnections()
 	go source.listenCtx()
 
@@ -42,15 +158,24 @@ func NewTCPSource(ctx context.Context, address string) (*TCPSource, error) {
 func (ts *TCPSource) listenCtx() {
 	<-ts.ctx.Done()
 
-	close(ts.out)
-
 	if ts.listener != nil {
 		ts.listener.Close()
 	}
+
+	// Open connections are closed along with the context
+	ts.wg.Wait()
+	close(ts.out)
+}
+
+// Returns the address the source is listening on.
+func (ts *TCPSource) Addr() net.Addr {
+	return ts.listener.Addr()
 }
 
 // acceptConnections accepts new TCP connectiots.
 func (ts *TCPSource) acceptConnections() {
+	defer ts.wg.Done()
+
 	for {
 		// accept a new connection
 		conn, err := ts.listener.Accept()
@@ -59,26 +184,222 @@ func (ts *TCPSource) acceptConnections() {
 		}
 
 		// handle the new connection
-		go handleConnection(conn, ts.out)
+		ts.wg.Add(1)
+		go ts.handleConnection(conn)
 	}
 }
 
 // handleConnection handles new connectiots.
-func handleConnection(conn net.Conn, out chan<- any) {
+func (ts *TCPSource) handleConnection(conn net.Conn) {
+	defer ts.wg.Done()
 	defer conn.Close()
 
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ts.ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	_ = conn.SetReadDeadline(time.Now().Add(ts.config.IdleTimeout))
+	identities, err := peerIdentities(conn)
+	if err != nil {
+		log.Printf("tcp source: %s: %v", conn.RemoteAddr(), err)
+		return
+	}
+
 	reader := bufio.NewReader(conn)
-	dataSize := make([]byte, 4)
-	_, err := reader.Read(dataSize)
+	header := make([]byte, 4)
+	_, err = io.ReadFull(reader, header)
 	if err != nil {
 		return
 	}
 
-	bufferBytes := make([]byte, binary.BigEndian.Uint32(dataSize))
-	_, err = reader.Read(bufferBytes)
-	if err == nil && len(bufferBytes) > 0 {
-		out <- bufferBytes
+	if string(header) != Magic {
+		ts.handleOneShot(reader, binary.BigEndian.Uint32(header), identities)
+		return
 	}
+
+	err = ts.handleSession(conn, reader, identities)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+		log.Printf("tcp source: %s: %v", conn.RemoteAddr(), err)
+	}
+}
+
+// Reads the single frame of a legacy connection, whose length has already been read.
+func (ts *TCPSource) handleOneShot(reader io.Reader, size uint32, identities []string) {
+	if size == 0 || size > ts.config.MaxFrameSize {
+		return
+	}
+
+	frame := make([]byte, size)
+	_, err := io.ReadFull(reader, frame)
+	if err != nil || !ts.authorize(identities, frame) {
+		return
+	}
+
+	ts.emit(frame)
+}
+
+// Runs the handshake of a persistent connection, whose magic has already been read, then
+// reads frames until the client ends the session.
+func (ts *TCPSource) handleSession(conn net.Conn, reader *bufio.Reader, identities []string) error {
+	writer := bufio.NewWriter(conn)
+
+	handshake := make([]byte, 4)
+	_, err := io.ReadFull(reader, handshake)
+	if err != nil {
+		return err
+	}
+	version := handshake[0]
+	schema := binary.BigEndian.Uint16(handshake[1:3])
+	sensorId := make([]byte, handshake[3])
+	_, err = io.ReadFull(reader, sensorId)
+	if err != nil {
+		return err
+	}
+
+	status := StatusOK
+	switch {
+	case version != ProtocolVersion:
+		status = StatusUnsupportedVersion
+	case !containsVersion(ts.config.SchemaVersions, schema):
+		status = StatusUnsupportedSchema
+	case len(sensorId) == 0:
+		status = StatusInvalidHandshake
+	case identities != nil && !contains(identities, string(sensorId)):
+		status = StatusUnauthorized
+	}
+
+	reply := make([]byte, 7)
+	reply[0] = status
+	binary.BigEndian.PutUint32(reply[1:5], ts.config.MaxFrameSize)
+	binary.BigEndian.PutUint16(reply[5:7], ts.config.AckWindow)
+	_, _ = writer.Write(reply)
+	err = writer.Flush()
+	if err != nil || status != StatusOK {
+		return err
+	}
+
+	var received uint64
+	size := make([]byte, 4)
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(ts.config.IdleTimeout))
+		_, err = io.ReadFull(reader, size)
+		if err != nil {
+			return err
+		}
+
+		length := binary.BigEndian.Uint32(size)
+		if length == 0 {
+			return writeAck(writer, received)
+		}
+		if length > ts.config.MaxFrameSize {
+			_, _ = writer.Write([]byte{MessageError, StatusFrameTooLarge})
+			_ = writer.Flush()
+			return errors.New("frame too large from sensor " + string(sensorId))
+		}
+
+		frame := make([]byte, length)
+		_, err = io.ReadFull(reader, frame)
+		if err != nil {
+			return err
+		}
+		if !ts.authorize(identities, frame) {
+			_, _ = writer.Write([]byte{MessageError, StatusUnauthorized})
+			_ = writer.Flush()
+			return errors.New("unauthorized frame from sensor " + string(sensorId))
+		}
+
+		if !ts.emit(frame) {
+			return nil
+		}
+
+		received++
+		if received%uint64(ts.config.AckWindow) == 0 {
+			err = writeAck(writer, received)
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Checks a frame against the identities of an authenticated client.
+func (ts *TCPSource) authorize(identities []string, frame []byte) bool {
+	if identities == nil || ts.config.Authorize == nil {
+		return true
+	}
+
+	return ts.config.Authorize(identities, frame)
+}
+
+// Runs the TLS handshake, if needed, and returns the common name and DNS names of the
+// client certificate. Returns nil if the client did not present a certificate.
+func peerIdentities(conn net.Conn) ([]string, error) {
+	tlsConn, ok := conn.(*tls.Conn)
+	if !ok {
+		return nil, nil
+	}
+
+	err := tlsConn.Handshake()
+	if err != nil {
+		return nil, err
+	}
+
+	certs := tlsConn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return nil, nil
+	}
+
+	identities := []string{}
+	if certs[0].Subject.CommonName != "" {
+		identities = append(identities, certs[0].Subject.CommonName)
+	}
+
+	return append(identities, certs[0].DNSNames...), nil
+}
+
+// Sends a frame downstream. Returns false if the source is shutting down.
+func (ts *TCPSource) emit(frame []byte) bool {
+	select {
+	case ts.out <- frame:
+		return true
+	case <-ts.ctx.Done():
+		return false
+	}
+}
+
+// Acknowledges all frames received so far.
+func writeAck(writer *bufio.Writer, received uint64) error {
+	ack := make([]byte, 9)
+	ack[0] = MessageAck
+	binary.BigEndian.PutUint64(ack[1:], received)
+	_, _ = writer.Write(ack)
+	return writer.Flush()
+}
+
+func containsVersion(versions []uint16, version uint16) bool {
+	for _, v := range versions {
+		if v == version {
+			return true
+		}
+	}
+
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
 }
 
 // Streams data through the given flow
@@ -0,0 +1,248 @@
+package stream
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"io"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+)
+
+func startSource(t *testing.T, config ...TCPSourceConfig) *TCPSource {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	cfg := TCPSourceConfig{}
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+	cfg.MaxFrameSize = 1024
+	cfg.AckWindow = 2
+
+	source, err := NewTCPSourceWithConfig(ctx, "127.0.0.1:0", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return source
+}
+
+// Creates a certificate signed by the given parent, or a self-signed CA if parent is nil.
+func certificate(t *testing.T, template *x509.Certificate, parent *tls.Certificate) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.NotBefore = time.Now().Add(-time.Minute)
+	template.NotAfter = time.Now().Add(time.Hour)
+
+	parentCert, parentKey := template, any(key)
+	if parent != nil {
+		parentCert, parentKey = parent.Leaf, parent.PrivateKey
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parentCert, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func frame(payload []byte) []byte {
+	size := make([]byte, 4)
+	binary.BigEndian.PutUint32(size, uint32(len(payload)))
+	return append(size, payload...)
+}
+
+func receive(t *testing.T, source *TCPSource) []byte {
+	select {
+	case got := <-source.Out():
+		return got.([]byte)
+	case <-time.After(time.Second):
+		t.Fatal("no frame received")
+	}
+	return nil
+}
+
+func TestOneShot(t *testing.T) {
+	source := startSource(t)
+
+	conn, err := net.Dial("tcp", source.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	payload := bytes.Repeat([]byte{1}, 1000)
+	_, _ = conn.Write(frame(payload))
+
+	if got := receive(t, source); !bytes.Equal(got, payload) {
+		t.Fatalf("frame was truncated to %d bytes", len(got))
+	}
+}
+
+func TestSession(t *testing.T) {
+	source := startSource(t)
+
+	conn, err := net.Dial("tcp", source.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	handshake := []byte(Magic)
+	handshake = append(handshake, ProtocolVersion, 0, 1, 6)
+	handshake = append(handshake, "sensor"...)
+	_, _ = conn.Write(handshake)
+
+	reply := make([]byte, 7)
+	_, err = io.ReadFull(conn, reply)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply[0] != StatusOK || binary.BigEndian.Uint16(reply[5:]) != 2 {
+		t.Fatalf("unexpected handshake reply %v", reply)
+	}
+
+	// Many frames on the same connection, acknowledged every two frames
+	for i := byte(0); i < 3; i++ {
+		_, _ = conn.Write(frame([]byte{i}))
+		if got := receive(t, source); got[0] != i {
+			t.Fatalf("expected frame %d, got %d", i, got[0])
+		}
+	}
+	_, _ = conn.Write(frame(nil))
+
+	ack := make([]byte, 9)
+	for _, expected := range []uint64{2, 3} {
+		_, err = io.ReadFull(conn, ack)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ack[0] != MessageAck || binary.BigEndian.Uint64(ack[1:]) != expected {
+			t.Fatalf("expected acknowledgement of %d frames, got %v", expected, ack)
+		}
+	}
+}
+
+func TestFrameTooLarge(t *testing.T) {
+	source := startSource(t)
+
+	conn, err := net.Dial("tcp", source.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	handshake := append([]byte(Magic), ProtocolVersion, 0, 1, 1, 's')
+	_, _ = conn.Write(handshake)
+	_, _ = io.ReadFull(conn, make([]byte, 7))
+
+	// Only the length is needed for the frame to be rejected
+	_, _ = conn.Write(frame(make([]byte, 2048))[:4])
+	reply := make([]byte, 2)
+	_, err = io.ReadFull(conn, reply)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply[0] != MessageError || reply[1] != StatusFrameTooLarge {
+		t.Fatalf("unexpected reply %v", reply)
+	}
+}
+
+func TestMutualTLS(t *testing.T) {
+	ca := certificate(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "test CA"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil)
+	server := certificate(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "collector"},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, &ca)
+	client := certificate(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "sensor"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, &ca)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Leaf)
+
+	// Frames simply contain the ID of the sensor they belong to
+	source := startSource(t, TCPSourceConfig{
+		TLS: &tls.Config{
+			Certificates: []tls.Certificate{server},
+			ClientCAs:    pool,
+			ClientAuth:   tls.RequireAndVerifyClientCert,
+		},
+		Authorize: func(identities []string, frame []byte) bool {
+			return contains(identities, string(frame))
+		},
+	})
+
+	dial := func(sensorId string) (net.Conn, byte) {
+		conn, err := tls.Dial("tcp", source.Addr().String(), &tls.Config{
+			Certificates: []tls.Certificate{client},
+			RootCAs:      pool,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { conn.Close() })
+
+		handshake := append([]byte(Magic), ProtocolVersion, 0, 1, byte(len(sensorId)))
+		_, _ = conn.Write(append(handshake, sensorId...))
+		reply := make([]byte, 7)
+		_, err = io.ReadFull(conn, reply)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return conn, reply[0]
+	}
+
+	// The sensor ID in the handshake must match the certificate
+	_, status := dial("other")
+	if status != StatusUnauthorized {
+		t.Fatalf("expected handshake to be refused, got status %d", status)
+	}
+
+	conn, status := dial("sensor")
+	if status != StatusOK {
+		t.Fatalf("expected handshake to succeed, got status %d", status)
+	}
+
+	_, _ = conn.Write(frame([]byte("sensor")))
+	if got := receive(t, source); string(got) != "sensor" {
+		t.Fatalf("unexpected frame %q", got)
+	}
+
+	// Samples belonging to other sensors are rejected
+	_, _ = conn.Write(frame([]byte("other")))
+	reply := make([]byte, 2)
+	_, err := io.ReadFull(conn, reply)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply[0] != MessageError || reply[1] != StatusUnauthorized {
+		t.Fatalf("unexpected reply %v", reply)
+	}
+}
@@ -0,0 +1,179 @@
+package stream
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/reugn/go-streams"
+)
+
+// Each datagram received by the UDP source carries a single frame, prefixed with a big
+// endian uint32 sequence number which the sender increments for each datagram. Sequence
+// numbers are tracked separately for each sender address and may wrap around.
+const (
+	// Largest payload of a UDP datagram over IPv4
+	maxDatagramSize = 65507
+
+	// Senders which have not been heard from for this long are forgotten
+	peerExpiration = 10 * time.Minute
+)
+
+// UDPSourceStats contains the counters of a UDPSource.
+type UDPSourceStats struct {
+	// Datagrams received and sent downstream
+	Received uint64
+
+	// Datagrams which never arrived, according to gaps in the sequence numbers
+	Dropped uint64
+
+	// Datagrams which arrived after a datagram with a later sequence number. They are
+	// still sent downstream, but were also counted as dropped when the gap was seen.
+	OutOfOrder uint64
+
+	// Datagrams too short to contain a sequence number
+	Malformed uint64
+}
+
+// UDPSource represents an inbound UDP connector.
+type UDPSource struct {
+	// Accessed atomically, must stay 64-bit aligned
+	stats UDPSourceStats
+
+	ctx   context.Context
+	conn  net.PacketConn
+	peers map[string]*udpPeer
+	mu    sync.Mutex
+	out   chan any
+}
+
+// Last sequence number received from a sender
+type udpPeer struct {
+	sequence uint32
+	lastSeen time.Time
+}
+
+// NewUDPSource returns a new instance of UDPSource.
+func NewUDPSource(ctx context.Context, address string) (*UDPSource, error) {
+	conn, err := net.ListenPacket("udp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	source := &UDPSource{
+		ctx:   ctx,
+		conn:  conn,
+		peers: map[string]*udpPeer{},
+		out:   make(chan any),
+	}
+	go source.receive()
+	go source.listenCtx()
+
+	return source, nil
+}
+
+func (us *UDPSource) listenCtx() {
+	ticker := time.NewTicker(peerExpiration)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-us.ctx.Done():
+			us.conn.Close()
+			return
+		case <-ticker.C:
+			us.expirePeers()
+		}
+	}
+}
+
+// Returns the address the source is listening on.
+func (us *UDPSource) Addr() net.Addr {
+	return us.conn.LocalAddr()
+}
+
+// Returns a snapshot of the counters of the source.
+func (us *UDPSource) Stats() UDPSourceStats {
+	return UDPSourceStats{
+		Received:   atomic.LoadUint64(&us.stats.Received),
+		Dropped:    atomic.LoadUint64(&us.stats.Dropped),
+		OutOfOrder: atomic.LoadUint64(&us.stats.OutOfOrder),
+		Malformed:  atomic.LoadUint64(&us.stats.Malformed),
+	}
+}
+
+// receive reads datagrams until the source is closed.
+func (us *UDPSource) receive() {
+	defer close(us.out)
+
+	buffer := make([]byte, maxDatagramSize)
+	for {
+		n, addr, err := us.conn.ReadFrom(buffer)
+		if err != nil {
+			return
+		}
+		if n <= 4 {
+			atomic.AddUint64(&us.stats.Malformed, 1)
+			continue
+		}
+
+		us.track(addr.String(), binary.BigEndian.Uint32(buffer[:4]))
+		atomic.AddUint64(&us.stats.Received, 1)
+
+		frame := make([]byte, n-4)
+		copy(frame, buffer[4:n])
+		select {
+		case us.out <- frame:
+		case <-us.ctx.Done():
+			return
+		}
+	}
+}
+
+// Updates the loss counters with the sequence number of a datagram.
+func (us *UDPSource) track(addr string, sequence uint32) {
+	us.mu.Lock()
+	defer us.mu.Unlock()
+
+	peer, ok := us.peers[addr]
+	if !ok {
+		us.peers[addr] = &udpPeer{sequence: sequence, lastSeen: time.Now()}
+		return
+	}
+	peer.lastSeen = time.Now()
+
+	// Differences are computed modulo 2^32 to handle wrap-arounds
+	delta := sequence - peer.sequence
+	switch {
+	case delta == 0 || delta >= 1<<31:
+		atomic.AddUint64(&us.stats.OutOfOrder, 1)
+	default:
+		atomic.AddUint64(&us.stats.Dropped, uint64(delta-1))
+		peer.sequence = sequence
+	}
+}
+
+func (us *UDPSource) expirePeers() {
+	us.mu.Lock()
+	defer us.mu.Unlock()
+
+	for addr, peer := range us.peers {
+		if time.Since(peer.lastSeen) > peerExpiration {
+			delete(us.peers, addr)
+		}
+	}
+}
+
+// Streams data through the given flow
+func (us *UDPSource) Via(_flow streams.Flow) streams.Flow {
+	go doStream(us, _flow)
+	return _flow
+}
+
+// Returns an output channel for sending data
+func (us *UDPSource) Out() <-chan any {
+	return us.out
+}
@@ -0,0 +1,43 @@
+package stream
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestUDPLoss(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	source, err := NewUDPSource(ctx, "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := net.Dial("udp", source.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// Datagrams 1 and 2 are lost, and 2 arrives late. Sequence numbers wrap around.
+	for _, sequence := range []uint32{1<<32 - 1, 0, 3, 2} {
+		datagram := make([]byte, 5)
+		binary.BigEndian.PutUint32(datagram, sequence)
+		_, _ = conn.Write(datagram)
+
+		select {
+		case <-source.Out():
+		case <-time.After(time.Second):
+			t.Fatal("no frame received")
+		}
+	}
+
+	expected := UDPSourceStats{Received: 4, Dropped: 2, OutOfOrder: 1}
+	if stats := source.Stats(); stats != expected {
+		t.Fatalf("expected %+v, got %+v", expected, stats)
+	}
+}
@@ -0,0 +1,291 @@
+package stream
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/cmplx"
+
+	"github.com/openrfsense/backend/database/models"
+	"github.com/reugn/go-streams"
+)
+
+// Window functions which can be used by Welch
+const (
+	WindowRectangular = "rectangular"
+	WindowHann        = "hann"
+	WindowHamming     = "hamming"
+	WindowBlackman    = "blackman"
+)
+
+const (
+	// FFT size used if none is configured
+	defaultFFTSize = 1024
+
+	// Bounds of the FFT size
+	minFFTSize = 16
+	maxFFTSize = 65536
+
+	// Overlap used if none is configured
+	defaultOverlap = 0.5
+)
+
+var ErrNotIQ = errors.New("sample does not hold IQ data")
+
+// WelchConfig holds the parameters of Welch's method.
+type WelchConfig struct {
+	// Number of IQ samples in each segment, a power of two (1024 by default)
+	FFTSize int `json:"fftSize,omitempty"`
+
+	// Window function applied to each segment: rectangular, hann (the default), hamming
+	// or blackman
+	Window string `json:"window,omitempty"`
+
+	// Fraction of each segment overlapping the next one, at least 0 and less than 1 (0.5
+	// by default)
+	Overlap *float64 `json:"overlap,omitempty"`
+}
+
+// Validate returns an error if the configuration is invalid.
+func (wc WelchConfig) Validate() error {
+	wc = wc.normalized()
+	if wc.FFTSize < minFFTSize || wc.FFTSize > maxFFTSize || wc.FFTSize&(wc.FFTSize-1) != 0 {
+		return fmt.Errorf("FFT size must be a power of two between %d and %d", minFFTSize, maxFFTSize)
+	}
+	if windowFunction(wc.Window) == nil {
+		return fmt.Errorf("unknown window function %q", wc.Window)
+	}
+	if *wc.Overlap < 0 || *wc.Overlap >= 1 {
+		return errors.New("overlap must be at least 0 and less than 1")
+	}
+	return nil
+}
+
+// normalized returns the configuration with missing values replaced by defaults.
+func (wc WelchConfig) normalized() WelchConfig {
+	if wc.FFTSize == 0 {
+		wc.FFTSize = defaultFFTSize
+	}
+	if wc.Window == "" {
+		wc.Window = WindowHann
+	}
+	if wc.Overlap == nil {
+		overlap := defaultOverlap
+		wc.Overlap = &overlap
+	}
+	return wc
+}
+
+// windowFunction returns the coefficient of the window at index i of n, or nil if the
+// window is unknown.
+func windowFunction(name string) func(i int, n int) float64 {
+	cosine := func(a ...float64) func(i int, n int) float64 {
+		return func(i int, n int) float64 {
+			w := 0.0
+			for k, ak := range a {
+				w += math.Pow(-1, float64(k)) * ak * math.Cos(2*math.Pi*float64(k*i)/float64(n))
+			}
+			return w
+		}
+	}
+
+	switch name {
+	case WindowRectangular:
+		return cosine(1)
+	case WindowHann:
+		return cosine(0.5, 0.5)
+	case WindowHamming:
+		return cosine(0.54, 0.46)
+	case WindowBlackman:
+		return cosine(0.42, 0.5, 0.08)
+	}
+	return nil
+}
+
+// Welch returns the power spectral density of an IQ sample, estimated with Welch's method:
+// the IQ samples (interleaved I and Q values in Data) are split into overlapping segments
+// of the FFT size, each segment is multiplied by the window function and transformed, and
+// the power of each bin is averaged over all segments. Records shorter than the FFT size
+// are padded with zeros.
+//
+// Before the transform, the IQ samples are shifted by -FrequencyCorrectionFactor Hz so that
+// the bins are centered on CenterFreq. The density is returned in dB/Hz (or dB per bin if
+// the sampling rate is unknown) with the antenna gain subtracted, ordered from the lowest
+// to the highest frequency. The returned sample is a copy of the IQ sample with the PSD
+// type and data, and no frequency correction left to apply.
+func Welch(config WelchConfig, s models.Sample) (models.Sample, error) {
+	if s.SampleType != "IQ" || len(s.Data) < 2 {
+		return models.Sample{}, ErrNotIQ
+	}
+
+	config = config.normalized()
+	err := config.Validate()
+	if err != nil {
+		return models.Sample{}, err
+	}
+
+	iq := make([]complex128, len(s.Data)/2)
+	for i := range iq {
+		iq[i] = complex(float64(s.Data[2*i]), float64(s.Data[2*i+1]))
+	}
+
+	samplingRate := 1.0
+	if s.SampleConfig.SamplingRate != nil && *s.SampleConfig.SamplingRate > 0 {
+		samplingRate = float64(*s.SampleConfig.SamplingRate)
+	}
+	if s.SampleConfig.FrequencyCorrectionFactor != nil && *s.SampleConfig.FrequencyCorrectionFactor != 0 {
+		shift := -2 * math.Pi * float64(*s.SampleConfig.FrequencyCorrectionFactor) / samplingRate
+		for i := range iq {
+			iq[i] *= cmplx.Rect(1, shift*float64(i))
+		}
+	}
+
+	n := config.FFTSize
+	window := make([]float64, n)
+	windowPower := 0.0
+	windowFn := windowFunction(config.Window)
+	for i := range window {
+		window[i] = windowFn(i, n)
+		windowPower += window[i] * window[i]
+	}
+
+	overlap := *config.Overlap
+	step := max(n-int(math.Round(float64(n)*overlap)), 1)
+	power := make([]float64, n)
+	segment := make([]complex128, n)
+	segments := 0
+	for start := 0; start == 0 || start+n <= len(iq); start += step {
+		clear(segment)
+		for i, v := range iq[start:min(start+n, len(iq))] {
+			segment[i] = v * complex(window[i], 0)
+		}
+
+		fft(segment)
+		for k, v := range segment {
+			power[k] += real(v)*real(v) + imag(v)*imag(v)
+		}
+		segments++
+	}
+
+	gain := 0.0
+	if s.SampleConfig.AntennaGain != nil {
+		gain = float64(*s.SampleConfig.AntennaGain)
+	}
+
+	// Bins are shifted so that the zero frequency is in the middle
+	psd := make([]float32, n)
+	scale := samplingRate * windowPower * float64(segments)
+	for k, p := range power {
+		psd[(k+n/2)%n] = float32(10*math.Log10(max(p/scale, math.SmallestNonzeroFloat64)) - gain)
+	}
+
+	out := s
+	out.SampleType = "PSD"
+	out.Data = psd
+	if out.SampleConfig.FrequencyCorrectionFactor != nil {
+		corrected := float32(0)
+		out.SampleConfig.FrequencyCorrectionFactor = &corrected
+	}
+	return out, nil
+}
+
+// fft computes the discrete Fourier transform of x in place. The length of x must be a
+// power of two.
+func fft(x []complex128) {
+	n := len(x)
+
+	// Bit reversal permutation
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+		if i < j {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+
+	for size := 2; size <= n; size <<= 1 {
+		step := cmplx.Rect(1, -2*math.Pi/float64(size))
+		for start := 0; start < n; start += size {
+			w := complex(1, 0)
+			for k := 0; k < size/2; k++ {
+				even, odd := x[start+k], x[start+k+size/2]*w
+				x[start+k], x[start+k+size/2] = even+odd, even-odd
+				w *= step
+			}
+		}
+	}
+}
+
+// WelchFlow computes the power spectral density of the IQ models.Sample elements which go
+// through it (see Welch). Other elements are passed through untouched, and IQ samples
+// which cannot be transformed are discarded.
+type WelchFlow struct {
+	config WelchConfig
+	in     chan any
+	out    chan any
+}
+
+// Verify WelchFlow satisfies the Flow interface.
+var _ streams.Flow = (*WelchFlow)(nil)
+
+// NewWelchFlow returns a new WelchFlow. The configuration must be valid.
+func NewWelchFlow(config WelchConfig) *WelchFlow {
+	wf := &WelchFlow{
+		config: config,
+		in:     make(chan any),
+		out:    make(chan any),
+	}
+
+	go wf.transform()
+	return wf
+}
+
+// Via streams data through the given flow
+func (wf *WelchFlow) Via(flow streams.Flow) streams.Flow {
+	go wf.transmit(flow)
+	return flow
+}
+
+// To streams data to the given sink
+func (wf *WelchFlow) To(sink streams.Sink) {
+	wf.transmit(sink)
+}
+
+// Out returns an output channel for sending data
+func (wf *WelchFlow) Out() <-chan any {
+	return wf.out
+}
+
+// In returns an input channel for receiving data
+func (wf *WelchFlow) In() chan<- any {
+	return wf.in
+}
+
+// transmit submits transformed elements to the next Inlet.
+func (wf *WelchFlow) transmit(inlet streams.Inlet) {
+	for elem := range wf.Out() {
+		inlet.In() <- elem
+	}
+	close(inlet.In())
+}
+
+func (wf *WelchFlow) transform() {
+	for elem := range wf.in {
+		s, ok := elem.(models.Sample)
+		if !ok || s.SampleType != "IQ" {
+			wf.out <- elem
+			continue
+		}
+
+		psd, err := Welch(wf.config, s)
+		if err != nil {
+			continue
+		}
+		wf.out <- psd
+	}
+
+	close(wf.out)
+}
@@ -0,0 +1,67 @@
+package stream
+
+import (
+	"math"
+	"math/cmplx"
+	"slices"
+	"testing"
+
+	"github.com/openrfsense/backend/database/models"
+)
+
+func TestWelch(t *testing.T) {
+	const n = 64
+	samplingRate := 64000
+	correction := float32(2000)
+	gain := float32(3)
+
+	// A tone 8 kHz above the center frequency, shifted by the frequency correction
+	iq := make([]float32, 0, 2*4*n)
+	for i := 0; i < 4*n; i++ {
+		v := cmplx.Rect(1, 2*math.Pi*float64(8000+correction)*float64(i)/float64(samplingRate))
+		iq = append(iq, float32(real(v)), float32(imag(v)))
+	}
+	s := models.Sample{
+		SampleType: "IQ",
+		SampleConfig: models.SampleConfig{
+			SamplingRate:              &samplingRate,
+			FrequencyCorrectionFactor: &correction,
+			AntennaGain:               &gain,
+		},
+		Data: iq,
+	}
+
+	for _, window := range []string{WindowRectangular, WindowHann, WindowHamming, WindowBlackman} {
+		psd, err := Welch(WelchConfig{FFTSize: n, Window: window}, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if psd.SampleType != "PSD" || len(psd.Data) != n || *psd.SampleConfig.FrequencyCorrectionFactor != 0 {
+			t.Fatalf("%s: unexpected sample %+v", window, psd)
+		}
+
+		// Bins are 1 kHz wide, starting 32 kHz below the center frequency
+		peak := slices.Index(psd.Data, slices.Max(psd.Data))
+		if peak != n/2+8 {
+			t.Errorf("%s: expected the peak in bin %d, got %d", window, n/2+8, peak)
+		}
+
+		// The power of the tone is spread over the equivalent noise bandwidth of the window
+		total := 0.0
+		for _, v := range psd.Data {
+			total += math.Pow(10, float64(v+gain)/10) * float64(samplingRate) / n
+		}
+		if math.Abs(total-1) > 0.01 {
+			t.Errorf("%s: expected a total power of 1, got %v", window, total)
+		}
+	}
+
+	_, err := Welch(WelchConfig{FFTSize: 100}, s)
+	if err == nil {
+		t.Error("FFT sizes must be powers of two")
+	}
+	_, err = Welch(WelchConfig{}, models.Sample{SampleType: "PSD", Data: []float32{1, 2}})
+	if err != ErrNotIQ {
+		t.Errorf("expected ErrNotIQ, got %v", err)
+	}
+}
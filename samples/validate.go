@@ -0,0 +1,251 @@
+package samples
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/reugn/go-streams"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/openrfsense/backend/database"
+	"github.com/openrfsense/backend/database/models"
+	"github.com/openrfsense/backend/nats"
+	"github.com/openrfsense/backend/tracing"
+)
+
+// Campaigns are looked up again after this long, so that samples do not each cost a query
+const campaignCacheTTL = 5 * time.Second
+
+// Samples which were already validated, or released from the quarantine, are sent
+// through this channel to be stored without validation
+var trusted = make(chan []byte)
+
+// The validator of the running collector
+var pipeline *validator
+
+var tracer = otel.Tracer("github.com/openrfsense/backend/samples")
+
+var _ streams.Flow = (*validator)(nil)
+
+// Type validator is a flow which only lets through samples which belong to an active
+// campaign, and moves all other samples to the quarantine.
+type validator struct {
+	ctx       context.Context
+	tolerance time.Duration
+	campaigns sync.Map
+	in        chan any
+	out       chan any
+}
+
+// A campaign (nil if it does not exist) and the time it was looked up
+type cachedCampaign struct {
+	campaign *models.Campaign
+	loadedAt time.Time
+}
+
+func newValidator(ctx context.Context, tolerance time.Duration) *validator {
+	v := &validator{
+		ctx:       ctx,
+		tolerance: tolerance,
+		in:        make(chan any),
+		out:       make(chan any),
+	}
+
+	go v.validate()
+	pipeline = v
+	return v
+}
+
+func (v *validator) Via(flow streams.Flow) streams.Flow {
+	go v.To(flow)
+	return flow
+}
+
+func (v *validator) To(sink streams.Sink) {
+	for elem := range v.out {
+		sink.In() <- elem
+	}
+
+	close(sink.In())
+}
+
+func (v *validator) In() chan<- any {
+	return v.in
+}
+
+func (v *validator) Out() <-chan any {
+	return v.out
+}
+
+func (v *validator) validate() {
+	defer close(v.out)
+
+	for {
+		select {
+		case elem, ok := <-v.in:
+			if !ok {
+				return
+			}
+
+			b, s, err := normalize(elem.([]byte))
+			if err != nil {
+				observeSample("", len(elem.([]byte)), err)
+				log.Error(err)
+				continue
+			}
+
+			reason, err := v.accept(v.ctx, s, b)
+			v.observe(s, len(elem.([]byte)))
+
+			if err != nil {
+				log.Error(err)
+				continue
+			}
+			if reason == "" {
+				v.out <- b
+			}
+		case b := <-trusted:
+			v.out <- b
+		}
+	}
+}
+
+// Validates a sample and quarantines it if needed. Returns the reason why the sample was
+// quarantined, or an empty string if the sample is valid and should be stored. The
+// validation is traced with a link to the request which created the campaign.
+func (v *validator) accept(ctx context.Context, s models.Sample, b []byte) (reason string, err error) {
+	ctx, span := tracer.Start(ctx, "samples.validate", trace.WithAttributes(
+		attribute.String("sensor.id", s.SensorId),
+		attribute.String("campaign.id", s.CampaignId),
+		attribute.String("sample.type", s.SampleType),
+	))
+	defer func() {
+		if reason != "" {
+			span.SetAttributes(attribute.String("quarantine.reason", reason))
+		}
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	// Campaigns may have changed since they were cached, so look them up again before
+	// quarantining anything
+	reason, err = v.check(s, false)
+	if err == nil && reason != "" {
+		reason, err = v.check(s, true)
+	}
+	if campaign, _ := v.campaign(s.CampaignId, false); campaign != nil {
+		span.AddLink(tracing.Link(campaign.TraceContext))
+	}
+	if err != nil || reason == "" {
+		return "", err
+	}
+
+	return reason, quarantine(ctx, s, reason, b)
+}
+
+// Returns the reason why the sample should be quarantined, or an empty string if the
+// sample is valid.
+func (v *validator) check(s models.Sample, fresh bool) (string, error) {
+	campaign, err := v.campaign(s.CampaignId, fresh)
+	if err != nil {
+		return "", err
+	}
+
+	if campaign == nil {
+		return "unknown campaign", nil
+	}
+
+	// Sensors start recording as soon as they receive the campaign, which only becomes
+	// active once all of them acknowledged it
+	if campaign.Status != models.CampaignActive && campaign.Status != models.CampaignPending {
+		return fmt.Sprintf("campaign is %s", campaign.Status), nil
+	}
+
+	if !participates(campaign, s.SensorId) {
+		return "sensor is not part of the campaign", nil
+	}
+
+	if s.SampleType != campaign.Type {
+		return fmt.Sprintf("sample type %s does not match campaign type %s", s.SampleType, campaign.Type), nil
+	}
+
+	t := time.Unix(s.SampleTime.Seconds, int64(s.SampleTime.Microseconds)*int64(time.Microsecond))
+	if t.Before(campaign.Begin.Add(-v.tolerance)) || t.After(campaign.End.Add(v.tolerance)) {
+		return "sample time is outside of the campaign", nil
+	}
+
+	return "", nil
+}
+
+// Counts a sample which went through accept. Sensor IDs are only used as labels once the
+// sensor is known to take part in the campaign, so that forged samples cannot create new
+// series.
+func (v *validator) observe(s models.Sample, size int) {
+	sensorId := ""
+	if campaign, _ := v.campaign(s.CampaignId, false); participates(campaign, s.SensorId) {
+		sensorId = s.SensorId
+	}
+	observeSample(sensorId, size, nil)
+}
+
+// Returns whether a sensor takes part in the given campaign, which may be nil.
+func participates(campaign *models.Campaign, sensorId string) bool {
+	return campaign != nil && slices.Contains(campaign.Sensors, sensorId)
+}
+
+// Returns the campaign with the given ID, or nil if it does not exist. Unless fresh is
+// true, the campaign may come from the cache.
+func (v *validator) campaign(campaignId string, fresh bool) (*models.Campaign, error) {
+	cached, ok := v.campaigns.Load(campaignId)
+	if !fresh && ok && time.Since(cached.(cachedCampaign).loadedAt) < campaignCacheTTL {
+		return cached.(cachedCampaign).campaign, nil
+	}
+
+	sql, args, _ := database.Instance().
+		Select("*").
+		From("campaigns").
+		Where("campaign_id = ?", campaignId).
+		ToSql()
+	campaign, err := database.Single[models.Campaign](v.ctx, sql, args...)
+	if errors.Is(err, pgx.ErrNoRows) {
+		campaign, err = nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	v.campaigns.Store(campaignId, cachedCampaign{
+		campaign: campaign,
+		loadedAt: time.Now(),
+	})
+	return campaign, nil
+}
+
+// Stores a sample in the quarantine. The sample belongs to the organization of its
+// campaign if it exists, or to the organization of the sensor which sent it.
+func quarantine(ctx context.Context, s models.Sample, reason string, data []byte) error {
+	log.Warnf("Quarantined sample from sensor %s for campaign %s: %s", s.SensorId, s.CampaignId, reason)
+
+	return database.Do(
+		ctx,
+		`insert into quarantine ("sensor_id", "campaign_id", "sample_type", "reason", "organization", "data")
+		values ($1, $2, $3, $4, coalesce(
+			(select "organization" from campaigns where "campaign_id" = $2 limit 1),
+			(select "organization" from nodes where "sensor_id" = $1),
+			$6
+		), $5)`,
+		s.SensorId,
+		s.CampaignId,
+		s.SampleType,
+		reason,
+		data,
+		nats.DefaultOrganization,
+	)
+}
@@ -0,0 +1,49 @@
+package samples
+
+import (
+	"testing"
+	"time"
+
+	"github.com/openrfsense/backend/database/models"
+)
+
+func TestCheckCampaignStatus(t *testing.T) {
+	begin := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	v := &validator{tolerance: time.Minute}
+
+	tests := []struct {
+		status string
+		reason string
+	}{
+		{models.CampaignActive, ""},
+		{models.CampaignPending, ""},
+		{models.CampaignFailed, "campaign is failed"},
+		{models.CampaignExpired, "campaign is expired"},
+	}
+	for _, test := range tests {
+		v.campaigns.Store("campaign", cachedCampaign{
+			campaign: &models.Campaign{
+				CampaignId: "campaign",
+				Type:       "PSD",
+				Status:     test.status,
+				Sensors:    []string{"sensor"},
+				Begin:      begin,
+				End:        begin.Add(time.Hour),
+			},
+			loadedAt: time.Now(),
+		})
+
+		reason, err := v.check(models.Sample{
+			SensorId:   "sensor",
+			CampaignId: "campaign",
+			SampleType: "PSD",
+			SampleTime: models.SampleTime{Seconds: begin.Unix()},
+		}, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reason != test.reason {
+			t.Errorf("%s campaign: expected reason %q, got %q", test.status, test.reason, reason)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package samples
+
+import (
+	"math"
+	"slices"
+	"time"
+
+	"github.com/openrfsense/backend/database/models"
+)
+
+const (
+	// Frame rate used if the client does not ask for one
+	defaultFramerate = 10
+
+	// Highest frame rate a client can ask for
+	maxFramerate = 60
+
+	// Highest number of bins a client can ask for
+	maxBins = 8192
+)
+
+// Speeds at which a campaign can be replayed
+var replaySpeeds = []int{1, 10, 100}
+
+// Type waterfallMessage holds the settings sent by a client to the waterfall endpoint,
+// both when it connects and whenever it wants to change them. Frames sent back to the
+// client use the same format, with the settings they were computed with.
+type waterfallMessage struct {
+	// Center frequency of the view in Hz (the center frequency of the sensor if zero)
+	Center int64 `json:"center"`
+
+	// Highest number of frames per second, according to the time they were recorded at
+	Framerate int `json:"framerate"`
+
+	// Gain in dB added to all bins
+	Gain float32 `json:"gain"`
+
+	// Width of the view in Hz (the bandwidth of the sensor if zero)
+	Span int `json:"span"`
+
+	// Number of bins of each frame (as many as the sensor sends over the span if zero)
+	Bins int `json:"bins,omitempty"`
+
+	// Format of the frames: json (the default), or uint8 or float16 for binary frames
+	Format string `json:"format,omitempty"`
+
+	// Delta encode the bins of binary frames
+	Delta bool `json:"delta,omitempty"`
+
+	// Either live (the default) to receive frames as they are recorded, or replay to
+	// receive the frames recorded since the beginning of the campaign (handshake only)
+	Mode string `json:"mode,omitempty"`
+
+	// Speed of the replay relative to the time frames were recorded at: 1 (the default),
+	// 10 or 100
+	Speed int `json:"speed,omitempty"`
+
+	// Controls the replay: pause, resume or seek. Messages with a command do not change
+	// the settings
+	Command string `json:"command,omitempty"`
+
+	// Time to seek to, in microseconds since the epoch. In the handshake, time at which
+	// the replay starts
+	Seek int64 `json:"seek,omitempty"`
+
+	// Frames of different sensors recorded at most this many microseconds apart are sent
+	// together (campaign endpoint only, 100 ms by default)
+	Tolerance int64 `json:"tolerance,omitempty"`
+
+	// Time at which the frame was recorded, in microseconds since the epoch (frames only)
+	Time int64 `json:"time,omitempty"`
+
+	// Bins of the frame (frames only)
+	S []float32 `json:"s"`
+}
+
+// Returns the settings with missing or out of range values replaced by defaults.
+func (wm waterfallMessage) normalized() waterfallMessage {
+	if wm.Framerate <= 0 {
+		wm.Framerate = defaultFramerate
+	}
+	wm.Framerate = min(wm.Framerate, maxFramerate)
+	wm.Bins = min(max(wm.Bins, 0), maxBins)
+	wm.Span = max(wm.Span, 0)
+	if wm.Format != FormatUint8 && wm.Format != FormatFloat16 {
+		wm.Format = FormatJSON
+	}
+	if wm.Mode != ModeReplay {
+		wm.Mode = ModeLive
+	}
+	if !slices.Contains(replaySpeeds, wm.Speed) {
+		wm.Speed = replaySpeeds[0]
+	}
+	if wm.Tolerance <= 0 {
+		wm.Tolerance = defaultTolerance.Microseconds()
+	}
+	wm.Tolerance = min(wm.Tolerance, maxTolerance.Microseconds())
+	wm.Command = ""
+	wm.Seek = 0
+	wm.Time = 0
+	wm.S = nil
+	return wm
+}
+
+// Returns the shortest time between two frames.
+func (wm waterfallMessage) interval() time.Duration {
+	return time.Second / time.Duration(wm.Framerate)
+}
+
+// Returns the alignment tolerance.
+func (wm waterfallMessage) tolerance() time.Duration {
+	return time.Duration(wm.Tolerance) * time.Microsecond
+}
+
+// Returns the frame sent to the client for a PSD sample: the bins of the sample are
+// cropped to the requested span, resampled to the requested number of bins and amplified
+// by the requested gain. When several bins of the sample fall into a single bin of the
+// frame, the highest one is kept so that narrow peaks remain visible. Parts of the span
+// which the sensor did not cover are filled with the lowest bin of the sample.
+func (wm waterfallMessage) frame(s models.Sample) waterfallMessage {
+	frame := wm
+	frame.Time = sampleTime(s).UnixMicro()
+	if len(s.Data) == 0 {
+		frame.S = []float32{}
+		return frame
+	}
+
+	// Without the sampling rate, bins cannot be mapped to frequencies
+	if s.SampleConfig.SamplingRate == nil || *s.SampleConfig.SamplingRate <= 0 {
+		frame.Center = s.SampleConfig.CenterFreq
+		frame.Span = 0
+		frame.S = resample(s.Data, 0, float64(len(s.Data)), wm.binsOr(len(s.Data)), wm.Gain)
+		return frame
+	}
+
+	bandwidth := float64(*s.SampleConfig.SamplingRate)
+	binWidth := bandwidth / float64(len(s.Data))
+	if frame.Center == 0 {
+		frame.Center = s.SampleConfig.CenterFreq
+	}
+	if frame.Span == 0 {
+		frame.Span = int(bandwidth)
+	}
+
+	// Position of the span in bins of the sample
+	first := float64(frame.Center-s.SampleConfig.CenterFreq)/binWidth + float64(len(s.Data))/2 - float64(frame.Span)/binWidth/2
+	last := first + float64(frame.Span)/binWidth
+	bins := wm.binsOr(int(math.Round(float64(frame.Span) / binWidth)))
+
+	frame.S = resample(s.Data, first, last, bins, wm.Gain)
+	return frame
+}
+
+// Returns the requested number of bins, or n if none was requested.
+func (wm waterfallMessage) binsOr(n int) int {
+	if wm.Bins > 0 {
+		return wm.Bins
+	}
+	return min(max(n, 1), maxBins)
+}
+
+// Resamples the part of data between the (fractional) bin indices first and last to the
+// given number of bins, adding gain to each of them.
+func resample(data []float32, first float64, last float64, bins int, gain float32) []float32 {
+	floor := float32(math.Inf(1))
+	for _, v := range data {
+		floor = min(floor, v)
+	}
+
+	out := make([]float32, bins)
+	width := (last - first) / float64(bins)
+	for j := range out {
+		from := max(int(math.Floor(first+float64(j)*width)), 0)
+		to := min(int(math.Ceil(first+float64(j+1)*width)), len(data))
+		if from >= to {
+			out[j] = floor + gain
+			continue
+		}
+
+		peak := data[from]
+		for _, v := range data[from+1 : to] {
+			peak = max(peak, v)
+		}
+		out[j] = peak + gain
+	}
+
+	return out
+}
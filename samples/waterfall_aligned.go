@@ -0,0 +1,237 @@
+package samples
+
+import (
+	"context"
+	"encoding/binary"
+	"slices"
+	"time"
+
+	"github.com/openrfsense/backend/database/models"
+)
+
+const (
+	// Alignment tolerance used if the client does not ask for one
+	defaultTolerance = 100 * time.Millisecond
+
+	// Highest alignment tolerance a client can ask for
+	maxTolerance = 10 * time.Second
+
+	// How long the samples of sensors which lag behind are waited for, on top of the
+	// alignment tolerance
+	alignDelay = time.Second
+
+	// How often aligned samples which stopped waiting for late sensors are sent
+	alignTick = 100 * time.Millisecond
+)
+
+// Type alignedSamples holds the PSD samples recorded by the sensors of a campaign at about
+// the same time, at most one per sensor.
+type alignedSamples struct {
+	// Time at which the earliest sample was recorded
+	time time.Time
+
+	// Samples by sensor ID
+	samples map[string]models.Sample
+}
+
+// Type alignedMessage is sent to clients of the campaign waterfall endpoint: it holds a
+// frame for each sensor which recorded one around the same time.
+type alignedMessage struct {
+	// Time at which the earliest frame was recorded, in microseconds since the epoch
+	Time int64 `json:"time"`
+
+	// Frames by sensor ID, computed with the settings of the client
+	Frames map[string]waterfallMessage `json:"frames"`
+}
+
+// Returns the message sent to the client for the aligned samples.
+func (wm waterfallMessage) aligned(as alignedSamples) alignedMessage {
+	am := alignedMessage{
+		Time:   as.time.UnixMicro(),
+		Frames: make(map[string]waterfallMessage, len(as.samples)),
+	}
+	for sensorId, s := range as.samples {
+		am.Frames[sensorId] = wm.frame(s)
+	}
+	return am
+}
+
+// Returns the message in the binary format, all integers being big endian:
+//   - time at which the earliest frame was recorded (int64, microseconds since the epoch)
+//   - number of frames (uint16)
+//   - for each frame, sorted by sensor ID: the length of the sensor ID (uint8), the sensor
+//     ID, the length of the frame (uint32) and the frame itself (see waterfallMessage.binary)
+func (am alignedMessage) binary() []byte {
+	sensorIds := make([]string, 0, len(am.Frames))
+	for sensorId := range am.Frames {
+		sensorIds = append(sensorIds, sensorId)
+	}
+	slices.Sort(sensorIds)
+
+	b := binary.BigEndian.AppendUint64(nil, uint64(am.Time))
+	b = binary.BigEndian.AppendUint16(b, uint16(len(sensorIds)))
+	for _, sensorId := range sensorIds {
+		frame := am.Frames[sensorId].binary()
+		b = append(b, byte(len(sensorId)))
+		b = append(b, sensorId...)
+		b = binary.BigEndian.AppendUint32(b, uint32(len(frame)))
+		b = append(b, frame...)
+	}
+	return b
+}
+
+// Type pendingSample is a sample waiting to be aligned with the samples of other sensors.
+type pendingSample struct {
+	sample   models.Sample
+	recorded time.Time
+	arrived  time.Time
+}
+
+// Type aligner groups the samples of several sensors recorded at about the same time.
+// Samples of each sensor must be added in the order they were recorded.
+type aligner struct {
+	sensors []string
+
+	// Samples waiting to be aligned, by sensor
+	pending map[string][]pendingSample
+
+	// Time at which the latest sample of each sensor was recorded
+	latest map[string]time.Time
+}
+
+func newAligner(sensors []string) *aligner {
+	return &aligner{
+		sensors: sensors,
+		pending: make(map[string][]pendingSample, len(sensors)),
+		latest:  make(map[string]time.Time, len(sensors)),
+	}
+}
+
+// Adds a sample received at the given time. Samples of unknown sensors are ignored.
+func (a *aligner) add(s models.Sample, now time.Time) {
+	if !slices.Contains(a.sensors, s.SensorId) {
+		return
+	}
+
+	recorded := sampleTime(s)
+	a.pending[s.SensorId] = append(a.pending[s.SensorId], pendingSample{
+		sample:   s,
+		recorded: recorded,
+		arrived:  now,
+	})
+	a.latest[s.SensorId] = recorded
+}
+
+// Returns the samples recorded within the tolerance of the earliest pending sample, once
+// all sensors have sent theirs or have moved past it. Sensors which are late are waited
+// for until alignDelay after the tolerance has elapsed since the earliest sample arrived.
+// Returns false if there are no samples to send yet.
+func (a *aligner) next(tolerance time.Duration, now time.Time) (alignedSamples, bool) {
+	var first *pendingSample
+	for _, sensorId := range a.sensors {
+		queue := a.pending[sensorId]
+		if len(queue) > 0 && (first == nil || queue[0].recorded.Before(first.recorded)) {
+			first = &queue[0]
+		}
+	}
+	if first == nil {
+		return alignedSamples{}, false
+	}
+
+	limit := first.recorded.Add(tolerance)
+	aligned := alignedSamples{
+		time:    first.recorded,
+		samples: make(map[string]models.Sample, len(a.sensors)),
+	}
+	complete := true
+	for _, sensorId := range a.sensors {
+		queue := a.pending[sensorId]
+		if len(queue) > 0 && !queue[0].recorded.After(limit) {
+			aligned.samples[sensorId] = queue[0].sample
+			continue
+		}
+		// A sample within the tolerance can still come if none was recorded after it
+		if len(queue) == 0 && !a.latest[sensorId].After(limit) {
+			complete = false
+		}
+	}
+
+	if !complete && now.Sub(first.arrived) < tolerance+alignDelay {
+		return alignedSamples{}, false
+	}
+
+	for sensorId := range aligned.samples {
+		a.pending[sensorId] = a.pending[sensorId][1:]
+	}
+	return aligned, true
+}
+
+// Aligns the PSD samples received on the channel and sends them on the returned channel
+// as alignedSamples, using the tolerance of the current settings. The returned channel is
+// closed once the input channel is closed or the context is done.
+func align(ctx context.Context, in <-chan models.Sample, sensors []string, settings func() waterfallMessage) chan any {
+	out := make(chan any)
+
+	go func() {
+		defer close(out)
+
+		a := newAligner(sensors)
+		ticker := time.NewTicker(alignTick)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case s, ok := <-in:
+				if !ok {
+					return
+				}
+				if isPSD(s) {
+					a.add(s, time.Now())
+				}
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+
+			for {
+				aligned, ok := a.next(settings().tolerance(), time.Now())
+				if !ok {
+					break
+				}
+
+				select {
+				case out <- aligned:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return out
+}
+
+// Sends the samples of all sensors which match the query on the returned channel, as they
+// are written (see followStore).
+func followSensors(ctx context.Context, q SampleQuery, sensors []string) <-chan models.Sample {
+	out := make(chan models.Sample)
+
+	for _, sensorId := range sensors {
+		q := q
+		q.SensorId = sensorId
+		go func() {
+			for elem := range followStore(ctx, q) {
+				select {
+				case out <- elem.(models.Sample):
+				case <-ctx.Done():
+				}
+			}
+		}()
+	}
+
+	return out
+}
+
+func alignedTSExtractor(i interface{}) int64 {
+	return i.(alignedSamples).time.UnixNano()
+}
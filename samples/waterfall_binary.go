@@ -0,0 +1,142 @@
+package samples
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// Formats of waterfall frames, see waterfallMessage.Format
+const (
+	FormatJSON    = "json"
+	FormatUint8   = "uint8"
+	FormatFloat16 = "float16"
+)
+
+const (
+	// Version of the binary frame format
+	binaryFrameVersion = 1
+
+	// Flags of binary frames
+	binaryFlagFloat16 = 1 << 0
+	binaryFlagDelta   = 1 << 1
+
+	// Size of the header of binary frames
+	binaryHeaderSize = 34
+)
+
+// Returns the frame in the binary format, all integers being big endian:
+//   - version (uint8, currently 1)
+//   - flags (uint8): bit 0 is set if bins are float16 (uint8 otherwise), bit 1 if bins are
+//     delta encoded
+//   - time at which the frame was recorded (int64, microseconds since the epoch)
+//   - center frequency (int64, Hz)
+//   - span (uint32, Hz)
+//   - number of bins (uint32)
+//   - scale and offset (float32): each bin is offset + scale * v, where v is the quantized
+//     value of the bin
+//   - the quantized bins, either uint8 or float16
+//
+// If bins are delta encoded, each quantized value (taken as an unsigned integer of the same
+// size, wrapping around) is replaced by its difference with the previous one, which makes
+// frames compress better.
+func (wm waterfallMessage) binary() []byte {
+	flags := byte(0)
+	if wm.Format == FormatFloat16 {
+		flags |= binaryFlagFloat16
+	}
+	if wm.Delta {
+		flags |= binaryFlagDelta
+	}
+
+	floor, ceiling := float32(0), float32(0)
+	for i, v := range wm.S {
+		if i == 0 || v < floor {
+			floor = v
+		}
+		if i == 0 || v > ceiling {
+			ceiling = v
+		}
+	}
+
+	scale := float32(1)
+	size := 2
+	if wm.Format != FormatFloat16 {
+		scale = (ceiling - floor) / math.MaxUint8
+		size = 1
+	}
+
+	b := make([]byte, binaryHeaderSize, binaryHeaderSize+size*len(wm.S))
+	b[0] = binaryFrameVersion
+	b[1] = flags
+	binary.BigEndian.PutUint64(b[2:10], uint64(wm.Time))
+	binary.BigEndian.PutUint64(b[10:18], uint64(wm.Center))
+	binary.BigEndian.PutUint32(b[18:22], uint32(wm.Span))
+	binary.BigEndian.PutUint32(b[22:26], uint32(len(wm.S)))
+	binary.BigEndian.PutUint32(b[26:30], math.Float32bits(scale))
+	binary.BigEndian.PutUint32(b[30:34], math.Float32bits(floor))
+
+	var previous uint16
+	for _, v := range wm.S {
+		var q uint16
+		if wm.Format == FormatFloat16 {
+			q = float16bits(v - floor)
+		} else if scale > 0 {
+			q = uint16(math.Round(float64((v - floor) / scale)))
+		}
+
+		if wm.Delta {
+			q, previous = q-previous, q
+		}
+
+		if size == 2 {
+			b = binary.BigEndian.AppendUint16(b, q)
+		} else {
+			b = append(b, byte(q))
+		}
+	}
+
+	return b
+}
+
+// Returns the IEEE 754 half precision representation of f, rounded to the nearest even.
+func float16bits(f float32) uint16 {
+	bits := math.Float32bits(f)
+	sign := uint16(bits>>16) & 0x8000
+	exp := int(bits>>23&0xff) - 127 + 15
+	mant := bits & 0x7fffff
+
+	switch {
+	case bits>>23&0xff == 0xff:
+		// Infinity or NaN
+		if mant != 0 {
+			return sign | 0x7e00
+		}
+		return sign | 0x7c00
+
+	case exp >= 0x1f:
+		// Too large, rounded to infinity
+		return sign | 0x7c00
+
+	case exp <= 0:
+		// Subnormal, or too small and rounded to zero
+		if exp < -10 {
+			return sign
+		}
+		mant |= 0x800000
+		shift := uint32(14 - exp)
+		half := uint16(mant >> shift)
+		rem, halfway := mant&(1<<shift-1), uint32(1)<<(shift-1)
+		if rem > halfway || (rem == halfway && half&1 == 1) {
+			half++
+		}
+		return sign | half
+	}
+
+	half := sign | uint16(exp)<<10 | uint16(mant>>13)
+	rem := mant & 0x1fff
+	if rem > 0x1000 || (rem == 0x1000 && half&1 == 1) {
+		// May carry into the exponent, which is still correct
+		half++
+	}
+	return half
+}
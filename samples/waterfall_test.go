@@ -0,0 +1,185 @@
+package samples
+
+import (
+	"encoding/binary"
+	"math"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/openrfsense/backend/database/models"
+)
+
+func TestWaterfallFrame(t *testing.T) {
+	// 8 bins of 1 kHz each, from 96 kHz to 104 kHz
+	samplingRate := 8000
+	s := models.Sample{
+		SampleType: "PSD",
+		SampleConfig: models.SampleConfig{
+			CenterFreq:   100000,
+			SamplingRate: &samplingRate,
+		},
+		Data: []float32{-90, -80, -70, -60, -50, -40, -30, -20},
+	}
+
+	cases := []struct {
+		name     string
+		settings waterfallMessage
+		expected []float32
+	}{
+		{"full band", waterfallMessage{}, s.Data},
+		{"cropped", waterfallMessage{Center: 101000, Span: 2000}, []float32{-50, -40}},
+		{"downsampled", waterfallMessage{Bins: 4, Gain: 10}, []float32{-70, -50, -30, -10}},
+		{"upsampled", waterfallMessage{Center: 96500, Span: 1000, Bins: 2}, []float32{-90, -90}},
+		{"out of band", waterfallMessage{Center: 104000, Span: 2000}, []float32{-20, -90}},
+	}
+	for _, c := range cases {
+		frame := c.settings.normalized().frame(s)
+		if !reflect.DeepEqual([]float32(frame.S), c.expected) {
+			t.Errorf("%s: expected %v, got %v", c.name, c.expected, frame.S)
+		}
+	}
+}
+
+func TestBinaryFrame(t *testing.T) {
+	frame := waterfallMessage{
+		Center: 100000,
+		Span:   8000,
+		Time:   1700000000000000,
+		S:      []float32{-90, -80, -85, -20},
+	}
+
+	for _, format := range []string{FormatUint8, FormatFloat16} {
+		for _, delta := range []bool{false, true} {
+			frame.Format, frame.Delta = format, delta
+			b := frame.binary()
+
+			size := 1
+			if format == FormatFloat16 {
+				size = 2
+			}
+			if len(b) != binaryHeaderSize+size*len(frame.S) {
+				t.Fatalf("%s: unexpected frame length %d", format, len(b))
+			}
+			if int64(binary.BigEndian.Uint64(b[2:10])) != frame.Time || binary.BigEndian.Uint32(b[22:26]) != 4 {
+				t.Fatalf("%s: unexpected header %v", format, b[:binaryHeaderSize])
+			}
+
+			scale := math.Float32frombits(binary.BigEndian.Uint32(b[26:30]))
+			offset := math.Float32frombits(binary.BigEndian.Uint32(b[30:34]))
+			var previous uint16
+			for i, expected := range frame.S {
+				var q uint16
+				if size == 1 {
+					q = uint16(b[binaryHeaderSize+i])
+				} else {
+					q = binary.BigEndian.Uint16(b[binaryHeaderSize+2*i:])
+				}
+				if delta {
+					q += previous
+					if size == 1 {
+						q &= 0xff
+					}
+					previous = q
+				}
+
+				v := float32(q)
+				if size == 2 {
+					v = float16frombits(q)
+				}
+				if decoded := offset + scale*v; math.Abs(float64(decoded-expected)) > 0.2 {
+					t.Errorf("%s (delta %t): bin %d decoded as %v instead of %v", format, delta, i, decoded, expected)
+				}
+			}
+		}
+	}
+}
+
+func TestFloat16(t *testing.T) {
+	cases := map[float32]uint16{
+		0:                 0x0000,
+		1:                 0x3c00,
+		0.5:               0x3800,
+		-2:                0xc000,
+		65504:             0x7bff,
+		1e6:               0x7c00,
+		5.9604645e-08:     0x0001,
+		1e-9:              0x0000,
+		float32(1 + 1e-4): 0x3c00,
+	}
+	for f, expected := range cases {
+		if bits := float16bits(f); bits != expected {
+			t.Errorf("%v: expected %#04x, got %#04x", f, expected, bits)
+		}
+	}
+}
+
+// Returns the value of an IEEE 754 half precision number.
+func float16frombits(h uint16) float32 {
+	sign := float32(1)
+	if h&0x8000 != 0 {
+		sign = -1
+	}
+	exp := int(h>>10) & 0x1f
+	mant := float64(h & 0x3ff)
+	if exp == 0 {
+		return sign * float32(math.Ldexp(mant, -24))
+	}
+	return sign * float32(math.Ldexp(1+mant/1024, exp-15))
+}
+
+func TestAligner(t *testing.T) {
+	begin := time.Unix(1700000000, 0)
+	sample := func(sensorId string, offset time.Duration) models.Sample {
+		recorded := begin.Add(offset)
+		return models.Sample{
+			SensorId:   sensorId,
+			SampleType: "PSD",
+			SampleTime: models.SampleTime{Seconds: recorded.Unix(), Microseconds: int32(recorded.Nanosecond() / 1000)},
+		}
+	}
+	sensors := func(as alignedSamples) []string {
+		ids := []string{}
+		for sensorId := range as.samples {
+			ids = append(ids, sensorId)
+		}
+		slices.Sort(ids)
+		return ids
+	}
+
+	a := newAligner([]string{"a", "b", "c"})
+	now := time.Now()
+	tolerance := 100 * time.Millisecond
+
+	a.add(sample("a", 0), now)
+	if _, ok := a.next(tolerance, now); ok {
+		t.Fatal("samples were sent before the other sensors sent theirs")
+	}
+
+	// c moved past the tolerance, so a and b are aligned without it
+	a.add(sample("b", 50*time.Millisecond), now)
+	a.add(sample("c", 300*time.Millisecond), now)
+	aligned, ok := a.next(tolerance, now)
+	if !ok || !reflect.DeepEqual(sensors(aligned), []string{"a", "b"}) || !aligned.time.Equal(begin) {
+		t.Fatalf("expected a and b to be aligned, got %v", aligned)
+	}
+
+	// a and b may still send a sample close to c, until they are late
+	if _, ok := a.next(tolerance, now); ok {
+		t.Fatal("samples were sent before the other sensors sent theirs")
+	}
+	aligned, ok = a.next(tolerance, now.Add(tolerance+alignDelay))
+	if !ok || !reflect.DeepEqual(sensors(aligned), []string{"c"}) {
+		t.Fatalf("expected c alone once the other sensors are late, got %v", aligned)
+	}
+
+	message := waterfallMessage{Format: FormatUint8}.aligned(alignedSamples{
+		time:    begin,
+		samples: map[string]models.Sample{"a": sample("a", 0), "bb": sample("bb", 0)},
+	})
+	b := message.binary()
+	if len(b) != 8+2+2*(1+4+binaryHeaderSize)+len("a")+len("bb") || binary.BigEndian.Uint16(b[8:10]) != 2 || string(b[11:12]) != "a" {
+		t.Fatalf("unexpected binary message %v", b)
+	}
+}
@@ -2,96 +2,308 @@ package samples
 
 import (
 	"context"
+	"errors"
+	"sync/atomic"
 	"time"
 
-	"github.com/dgraph-io/badger/v3"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/websocket/v2"
-	"github.com/hamba/avro/v2"
+	"github.com/jackc/pgx/v5"
 	"github.com/knadh/koanf"
+	"github.com/openrfsense/backend/database"
 	"github.com/openrfsense/backend/database/models"
+	"github.com/openrfsense/backend/orgs"
 	"github.com/openrfsense/backend/samples/stream"
 	"github.com/reugn/go-streams/extension"
+	"github.com/reugn/go-streams/flow"
 )
 
-type waterfallMessage struct {
-	Center    int64     `json:"center"`
-	Framerate int       `json:"framerate"`
-	Gain      float32   `json:"gain"`
-	Span      int       `json:"span"`
-	S         []float32 `json:"s"`
-}
-
 func StartWebsocket(ctx context.Context, config *koanf.Koanf, router *fiber.App) {
-	handler := makeHandler(ctx, config.MustString("backend.storage"), DefaultSchema)
+	handler := makeHandler(ctx)
 
-	router.Use("/ws", func(c *fiber.Ctx) error {
+	router.Use("/ws", orgs.Authentication(config), func(c *fiber.Ctx) error {
 		if websocket.IsWebSocketUpgrade(c) {
 			return c.Next()
 		}
 		return fiber.ErrUpgradeRequired
 	})
-	router.Get("/ws/:sensor_id/:campaign_id", websocket.New(handler))
+	router.Get("/ws/campaign/:campaign_id", authorizeSensors, websocket.New(makeCampaignHandler(ctx), websocket.Config{EnableCompression: true}))
+	router.Get("/ws/:sensor_id/:campaign_id", authorizeCampaign, websocket.New(handler, websocket.Config{EnableCompression: true}))
+}
+
+// Only lets through requests for campaigns which belong to the organization of the
+// user and in which the requested sensor took part.
+func authorizeCampaign(c *fiber.Ctx) error {
+	sql, args, _ := database.Instance().
+		Select("count(*)").
+		From("campaigns").
+		Where("campaign_id = ?", c.Params("campaign_id")).
+		Where("organization = ?", orgs.Current(c)).
+		Where("? = any (sensors)", c.Params("sensor_id")).
+		Where("status = ?", models.CampaignActive).
+		ToSql()
+
+	var count int
+	err := database.Instance().QueryRow(c.Context(), sql, args...).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return fiber.ErrNotFound
+	}
+
+	return c.Next()
+}
+
+// Only lets through requests for campaigns which belong to the organization of the
+// user, and stores the sensors which take part in the campaign in the "sensors" local.
+func authorizeSensors(c *fiber.Ctx) error {
+	sql, args, _ := database.Instance().
+		Select("sensors").
+		From("campaigns").
+		Where("campaign_id = ?", c.Params("campaign_id")).
+		Where("organization = ?", orgs.Current(c)).
+		Where("status = ?", models.CampaignActive).
+		ToSql()
+
+	var sensors []string
+	err := database.Instance().QueryRow(c.Context(), sql, args...).Scan(&sensors)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fiber.ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	c.Locals("sensors", sensors)
+	return c.Next()
 }
 
-func makeHandler(ctx context.Context, badgerPath string, schema avro.Schema) func(*websocket.Conn) {
+// Returns the handler of the waterfall endpoint. The client sends its settings as a
+// waterfallMessage once connected, then receives the PSD frames recorded by the sensor
+// from then on, rate limited and transformed according to its settings. The client can
+// send new settings at any time.
+//
+// In replay mode, the client instead receives the frames recorded since the beginning of
+// the campaign (or since the time in the handshake), paced by the time they were recorded
+// at, and can pause, resume and seek the replay with commands.
+func makeHandler(ctx context.Context) func(*websocket.Conn) {
 	return func(c *websocket.Conn) {
 		campaignId := c.Params("campaign_id")
 		sensorId := c.Params("sensor_id")
 		defer c.Close()
 
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
 		conf := waterfallMessage{}
 		err := c.ReadJSON(&conf)
 		if err != nil {
 			log.Error(err)
 			return
 		}
+		q := SampleQuery{
+			CampaignId: campaignId,
+			SensorId:   sensorId,
+			From:       time.Now(),
+		}
+		if conf.Mode == ModeReplay {
+			q.From = time.UnixMicro(conf.Seek)
+		}
+		conf = conf.normalized()
+		mode := conf.Mode
+
+		settings := atomic.Pointer[waterfallMessage]{}
+		settings.Store(&conf)
+
+		// Live frames are rate limited by the time they were recorded at, replayed frames
+		// by the time they are sent at so that seeking back and speeding up work as expected
+		var player *replayer
+		var source *extension.ChanSource
+		var window *stream.DiscardingWindow
+		if mode == ModeReplay {
+			player = replay(ctx, q, &settings)
+			source = extension.NewChanSource(player.samples())
+			window = stream.NewDiscardingWindow(conf.interval())
+		} else {
+			source = extension.NewChanSource(followStore(ctx, q))
+			window = stream.NewDiscardingWindowWithTSExtractor(conf.interval(), sampleTSExtractor)
+		}
+		frames := make(chan any)
+
+		go source.
+			Via(flow.NewFilter(isPSD, 1)).
+			Via(window).
+			To(extension.NewChanSink(frames))
+
+		written := make(chan struct{})
+		go func() {
+			defer close(written)
+			writeFrames(c, frames, &settings, cancel)
+		}()
+
+		for {
+			conf := waterfallMessage{}
+			err := c.ReadJSON(&conf)
+			if err != nil {
+				if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+					log.Error(err)
+				}
+				break
+			}
+
+			if conf.Command == "" {
+				conf = conf.normalized()
+				conf.Mode = mode
+				settings.Store(&conf)
+				window.SetInterval(conf.interval())
+			}
+			if player != nil {
+				player.control(ctx, conf)
+			}
+		}
+
+		// Wait for the pipeline to stop before the connection is released
+		cancel()
+		<-written
+	}
+}
 
-		source, err := stream.NewBadgerSource(ctx, badger.DefaultOptions(badgerPath), makePrefix(campaignId, sensorId))
+// Returns the handler of the campaign waterfall endpoint. The client sends its settings as
+// a waterfallMessage once connected, like with the waterfall endpoint of a single sensor,
+// then receives the PSD frames recorded by all sensors of the campaign from then on,
+// aligned on the time they were recorded at and sent together as an alignedMessage.
+func makeCampaignHandler(ctx context.Context) func(*websocket.Conn) {
+	return func(c *websocket.Conn) {
+		campaignId := c.Params("campaign_id")
+		sensors, _ := c.Locals("sensors").([]string)
+		defer c.Close()
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		conf := waterfallMessage{}
+		err := c.ReadJSON(&conf)
 		if err != nil {
 			log.Error(err)
 			return
 		}
+		conf = conf.normalized()
 
-		// tick := time.Second / time.Duration(conf.Framerate)
-		// dw := stream.NewDiscardingWindowWithTSExtractor(tick, sampleTSExtractor)
+		settings := atomic.Pointer[waterfallMessage]{}
+		settings.Store(&conf)
 
-		// // toWaterfallMessage := flow.NewMap(func(sample models.Sample) waterfallMessage {
-		// // 	return waterfallMessage{
-		// // 		Center:    sample.SampleConfig.CenterFreq,
-		// // 		Framerate: conf.Framerate,
-		// // 		Gain:      *sample.SampleConfig.FrontendGain,
-		// // 		S:         sample.Data,
-		// // 	}
-		// // }, 1)
-
-		// // sink := stream.NewWebSocketSink(ctx, c)
-		sink := extension.NewStdoutSink()
+		received := followSensors(ctx, SampleQuery{
+			CampaignId: campaignId,
+			From:       time.Now(),
+		}, sensors)
+		source := extension.NewChanSource(align(ctx, received, sensors, func() waterfallMessage {
+			return *settings.Load()
+		}))
+		window := stream.NewDiscardingWindowWithTSExtractor(conf.interval(), alignedTSExtractor)
+		frames := make(chan any)
 
 		go source.
-			Via(stream.NewAvroUnmarshal[models.Sample](schema)).
-			// Via(dw).
-			// Via(flow.NewThrottler(1, tick, 1, flow.Backpressure)).
-			// Via(toWaterfallMessage).
-			// Via(stream.NewJsonMarshal[waterfallMessage]()).
-			To(sink)
+			Via(window).
+			To(extension.NewChanSink(frames))
+
+		written := make(chan struct{})
+		go func() {
+			defer close(written)
+			writeFrames(c, frames, &settings, cancel)
+		}()
 
 		for {
+			conf := waterfallMessage{}
 			err := c.ReadJSON(&conf)
 			if err != nil {
-				log.Error(err)
+				if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+					log.Error(err)
+				}
 				break
 			}
-			log.Debugf("%#v", conf)
-			err = c.WriteJSON(conf)
-			if err != nil {
-				log.Error(err)
-				break
+
+			if conf.Command == "" {
+				conf = conf.normalized()
+				settings.Store(&conf)
+				window.SetInterval(conf.interval())
 			}
 		}
+
+		// Wait for the pipeline to stop before the connection is released
+		cancel()
+		<-written
 	}
 }
 
+// Sends each sample (or aligned samples) to the client as a frame, using the current
+// settings. JSON frames are sent as text messages and binary frames as binary messages.
+// Stops writing (but keeps reading samples until the channel is closed) if the client
+// is gone.
+func writeFrames(c *websocket.Conn, samples <-chan any, settings *atomic.Pointer[waterfallMessage], cancel func()) {
+	failed := false
+	for elem := range samples {
+		if failed {
+			continue
+		}
+
+		conf := settings.Load()
+
+		var err error
+		switch elem := elem.(type) {
+		case models.Sample:
+			frame := conf.frame(elem)
+			if conf.Format == FormatJSON {
+				err = c.WriteJSON(frame)
+			} else {
+				err = c.WriteMessage(websocket.BinaryMessage, frame.binary())
+			}
+		case alignedSamples:
+			message := conf.aligned(elem)
+			if conf.Format == FormatJSON {
+				err = c.WriteJSON(message)
+			} else {
+				err = c.WriteMessage(websocket.BinaryMessage, message.binary())
+			}
+		}
+		if err != nil {
+			log.Error(err)
+			failed = true
+			cancel()
+		}
+	}
+}
+
+func isPSD(s models.Sample) bool {
+	return s.SampleType == "PSD"
+}
+
+// Sends all samples which match the query on the returned channel, first those already
+// stored then new ones as they are written (see Follow). The channel is closed once the
+// context is done, or once all stored samples have been sent if the store cannot follow
+// new samples.
+func followStore(ctx context.Context, q SampleQuery) chan any {
+	out := make(chan any)
+
+	go func() {
+		defer close(out)
+
+		err := Follow(ctx, q, func(s models.Sample) error {
+			select {
+			case out <- s:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+		if err != nil && !errors.Is(err, context.Canceled) {
+			log.Error(err)
+		}
+	}()
+
+	return out
+}
+
 func sampleTSExtractor(i interface{}) int64 {
 	v := i.(models.Sample)
 	return v.SampleTime.Seconds*int64(time.Second) +
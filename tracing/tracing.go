@@ -0,0 +1,172 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/knadh/koanf"
+	natsgo "github.com/nats-io/nats.go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Name of the service in exported spans
+const serviceName = "openrfsense-backend"
+
+// Trace context is propagated with W3C Trace Context headers (traceparent and tracestate)
+var propagator = propagation.NewCompositeTextMapPropagator(
+	propagation.TraceContext{},
+	propagation.Baggage{},
+)
+
+var tracer = otel.Tracer("github.com/openrfsense/backend/api")
+
+// Sets up the global tracer provider according to the configuration. Spans are exported
+// over OTLP/HTTP if tracing.exporter is "otlp", printed on the standard output if it is
+// "stdout" and discarded otherwise. Returns a function which flushes all pending spans and
+// must be called before exiting.
+func Init(ctx context.Context, config *koanf.Koanf, version string) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagator)
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch config.String("tracing.exporter") {
+	case "":
+		return func(context.Context) error { return nil }, nil
+	case "stdout":
+		exporter, err = stdouttrace.New()
+	case "otlp":
+		opts := []otlptracehttp.Option{}
+		if endpoint := config.String("tracing.endpoint"); endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpoint(endpoint))
+		}
+		if config.Bool("tracing.insecure") {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		exporter, err = otlptracehttp.New(ctx, opts...)
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", config.String("tracing.exporter"))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(serviceName),
+		semconv.ServiceVersion(version),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// Returns a middleware which starts a span for every request, continuing the trace of the
+// caller if the request carries a trace context. The context of the span is available to
+// handlers through fiber.Ctx.UserContext.
+func Middleware() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		header := http.Header{}
+		ctx.Request().Header.VisitAll(func(key, value []byte) {
+			header.Add(string(key), string(value))
+		})
+		parent := propagator.Extract(ctx.UserContext(), propagation.HeaderCarrier(header))
+
+		spanCtx, span := tracer.Start(
+			parent,
+			ctx.Method()+" "+ctx.Path(),
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(semconv.HTTPRequestMethodKey.String(ctx.Method())),
+		)
+		defer span.End()
+		ctx.SetUserContext(spanCtx)
+
+		err := ctx.Next()
+
+		// The route is only known once the request has been routed
+		route := ctx.Route().Path
+		span.SetName(ctx.Method() + " " + route)
+		span.SetAttributes(semconv.HTTPRoute(route))
+
+		status := ctx.Response().StatusCode()
+		if err != nil {
+			status = fiber.StatusInternalServerError
+			var fiberErr *fiber.Error
+			if errors.As(err, &fiberErr) {
+				status = fiberErr.Code
+			}
+		}
+		span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+		if status >= fiber.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+
+		return err
+	}
+}
+
+// Writes the trace context of ctx to the headers of a NATS message.
+func InjectNATS(ctx context.Context, msg *natsgo.Msg) {
+	if msg.Header == nil {
+		msg.Header = natsgo.Header{}
+	}
+	propagator.Inject(ctx, propagation.HeaderCarrier(msg.Header))
+}
+
+// Returns a copy of ctx carrying the trace context found in the headers of a NATS message,
+// if any.
+func ExtractNATS(ctx context.Context, msg *natsgo.Msg) context.Context {
+	if msg.Header == nil {
+		return ctx
+	}
+	return propagator.Extract(ctx, propagation.HeaderCarrier(msg.Header))
+}
+
+// Returns the trace context of ctx in a form which can be stored, e.g. in the database.
+func Marshal(ctx context.Context) map[string]string {
+	carrier := propagation.MapCarrier{}
+	propagator.Inject(ctx, carrier)
+	return carrier
+}
+
+// Returns a copy of ctx carrying a trace context previously returned by Marshal.
+func Unmarshal(ctx context.Context, stored map[string]string) context.Context {
+	return propagator.Extract(ctx, propagation.MapCarrier(stored))
+}
+
+// Returns a link to the span whose context was previously returned by Marshal. The link is
+// invalid (and ignored by spans) if the stored context is empty.
+func Link(stored map[string]string, attrs ...attribute.KeyValue) trace.Link {
+	return trace.Link{
+		SpanContext: trace.SpanContextFromContext(Unmarshal(context.Background(), stored)),
+		Attributes:  attrs,
+	}
+}
+
+// Records an error on a span, if not nil.
+func RecordError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
@@ -9,9 +9,10 @@ import (
 	"github.com/openrfsense/common/stats"
 )
 
-func fetchAllSensorStats() ([]stats.Stats, error) {
+func fetchAllSensorStats(org string) ([]stats.Stats, error) {
 	statsAll, err := nats.Ping[stats.Stats]("node.all", "node.get.all", nats.PingConfig{
-		Timeout: 100 * time.Millisecond,
+		Timeout:      100 * time.Millisecond,
+		Organization: org,
 	})
 	if err != nil {
 		return nil, err
@@ -20,10 +21,10 @@ func fetchAllSensorStats() ([]stats.Stats, error) {
 	return statsAll, nil
 }
 
-func fetchSensorStats(id string) (stats.Stats, error) {
+func fetchSensorStats(org string, id string) (stats.Stats, error) {
 	stat := stats.Stats{}
 	channel := fmt.Sprintf("node.%s.stats", strings.Trim(id, "."))
-	err := nats.Conn().Request(channel, "", &stat, 300*time.Millisecond)
+	err := nats.ConnFor(org).Request(channel, "", &stat, 300*time.Millisecond)
 	if err != nil {
 		return stats.Stats{}, err
 	}
@@ -71,6 +71,23 @@ form.addEventListener("submit", event => {
     })
 })
 
+// Approve or reject pending enrollment requests
+document.querySelectorAll(".enrollment-button").forEach(b => {
+    b.addEventListener("click", () => {
+        fetch(
+            `/api/v1/enrollments/${b.dataset.sensorId}/${b.dataset.action}`,
+            { method: "post" }
+        ).then(response => {
+            if (!response.ok) {
+                document.getElementById("alert-error").classList.toggle("show", true)
+                return
+            }
+
+            b.closest("tr").remove()
+        })
+    })
+})
+
 // Raw measurement radio toggle in modal
 document.querySelector("input[value=raw]").addEventListener("change", () => {
     document.querySelectorAll(".aggregated-vanish").forEach(i => i.style.display = "")
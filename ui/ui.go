@@ -11,11 +11,14 @@ import (
 	"github.com/gofiber/fiber/v2/middleware/compress"
 	"github.com/gofiber/fiber/v2/middleware/filesystem"
 	"github.com/gofiber/template/html"
+	"github.com/knadh/koanf"
 	"golang.org/x/text/cases"
 	"golang.org/x/text/language"
 
 	"github.com/openrfsense/backend/database"
 	"github.com/openrfsense/backend/database/models"
+	"github.com/openrfsense/backend/nodes"
+	"github.com/openrfsense/backend/orgs"
 	"github.com/openrfsense/common/logging"
 )
 
@@ -59,7 +62,9 @@ func NewEngine() *html.Engine {
 }
 
 // Configure a router and use a logger for the UI. Initializes routes and view models.
-func Init(router *fiber.App) {
+// Pages require the same authentication as the API, as they only show data belonging
+// to the organization of the user.
+func Init(config *koanf.Koanf, router *fiber.App) {
 	router.Use(
 		"/static",
 		compress.New(compress.Config{
@@ -76,8 +81,9 @@ func Init(router *fiber.App) {
 		}),
 	)
 
-	router.Get("/", renderIndex)
-	router.Get("/sensor/:sensor_id", renderSensorPage)
+	auth := orgs.Authentication(config)
+	router.Get("/", auth, renderIndex)
+	router.Get("/sensor/:sensor_id", auth, renderSensorPage)
 }
 
 // A custom Fiber error handler which renders a simple web page.
@@ -116,13 +122,20 @@ func ErrorHandler(ctx *fiber.Ctx, err error) error {
 }
 
 func renderIndex(ctx *fiber.Ctx) error {
-	sensorStats, err := fetchAllSensorStats()
+	org := orgs.Current(ctx)
+	sensorStats, err := fetchAllSensorStats(org)
+	if err != nil {
+		return err
+	}
+
+	enrollments, err := nodes.List(ctx.Context(), org, models.NodePending)
 	if err != nil {
 		return err
 	}
 
 	return ctx.Render("views/index", fiber.Map{
-		"sensors": sensorStats,
+		"enrollments": enrollments,
+		"sensors":     sensorStats,
 	})
 }
 
@@ -132,7 +145,8 @@ func renderSensorPage(ctx *fiber.Ctx) error {
 		return ctx.SendStatus(http.StatusBadRequest)
 	}
 
-	stat, err := fetchSensorStats(id)
+	org := orgs.Current(ctx)
+	stat, err := fetchSensorStats(org, id)
 	if err != nil {
 		return fiber.ErrNotFound
 	}
@@ -140,6 +154,8 @@ func renderSensorPage(ctx *fiber.Ctx) error {
 	sql, args, _ := database.Instance().Select("*").
 		From("campaigns").
 		Where("? = any (sensors)", id).
+		Where("organization = ?", org).
+		Where("status = ?", models.CampaignActive).
 		ToSql()
 	campaigns, err := database.Multiple[models.Campaign](
 		context.Background(),